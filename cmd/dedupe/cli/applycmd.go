@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply PLAN",
+	Short: "executes a resolution plan written by 'dedupe plan'",
+	Long: `Executes the actions of a plan file. Every group is validated against the current state of its files
+before anything is done: groups where every copy would be removed, where no file is kept, where a file
+under a reference would be modified, or where a file is missing, changed size or was modified since the
+checksums of the plan were calculated are refused and left untouched. The kept files are re-hashed against the checksum of their group, so a
+mistyped keep line never leaves a group without a copy.
+
+The references of the plan are always protected, along with the ones given with '--reference' and the
+ones of the report given with '--report'.
+
+With '--script', nothing is changed: a shell script performing the actions of the valid groups is written
+instead, so it can be reviewed and run later by someone with write access.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runApply,
+}
+
+func init() {
+	applyCmd.Flags().BoolP("dry-run", "d", false, "Validates the plan and prints the actions that would be taken without taking them")
+	applyCmd.Flags().Bool("verify", false, "Re-calculates the checksums of the kept file and the duplicate right before acting on it, instead of only checking their metadata")
+	applyCmd.Flags().Bool("no-keep-check", false, "Skips re-hashing the kept files of each group against its checksum, only checking their size")
+	applyCmd.Flags().StringArrayP("reference", "R", nil, "Protects a directory as a read-only reference, in addition to the references of the plan. Can be repeated")
+	applyCmd.Flags().String("report", "", "Protects the references of the report the plan was generated from as well")
+	applyCmd.Flags().String("io-mode", string(dedupe.IOBuffered), "Indicates how files are read when verifying checksums (buffered, nocache, direct)")
+	applyCmd.Flags().StringP("journal", "j", "", "Appends every action taken to the given journal file (JSON lines) instead of a new journal in $XDG_STATE_HOME/dedupe. Actions are always journaled so they can be reverted with 'dedupe undo'")
+	applyCmd.Flags().StringP("quarantine", "q", "", "Quarantine directory for the 'quarantine' actions. If set, 'delete' actions are quarantined as well")
+	applyCmd.Flags().Bool("trash", false, "Moves the files to delete to the trash instead")
+	applyCmd.Flags().String("script", "", "Writes a POSIX shell script performing the actions of the plan to the given file instead of applying them. Every destructive command is guarded by a size and checksum check")
+	rootCmd.AddCommand(applyCmd)
+}
+
+func runApply(cmd *cobra.Command, args []string) {
+	dryrun, _ := cmd.Flags().GetBool("dry-run")
+	verify, _ := cmd.Flags().GetBool("verify")
+	journal, _ := cmd.Flags().GetString("journal")
+	quarantine, _ := cmd.Flags().GetString("quarantine")
+	trash, _ := cmd.Flags().GetBool("trash")
+	script, _ := cmd.Flags().GetString("script")
+	noKeepCheck, _ := cmd.Flags().GetBool("no-keep-check")
+	references, _ := cmd.Flags().GetStringArray("reference")
+	report, _ := cmd.Flags().GetString("report")
+
+	if report != "" {
+		references = append(references, loadReport(report).References...)
+	}
+
+	if trash && quarantine != "" {
+		log.Error("The 'trash' and 'quarantine' flags cannot be used together")
+		os.Exit(-1)
+	}
+
+	c := &cli{
+		Algorithm:  dedupe.HashSHA256,
+		IOMode:     readIOMode(cmd),
+		DryRun:     dryrun,
+		Verify:     verify,
+		Journal:    journal,
+		Quarantine: quarantine,
+		Trash:      trash,
+		References: references,
+	}
+	if script != "" {
+		c.Script(args[0], script)
+		return
+	}
+	c.Apply(args[0], !noKeepCheck)
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// Compare classifies the contents of the two given trees as unique to each of them or shared.
+func (c *cli) Compare(pathA, pathB string, summary bool) {
+	instance := dedupe.New()
+	instance.SetOptions(c.options())
+
+	report, err := instance.Compare(pathA, pathB)
+	if err != nil {
+		log.Errorf("Unable to compare directories. %s", err.Error())
+		os.Exit(1)
+	}
+
+	if len(report.Errors) > 0 {
+		fmt.Println(a.Bold(a.Red("Errors:")))
+		for _, e := range report.Errors {
+			fmt.Println(a.Gray(16, "- "+e.Error()))
+		}
+		fmt.Println()
+	}
+
+	if !summary {
+		printCompareEntries(fmt.Sprintf("Only in %s:", report.A), report.OnlyA)
+		printCompareEntries(fmt.Sprintf("Only in %s:", report.B), report.OnlyB)
+
+		fmt.Println(a.Bold(a.Blue("In both:")))
+		for _, s := range report.Shared {
+			fmt.Println(a.Green("Checksum:  "), a.Cyan(s.Checksum), a.Gray(12, formatBytes(s.Size)))
+			for _, f := range s.A {
+				fmt.Println(a.Gray(12, "  A: "+f))
+			}
+			for _, f := range s.B {
+				fmt.Println(a.Gray(20, "  B: "+f))
+			}
+		}
+		fmt.Println()
+	}
+
+	fmt.Println(a.Bold(a.Blue("Summary:")))
+	fmt.Printf("  %s %d files, %s\n", a.Green(fmt.Sprintf("Only in %s:", report.A)), len(report.OnlyA), formatBytes(report.OnlyABytes))
+	fmt.Printf("  %s %d files, %s\n", a.Green(fmt.Sprintf("Only in %s:", report.B)), len(report.OnlyB), formatBytes(report.OnlyBBytes))
+	fmt.Printf("  %s %d contents, %s\n", a.Green("In both:"), len(report.Shared), formatBytes(report.SharedBytes))
+	fmt.Println()
+}
+
+func printCompareEntries(title string, entries []dedupe.CompareEntry) {
+	fmt.Println(a.Bold(a.Blue(title)))
+	for _, e := range entries {
+		fmt.Println(a.Gray(12, "- "+e.Path), a.Gray(20, formatBytes(e.Size)))
+	}
+	fmt.Println()
+}
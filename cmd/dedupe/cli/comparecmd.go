@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/spf13/cobra"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare A B",
+	Short: "compares two directories by content, listing what is only in A, only in B, and in both",
+	Long: `Compares two directory trees recursively by content, not by name. Renamed or moved files are
+considered the same content. Prints the files only present in each tree and the contents present in both,
+with their byte totals.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runCompare,
+}
+
+func init() {
+	compareCmd.Flags().StringP("algorithm", "a", string(dedupe.HashSHA256), "Indicates the hashing algorithm to use for checksums (md5, sha256). Default is sha256")
+	compareCmd.Flags().String("io-mode", string(dedupe.IOBuffered), "Indicates how files are read while hashing (buffered, nocache, direct)")
+	compareCmd.Flags().Int("walkers", 8, "Number of directories read concurrently while traversing the trees")
+	compareCmd.Flags().Bool("summary", false, "Only prints the totals of each set")
+	compareCmd.Flags().BoolP("verbose", "v", false, "Enables verbose mode")
+	rootCmd.AddCommand(compareCmd)
+}
+
+func runCompare(cmd *cobra.Command, args []string) {
+	algorithm, _ := cmd.Flags().GetString("algorithm")
+	walkers, _ := cmd.Flags().GetInt("walkers")
+	summary, _ := cmd.Flags().GetBool("summary")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	c := &cli{
+		Verbose:   verbose,
+		Recursive: true,
+		Algorithm: dedupe.HashMode(algorithm),
+		IOMode:    readIOMode(cmd),
+		Walkers:   walkers,
+	}
+	c.Compare(args[0], args[1], summary)
+}
@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// manifestPrefix starts the name of the manifests written by default.
+const manifestPrefix = ".dedupe-manifest-"
+
+// Consolidate places every unique file of the source trees into the destination, once, and writes the
+// manifest of where each source file ended up, or would end up on a dry run, to the given file or to a new
+// one if empty.
+func (c *cli) Consolidate(dest string, sources []string, move bool, manifest string) {
+	absDest := absOrSelf(dest)
+	for i, src := range sources {
+		sources[i] = filepath.Clean(src)
+		if abs := absOrSelf(src); dedupe.IsUnder(absDest, abs) || dedupe.IsUnder(abs, absDest) {
+			log.Errorf("The destination %s and the source %s cannot be nested", dest, src)
+			os.Exit(-1)
+		}
+	}
+	if manifest == "" {
+		manifest = defaultManifest(dest, c.DryRun)
+	}
+
+	report := c.scan(sources...)
+	for _, err := range report.Errors {
+		fmt.Println(a.Red("Unable to read "), err.Error())
+	}
+
+	// Files are placed relative to the first source they are found under.
+	roots := map[string]string{}
+	var files []string
+	for _, src := range sources {
+		list, errs := c.listFiles([]string{src})
+		for _, err := range errs {
+			fmt.Println(a.Red("Unable to read "), err.Error())
+		}
+		for _, f := range list {
+			if _, ok := roots[f]; !ok {
+				roots[f] = src
+				files = append(files, f)
+			}
+		}
+	}
+	sort.Strings(files)
+
+	// For every group of duplicates only the selected copy is placed, the others are recorded against it.
+	checksums := map[string]string{}
+	keep := map[string]bool{}
+	for _, g := range report.Groups() {
+		sel, err := dedupe.SelectKeep(g.Files, c.Prefer, c.Policies...)
+		if err != nil {
+			fmt.Println(a.Red("Unable to select the file to place "), err.Error())
+			sel = &dedupe.Selection{Keep: g.Files[0]}
+		}
+		keep[sel.Keep] = true
+		for _, f := range g.Files {
+			checksums[f] = g.Checksum
+		}
+	}
+
+	if !c.DryRun {
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			log.Errorf("Unable to create destination directory %s. %s", dest, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	consolidator := dedupe.NewConsolidator(dest, &dedupe.ConsolidateOptions{
+		Mode:   c.Algorithm,
+		IOMode: c.IOMode,
+		Move:   move,
+		DryRun: c.DryRun,
+	})
+	placed := map[string]*dedupe.ConsolidateEntry{}
+	entries := map[string]*dedupe.ConsolidateEntry{}
+	counts := map[dedupe.ConsolidateStatus]int{}
+	var copied int64
+
+	for _, f := range files {
+		sum, dupe := checksums[f]
+		if dupe && !keep[f] {
+			continue
+		}
+		info, _ := os.Lstat(f)
+		entry := consolidator.Place(roots[f], f, sum)
+		if dupe {
+			placed[sum] = entry
+		}
+		entries[f] = entry
+		counts[entry.Status]++
+		if entry.Status == dedupe.ConsolidatePlaced && info != nil {
+			copied += info.Size()
+		}
+		c.printConsolidate(entry, move)
+	}
+
+	for _, f := range files {
+		sum, dupe := checksums[f]
+		if !dupe || keep[f] {
+			continue
+		}
+		var entry *dedupe.ConsolidateEntry
+		if of, ok := placed[sum]; ok {
+			entry = consolidator.Duplicate(f, of)
+		} else {
+			// The selected copy was not found while listing the sources, place this one instead.
+			entry = consolidator.Place(roots[f], f, sum)
+			placed[sum] = entry
+		}
+		entries[f] = entry
+		counts[entry.Status]++
+		c.printConsolidate(entry, move)
+	}
+
+	list := make([]*dedupe.ConsolidateEntry, 0, len(files))
+	for _, f := range files {
+		list = append(list, entries[f])
+	}
+	if err := writeConsolidateManifest(manifest, list); err != nil {
+		log.Errorf("Unable to write manifest file. %s", err.Error())
+		os.Exit(1)
+	}
+
+	action := "Copied:    "
+	if move {
+		action = "Moved:     "
+	}
+	fmt.Println()
+	fmt.Println(a.Green(action), counts[dedupe.ConsolidatePlaced], a.Gray(12, formatBytes(copied)))
+	fmt.Println(a.Green("Existing:  "), counts[dedupe.ConsolidateExisting])
+	fmt.Println(a.Yellow("Duplicates:"), counts[dedupe.ConsolidateDuplicate])
+	fmt.Println(a.Red("Failed:    "), counts[dedupe.ConsolidateFailed])
+	fmt.Println(a.Green("Manifest written to "), a.Cyan(manifest))
+
+	if counts[dedupe.ConsolidateFailed]+len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+func (c *cli) printConsolidate(entry *dedupe.ConsolidateEntry, move bool) {
+	switch {
+	case entry.Status == dedupe.ConsolidateFailed:
+		fmt.Println(a.Red("Unable to consolidate file "), entry.Source)
+		fmt.Println(a.Red("    "), entry.Err.Error())
+	case entry.Status == dedupe.ConsolidateDuplicate:
+		if c.Verbose {
+			fmt.Println(a.Bold(a.Yellow("(duplicate) ")), entry.Source, a.Gray(12, "same contents as "+entry.Dest))
+		}
+	case entry.Status == dedupe.ConsolidateExisting:
+		if c.Verbose {
+			fmt.Println(a.Bold(a.Gray(12, "(existing)  ")), entry.Source, a.Gray(12, "already at "+entry.Dest))
+		}
+	case c.DryRun:
+		fmt.Println(a.Bold(a.Magenta("(to place)  ")), entry.Source, " > ", entry.Dest)
+	case move:
+		fmt.Println(a.Bold(a.Green("(moved)     ")), entry.Source, " > ", entry.Dest)
+	default:
+		fmt.Println(a.Bold(a.Green("(copied)    ")), entry.Source, " > ", entry.Dest)
+	}
+}
+
+// defaultManifest returns a new manifest file in the destination, or in the working directory when the
+// destination is not created yet on a dry run.
+func defaultManifest(dest string, dryRun bool) string {
+	dir := dest
+	if _, err := os.Stat(dest); dryRun && err != nil {
+		dir = "."
+	}
+	name := manifestPrefix + time.Now().Format("20060102-150405")
+	if dryRun {
+		name += ".dry-run"
+	}
+	return filepath.Join(dir, name+".csv")
+}
+
+func writeConsolidateManifest(file string, entries []*dedupe.ConsolidateEntry) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := dedupe.WriteConsolidateManifest(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var consolidateCmd = &cobra.Command{
+	Use:   "consolidate DEST SOURCE [sources...]",
+	Short: "merges several trees into one destination tree holding every unique file once",
+	Long: `Copies every file of the given source trees into DEST, at its path relative to its source, so
+several copies of a home directory can be merged into one tree. Every unique content is placed exactly
+once: for each group of duplicates, the copy placed is picked by '--keep-policy' (lexicographic order by
+default) and the others are recorded as duplicates of it. A path already taken by a file with different
+contents is suffixed as 'name.N.ext', existing files are never overwritten.
+
+Every copy is verified against its source. With '--move' the placed files are moved instead of copied,
+and the duplicates are left in the sources. The manifest (CSV) records where each source file ended up.
+It is written to a new '.dedupe-manifest-<time>.csv' in DEST by default, on dry runs as well (with a
+'.dry-run.csv' extension, in the working directory if DEST does not exist yet).`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  runConsolidate,
+}
+
+func init() {
+	consolidateCmd.Flags().StringP("algorithm", "a", string(dedupe.HashSHA256), "Indicates the hashing algorithm to use for checksums (md5, sha256). Default is sha256")
+	consolidateCmd.Flags().String("io-mode", string(dedupe.IOBuffered), "Indicates how files are read while hashing (buffered, nocache, direct)")
+	consolidateCmd.Flags().Int("walkers", 8, "Number of directories read concurrently while traversing the sources")
+	consolidateCmd.Flags().String("keep-policy", "", "Picks the copy of each group of duplicates to place. A comma separated list applied in order as tie breakers (oldest, newest, shortest-path, longest-path, shallowest, preferred, lexicographic)")
+	consolidateCmd.Flags().StringArray("prefer", nil, "Preferred path for the 'preferred' keep policy. Can be repeated, in order of preference")
+	consolidateCmd.Flags().Bool("move", false, "Moves the placed files into the destination instead of copying them")
+	consolidateCmd.Flags().StringP("manifest", "m", "", "Writes where every source file ended up to the given CSV file. Defaults to a new 'DEST/.dedupe-manifest-<time>.csv'")
+	consolidateCmd.Flags().BoolP("dry-run", "d", false, "Prints where the files would be placed without copying or moving any file")
+	consolidateCmd.Flags().BoolP("verbose", "v", false, "Enables verbose mode, printing the duplicates and the files already in the destination as well")
+	rootCmd.AddCommand(consolidateCmd)
+}
+
+func runConsolidate(cmd *cobra.Command, args []string) {
+	algorithm, _ := cmd.Flags().GetString("algorithm")
+	walkers, _ := cmd.Flags().GetInt("walkers")
+	keepPolicy, _ := cmd.Flags().GetString("keep-policy")
+	prefer, _ := cmd.Flags().GetStringArray("prefer")
+	move, _ := cmd.Flags().GetBool("move")
+	manifest, _ := cmd.Flags().GetString("manifest")
+	dryrun, _ := cmd.Flags().GetBool("dry-run")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	c := &cli{
+		Verbose:   verbose,
+		Recursive: true,
+		Algorithm: dedupe.HashMode(algorithm),
+		IOMode:    readIOMode(cmd),
+		Walkers:   walkers,
+		Prefer:    prefer,
+		DryRun:    dryrun,
+	}
+
+	var err error
+	if keepPolicy != "" {
+		if c.Policies, err = dedupe.ParseKeepPolicies(keepPolicy); err != nil {
+			log.Errorf("Invalid keep policy. %s", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	c.Consolidate(args[0], args[1:], move, manifest)
+}
@@ -2,13 +2,14 @@ package cli
 
 import (
 	"bufio"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jucardi/dedupe/dedupe"
 	"github.com/jucardi/dedupe/shutdown"
@@ -17,75 +18,158 @@ import (
 	a "github.com/logrusorgru/aurora"
 )
 
+var stdin = bufio.NewReader(os.Stdin)
+
+// progress is where the verbose scanning output goes. It is the standard error when the report is written
+// in a machine readable format to the standard output.
+var progress io.Writer = os.Stdout
+
+const (
+	linkSymbolic = "symlink"
+	linkHard     = "hardlink"
+	formatText   = "text"
+
+	// saveInterval is how often the progress file is saved while resolving groups unattended.
+	saveInterval = 2 * time.Second
+)
+
 type cli struct {
-	Algorithm dedupe.HashMode
-	Recursive bool
-	Verbose   bool
-	KeepOne   bool
-	DryRun    bool
-	SaveTo    string
+	Algorithm   dedupe.HashMode
+	IOMode      dedupe.IOMode
+	MemoryLimit int64
+	TempDir     string
+	Walkers     int
+	References  []string
+	Recursive   bool
+	Verbose     bool
+	KeepOne     bool
+	Policies    []dedupe.KeepPolicy
+	Prefer      []string
+	Rules       *dedupe.RuleSet
+	DryRun      bool
+	SaveTo      string
+	Link        string
+	Verify      bool
+	Rehash      bool
+	Journal     string
+	Quarantine  string
+	Trash       bool
+	Format      string
+
+	mu       sync.Mutex
+	report   *dedupe.DupeReport
+	since    time.Time
+	group    *dedupe.Resolution
+	lastSave time.Time
+	resolver dedupe.IResolver
+	freed    int64
 }
 
-func (c *cli) Start(path string) {
-	opts := &dedupe.Options{
-		Recursive: c.Recursive,
-		Mode:      c.Algorithm,
-	}
-
-	if c.Verbose {
-		opts.CurrentDirCallback = printWorkingDirectory
-		opts.ReadingHashCallback = printCalculatingHash
-		opts.HashReadCallback = printFileHash
-	}
+func (c *cli) Start(paths ...string) {
+	c.handleReport(c.scan(paths...))
+}
 
+func (c *cli) scan(paths ...string) *dedupe.DupeReport {
 	instance := dedupe.New()
-	instance.SetOptions(opts)
+	instance.SetOptions(c.options())
 
-	result, err := instance.FindDupes(path)
+	result, err := instance.FindDupes(paths...)
 
 	if err != nil {
 		log.Errorf("Unable to find duplicates. %s", err.Error())
 		os.Exit(1)
 	}
+	return result
+}
+
+func (c *cli) options() *dedupe.Options {
+	opts := &dedupe.Options{
+		Recursive:   c.Recursive,
+		Mode:        c.Algorithm,
+		IOMode:      c.IOMode,
+		MemoryLimit: c.MemoryLimit,
+		TempDir:     c.TempDir,
+		Walkers:     c.Walkers,
+		References:  c.References,
+	}
 
-	c.handleReport(result)
+	if c.Verbose {
+		opts.CurrentDirCallback = printWorkingDirectory
+		opts.ReadingHashCallback = printCalculatingHash
+		opts.HashReadCallback = printFileHash
+	}
+	return opts
 }
 
 func (c *cli) Load(file string) {
-	fmt.Println(a.Green("Loading report from "), a.Cyan(file))
-	fmt.Println(a.Green("Please wait . . ."))
-
-	data, err := os.ReadFile(file)
+	fmt.Fprintln(progress, a.Green("Loading report from "), a.Cyan(file))
+	fmt.Fprintln(progress, a.Green("Please wait . . ."))
 
+	report, err := dedupe.LoadReport(file)
 	if err != nil {
-		log.Panic("Unable to read file", err.Error())
+		log.Errorf("Unable to load report. %s", err.Error())
+		os.Exit(1)
 	}
 
-	var report *dedupe.DupeReport
+	// The checksums of the report can only be verified with the algorithm they were calculated with.
+	if report.Algorithm != "" {
+		c.Algorithm = report.Algorithm
+	}
+	c.revalidate(report)
+	c.handleReport(report)
+}
 
-	if err := json.Unmarshal(data, report); err != nil {
-		log.Panic("Unable to unmarshal report file", err.Error())
+// revalidate drops the files of a loaded report that were moved, deleted or modified since it was
+// created, so no action is taken on them, and prints what changed.
+func (c *cli) revalidate(report *dedupe.DupeReport) {
+	if c.Rehash {
+		fmt.Fprintln(progress, a.Green("Verifying the checksums of the report . . ."))
+	}
+	stale := report.Revalidate(&dedupe.RevalidateOptions{
+		Mode:   c.Algorithm,
+		IOMode: c.IOMode,
+		Rehash: c.Rehash,
+	})
+
+	if len(stale.Files) == 0 {
+		fmt.Fprintln(progress, a.Green("The report is up to date,"), a.Gray(12, fmt.Sprintf("%d files checked", stale.Checked)))
+		return
 	}
 
-	c.handleReport(report)
+	fmt.Fprintln(progress)
+	fmt.Fprintln(progress, a.Bold(a.Yellow("The report is stale:")))
+	for _, f := range stale.Files {
+		fmt.Fprintln(progress, a.Yellow(fmt.Sprintf("  (%s) ", f.Reason)), f.Path, a.Gray(12, f.Detail))
+	}
+	fmt.Fprintln(progress)
+	fmt.Fprintln(progress, a.Cyan("  Checked:  "), stale.Checked, a.Gray(12, "files"))
+	fmt.Fprintln(progress, a.Cyan("  Missing:  "), stale.Count(dedupe.StaleMissing))
+	fmt.Fprintln(progress, a.Cyan("  Changed:  "), stale.Count(dedupe.StaleChanged))
+	fmt.Fprintln(progress, a.Cyan("  Dissolved:"), len(stale.Dissolved), a.Gray(12, "groups left with less than two files"))
+	fmt.Fprintln(progress, a.Gray(12, "  Stale files were removed from the report and will not be acted on."))
 }
 
 func (c *cli) handleReport(report *dedupe.DupeReport) {
-	remaining := &dedupe.DupeReport{
-		Errors: report.Errors,
-		Dupes:  map[string][]string{},
+	c.report = report
+
+	// Machine formats only write the report, keeping the standard output free of anything else.
+	if c.Format != "" && c.Format != formatText {
+		if err := c.saveProgress(true); err != nil {
+			log.Errorf("Unable to save report to %s. %s", c.SaveTo, err.Error())
+			os.Exit(1)
+		}
+		c.writeReport(report)
+		return
 	}
 
 	if c.SaveTo != "" {
 		log.Info("Shutdown hook registered.")
 		shutdown.AddShutdownHook(func() error {
 			log.Info("exiting")
-			return saveProgress(c.SaveTo, remaining)
+			fmt.Println(a.Green("Saving report to "), a.Cyan(c.SaveTo))
+			fmt.Println(a.Green("Please wait . . ."))
+			return c.saveProgress(true)
 		})
-
-		for k, v := range report.Dupes {
-			remaining.Dupes[k] = v
-		}
 	}
 
 	if len(report.Errors) > 0 {
@@ -102,37 +186,135 @@ func (c *cli) handleReport(report *dedupe.DupeReport) {
 	if len(report.Dupes) == 0 {
 		fmt.Println(a.Green("No duplicates."))
 		fmt.Println()
+		c.checkpoint(true)
 		return
 	}
 
+	state := report.Progress()
+	resumed := state.Pending < state.Groups
+	if resumed {
+		printProgress("Resuming:", state)
+	}
+
 	fmt.Println()
 	fmt.Println(a.Bold(a.Blue("Duplicates:")))
 
-	count := 0
-	for k, v := range report.Dupes {
-		fmt.Println()
-		fmt.Println(a.Gray(12, fmt.Sprint("Items left:")), a.Gray(20, fmt.Sprint(len(report.Dupes)-count)))
-		fmt.Println(a.Green("Checksum:  "), a.Cyan(k))
-
-		count++
-		if c.KeepOne {
-			c.askSingleChoice(v)
+	left := state.Pending
+	for _, g := range report.Groups() {
+		if report.IsResolved(g.Checksum) {
 			continue
 		}
 
-		for _, f := range v {
-			fmt.Println(a.Gray(12, "- "+f))
+		fmt.Println()
+		fmt.Println(a.Gray(12, fmt.Sprint("Items left:")), a.Gray(20, fmt.Sprint(left)))
+		fmt.Println(a.Green("Checksum:  "), a.Cyan(g.Checksum))
+		left--
+
+		c.group = &dedupe.Resolution{}
+		decided := true
+
+		if refs, others := report.SplitReferences(g.Files); len(refs) > 0 {
+			printReferenceGroup(refs, others)
+			if c.unattended() {
+				c.resolveUnattended(g.Checksum, g.Files)
+			} else if c.KeepOne {
+				decided = c.askReferenceChoice(g.Checksum, refs, others)
+			}
+		} else if c.unattended() {
+			c.resolveUnattended(g.Checksum, g.Files)
+		} else if c.KeepOne {
+			decided = c.askSingleChoice(g.Checksum, g.Files)
+		} else {
+			for _, f := range g.Files {
+				fmt.Println(a.Gray(12, "- "+f))
+			}
 		}
 
-		if c.SaveTo != "" {
-			delete(remaining.Dupes, k)
+		if !decided {
+			fmt.Println()
+			fmt.Println(a.Yellow("The input was closed, stopping."))
+			break
 		}
+		c.finishGroup(g.Checksum)
 	}
 
 	fmt.Println()
+	if c.freed > 0 {
+		fmt.Println(a.Green("Space freed:"), a.Cyan(formatBytes(c.freed)))
+		fmt.Println()
+	}
+
+	c.checkpoint(true)
+	if resumed || c.SaveTo != "" {
+		printProgress("Progress:", report.Progress())
+		fmt.Println()
+	}
+}
+
+// finishGroup records the resolution of the current group in the report, if it was resolved. Listing a
+// group, or a dry run, does not resolve it.
+func (c *cli) finishGroup(checksum string) {
+	res := c.group
+	c.group = nil
+	if res == nil || c.DryRun || (!c.KeepOne && !c.unattended()) {
+		return
+	}
+
+	res.Finish()
+	c.mu.Lock()
+	c.report.SetResolution(checksum, res)
+	c.mu.Unlock()
+
+	// Interactive decisions are saved right away, unattended ones periodically.
+	c.checkpoint(c.KeepOne && !c.unattended())
+}
+
+// checkpoint saves the progress file, at most once every few seconds unless forced.
+func (c *cli) checkpoint(force bool) {
+	if err := c.saveProgress(force); err != nil {
+		log.Warnf("Unable to save progress. %s", err.Error())
+	}
+}
+
+func (c *cli) saveProgress(force bool) error {
+	if c.SaveTo == "" || c.report == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !force && time.Since(c.lastSave) < saveInterval {
+		return nil
+	}
+	c.lastSave = time.Now()
+	return dedupe.SaveReport(c.SaveTo, c.report)
 }
 
-func (c *cli) askSingleChoice(files []string) {
+func printProgress(title string, p *dedupe.ReportProgress) {
+	var parts []string
+	for _, d := range []dedupe.ResolutionDecision{dedupe.DecisionDeleted, dedupe.DecisionLinked, dedupe.DecisionKept, dedupe.DecisionSkipped} {
+		if n := p.Resolved[d]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, d))
+		}
+	}
+	resolved := p.Groups - p.Pending
+
+	fmt.Println()
+	fmt.Print(a.Green(title+" "), fmt.Sprintf("%d of %d groups resolved", resolved, p.Groups))
+	if len(parts) > 0 {
+		fmt.Print(a.Gray(12, " ("+strings.Join(parts, ", ")+")"))
+	}
+	fmt.Println()
+	if p.Failed > 0 {
+		fmt.Println(a.Red("  Failed, to be retried:"), p.Failed)
+	}
+	fmt.Println(a.Cyan("  Left:"), p.Pending, a.Gray(12, "groups, "+formatBytes(p.PendingBytes)+" reclaimable"))
+}
+
+// askSingleChoice prompts for the resolution of a group. It returns false if the input was closed before
+// an answer was given.
+func (c *cli) askSingleChoice(checksum string, files []string) bool {
 	var err = errors.New("initial")
 	fmt.Println(a.Green("Which file would you like to keep?"))
 
@@ -141,32 +323,37 @@ func (c *cli) askSingleChoice(files []string) {
 		c.printCommonChoice("a", "  All")
 		c.printCommonChoice("n", "  None")
 		c.printCommonChoice("s {}", "Keeps {} and replaces the other files with symbolic links to {}", "N")
+		c.printCommonChoice("h {}", "Keeps {} and replaces the other files with hard links to {}", "N")
 		fmt.Println()
 
 		for i, f := range files {
 			c.printChoice(strconv.Itoa(i+1), f)
 		}
 
-		reader := bufio.NewReader(os.Stdin)
-		text, _ := reader.ReadString('\n')
-
-		choice := stringx.New(text).ToLower().Trim("\n").S()
+		choice, ok := readChoice()
+		if !ok {
+			return false
+		}
 
 		switch choice {
 		case "n":
-			c.deleteFiles(files)
+			c.resolve(dedupe.ActionDelete, checksum, "", files)
 			fallthrough
 		case "a":
 			err = nil
 		default:
 			var (
-				val     string
-				symlink bool
+				val      string
+				symlink  bool
+				hardlink bool
 			)
 
 			if strings.HasPrefix(choice, "s") {
 				val = stringx.New(choice).Replace("s", "", 1).TrimSpace().S()
 				symlink = true
+			} else if strings.HasPrefix(choice, "h") {
+				val = stringx.New(choice).Replace("h", "", 1).TrimSpace().S()
+				hardlink = true
 			} else {
 				val = choice
 			}
@@ -174,34 +361,154 @@ func (c *cli) askSingleChoice(files []string) {
 			if j, e := strconv.ParseInt(val, 0, 0); e != nil || int(j) <= 0 || int(j) > len(files) {
 				fmt.Println(a.Red("Invalid choice"))
 			} else {
-				deletedFiles := append(files[:j-1], files[j:]...)
-				c.deleteFiles(deletedFiles)
+				deletedFiles := append(append([]string{}, files[:j-1]...), files[j:]...)
 				err = nil
 
-				if symlink {
-					src, e := filepath.Abs(files[j-1])
-					if e != nil {
-						fmt.Println(a.Red(e.Error()))
-						continue
-					}
-					for _, oldFile := range deletedFiles {
-						trg, e := filepath.Abs(oldFile)
-						if e != nil {
-							fmt.Println(a.Red(e.Error()))
-							continue
-						}
-						if c.DryRun {
-							fmt.Println(a.Bold(a.Green("(symlink to be created) ")), src, " > ", trg)
-						} else if e = os.Symlink(src, trg); e != nil {
-							fmt.Println(a.Red(e.Error()))
-						} else {
-							fmt.Println(a.Bold(a.Green("(symlink) ")), oldFile, " > ", files[j])
-						}
-					}
+				switch {
+				case hardlink:
+					c.resolve(dedupe.ActionHardlink, checksum, files[j-1], deletedFiles)
+				case symlink:
+					c.resolve(dedupe.ActionSymlink, checksum, files[j-1], deletedFiles)
+				default:
+					c.resolve(dedupe.ActionDelete, checksum, files[j-1], deletedFiles)
 				}
 			}
 		}
 	}
+	return true
+}
+
+// askReferenceChoice prompts for the resolution of a group that has copies in a reference root. The
+// reference copies are always kept, only the other copies can be removed or replaced. It returns false if
+// the input was closed before an answer was given.
+func (c *cli) askReferenceChoice(checksum string, refs, others []string) bool {
+	fmt.Println(a.Green("What would you like to do with the copies outside the archive?"))
+
+	for {
+		fmt.Println()
+		c.printCommonChoice("a", "Keep all")
+		c.printCommonChoice("n", "Delete the copies outside the archive")
+		c.printCommonChoice("s", "Replace the copies outside the archive with symbolic links to the archive copy")
+		c.printCommonChoice("h", "Replace the copies outside the archive with hard links to the archive copy")
+		fmt.Println()
+
+		choice, ok := readChoice()
+		if !ok {
+			return false
+		}
+
+		switch choice {
+		case "a":
+			return true
+		case "n":
+			c.resolve(dedupe.ActionDelete, checksum, refs[0], others)
+			return true
+		case "s":
+			c.resolve(dedupe.ActionSymlink, checksum, refs[0], others)
+			return true
+		case "h":
+			c.resolve(dedupe.ActionHardlink, checksum, refs[0], others)
+			return true
+		default:
+			fmt.Println(a.Red("Invalid choice"))
+		}
+	}
+}
+
+func (c *cli) unattended() bool {
+	return c.Rules != nil || len(c.Policies) > 0
+}
+
+func (c *cli) resolveUnattended(checksum string, files []string) {
+	if c.Rules != nil {
+		c.applyRules(checksum, files)
+	} else {
+		c.applyPolicy(checksum, files)
+	}
+}
+
+// applyRules resolves a group without prompting, as decided by the user defined rules.
+func (c *cli) applyRules(checksum string, files []string) {
+	decision, err := c.Rules.Decide(c.report, files)
+	if err != nil {
+		fmt.Println(a.Red("Unable to apply rules, skipping. "), err.Error())
+		c.decide(dedupe.DecisionSkipped, dedupe.OutcomeFailed)
+		return
+	}
+	if decision.Err != nil {
+		fmt.Println(a.Bold(a.Red("(skipped) ")), a.Gray(12, decision.Err.Error()))
+		c.decide(dedupe.DecisionSkipped, dedupe.OutcomeFailed)
+		return
+	}
+	if decision.Keep == "" {
+		fmt.Println(a.Bold(a.Yellow("(skipped) ")), a.Gray(12, "no file of the group matched a keep rule"))
+		c.decide(dedupe.DecisionSkipped, "")
+		return
+	}
+
+	var toDelete, toLink, toHardlink []string
+	for _, fd := range decision.Files {
+		switch fd.Action {
+		case dedupe.RuleKeep:
+			fmt.Println(a.Bold(a.Green("(keep) ")), fd.Path, a.Gray(12, "["+describeRule(fd)+"]"))
+		case dedupe.RuleDelete:
+			toDelete = append(toDelete, fd.Path)
+		case dedupe.RuleLink:
+			toLink = append(toLink, fd.Path)
+		case dedupe.RuleHardlink:
+			toHardlink = append(toHardlink, fd.Path)
+		default:
+			fmt.Println(a.Bold(a.Yellow("(skipped) ")), fd.Path, a.Gray(12, "["+describeRule(fd)+"]"))
+		}
+	}
+
+	c.resolve(dedupe.ActionDelete, checksum, decision.Keep, toDelete)
+	c.resolve(dedupe.ActionSymlink, checksum, decision.Keep, toLink)
+	c.resolve(dedupe.ActionHardlink, checksum, decision.Keep, toHardlink)
+}
+
+// applyPolicy resolves a group without prompting, keeping the file chosen by the keep policies (or the
+// reference copy, if any) and deleting the rest.
+func (c *cli) applyPolicy(checksum string, files []string) {
+	var sel *dedupe.Selection
+
+	if refs, others := c.report.SplitReferences(files); len(refs) > 0 {
+		sel = &dedupe.Selection{Keep: refs[0], Remove: others, Reason: "already present in the reference"}
+	} else if s, err := dedupe.SelectKeep(files, c.Prefer, c.Policies...); err != nil {
+		fmt.Println(a.Red("Unable to apply keep policy, skipping. "), err.Error())
+		c.decide(dedupe.DecisionSkipped, dedupe.OutcomeFailed)
+		return
+	} else {
+		sel = s
+	}
+
+	fmt.Println(a.Bold(a.Green("(keep) ")), sel.Keep, a.Gray(12, "["+sel.Reason+"]"))
+
+	switch c.Link {
+	case linkHard:
+		c.resolve(dedupe.ActionHardlink, checksum, sel.Keep, sel.Remove)
+	case linkSymbolic:
+		c.resolve(dedupe.ActionSymlink, checksum, sel.Keep, sel.Remove)
+	default:
+		c.resolve(dedupe.ActionDelete, checksum, sel.Keep, sel.Remove)
+	}
+}
+
+// decide sets the decision of the group being resolved, and its outcome if it is known upfront.
+func (c *cli) decide(decision dedupe.ResolutionDecision, outcome dedupe.ResolutionOutcome) {
+	if c.group != nil {
+		c.group.Decision = decision
+		c.group.Outcome = outcome
+	}
+}
+
+// readChoice reads the next answer from the standard input. It returns false if the input is closed.
+func readChoice() (string, bool) {
+	text, err := stdin.ReadString('\n')
+	if err != nil && text == "" {
+		return "", false
+	}
+	return stringx.New(text).ToLower().Trim("\n").TrimSpace().S(), true
 }
 
 func (c *cli) printChoice(s string, option string) {
@@ -221,49 +528,37 @@ func (c *cli) printCommonChoice(s string, option string, indicator ...string) {
 	fmt.Println()
 }
 
-func (c *cli) deleteFiles(files []string) {
-	for _, v := range files {
-		if c.DryRun {
-			fmt.Println(a.Bold(a.Magenta("(to delete) ")), v)
-			continue
-		}
+func printReferenceGroup(refs, others []string) {
+	fmt.Println(a.Green("Already present in archive at:"))
+	for _, f := range refs {
+		fmt.Println(a.Gray(12, "  "+f))
+	}
+	for _, f := range others {
+		fmt.Println(a.Gray(20, "- "+f))
+	}
+}
 
-		if err := os.Remove(v); err != nil {
-			fmt.Println(a.Red("Unable to delete file "), v)
-			fmt.Println(a.Red("    "), err.Error())
-		} else {
-			fmt.Println(a.Bold(a.Red("(deleted) ")), v)
-		}
+// writeReport writes the report to the standard output in the machine readable format set.
+func (c *cli) writeReport(report *dedupe.DupeReport) {
+	writer, err := dedupe.NewReportWriter(dedupe.ReportFormat(c.Format))
+	if err != nil {
+		log.Errorf("Unable to write report. %s", err.Error())
+		os.Exit(-1)
+	}
+	if err := writer.Write(os.Stdout, report); err != nil {
+		log.Errorf("Unable to write report. %s", err.Error())
+		os.Exit(1)
 	}
 }
 
 func printWorkingDirectory(dir string) {
-	fmt.Println(a.Green("  > Checking contents in directory: "), a.Cyan(dir))
+	fmt.Fprintln(progress, a.Green("  > Checking contents in directory: "), a.Cyan(dir))
 }
 
 func printCalculatingHash(file string) {
-	fmt.Print(a.Green("  > Calculating Hash on file: "), a.Cyan(file))
+	fmt.Fprint(progress, a.Green("  > Calculating Hash on file: "), a.Cyan(file))
 }
 
 func printFileHash(file, hash string) {
-	fmt.Println("			> ", a.Bold(a.Red(hash)))
-}
-
-func saveProgress(target string, report *dedupe.DupeReport) error {
-	fmt.Println(a.Green("Saving report to "), a.Cyan(target))
-	fmt.Println(a.Green("Please wait . . ."))
-
-	data, err := json.Marshal(report)
-	if err != nil {
-		return fmt.Errorf("error marshalling report, %s", err.Error())
-	}
-	file, err := os.Create(target)
-	if err != nil {
-		return fmt.Errorf("unable to create report file, %s", err.Error())
-	}
-	defer file.Close()
-	if _, err := file.Write(data); err != nil {
-		return fmt.Errorf("unable to write data to report file, %s", err.Error())
-	}
-	return file.Sync()
+	fmt.Fprintln(progress, "			> ", a.Bold(a.Red(hash)))
 }
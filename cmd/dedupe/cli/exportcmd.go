@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export STORE PATH [paths...]",
+	Short: "copies the unique contents of the given trees into a content-addressable store",
+	Long: `Copies every file of the given trees into the store directory, where each unique content is kept
+once as 'STORE/ab/cd/<hash>'. The manifest of the store ('STORE/manifest.jsonl') maps every original path
+to its content, so the trees can be rebuilt with 'dedupe restore'. Several trees, or several versions of
+a tree, can be exported to the same store. The trees are not modified.`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  runExport,
+}
+
+func init() {
+	exportCmd.Flags().StringP("algorithm", "a", "", "Indicates the hashing algorithm to use for checksums (md5, sha256). Defaults to the algorithm of the store, or sha256 for a new store")
+	exportCmd.Flags().String("io-mode", string(dedupe.IOBuffered), "Indicates how files are read while hashing (buffered, nocache, direct)")
+	exportCmd.Flags().BoolP("verbose", "v", false, "Prints every file exported")
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) {
+	algorithm, _ := cmd.Flags().GetString("algorithm")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	c := &cli{
+		Verbose:   verbose,
+		Recursive: true,
+		Algorithm: dedupe.HashMode(algorithm),
+		IOMode:    readIOMode(cmd),
+	}
+	c.Export(args[0], args[1:])
+}
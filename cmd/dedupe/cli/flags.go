@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+// addScanFlags registers the flags controlling how the given paths are scanned.
+func addScanFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("recursive", "r", false, "Indicates if dedupe should find dupes recursively. Default is false")
+	cmd.Flags().StringP("algorithm", "a", string(dedupe.HashSHA256), "Indicates the hashing algorithm to use for checksums (md5, sha256). Default is sha256")
+	cmd.Flags().String("io-mode", string(dedupe.IOBuffered), "Indicates how files are read while hashing (buffered, nocache, direct). 'nocache' and 'direct' avoid evicting the page cache on large trees")
+	cmd.Flags().String("memory-limit", "", "If provided (e.g. 512MB, 2G), bounds the memory used while scanning by spilling intermediate results to disk")
+	cmd.Flags().String("temp-dir", "", "Directory where intermediate results are spilled when using 'memory-limit'. Defaults to the system temp directory")
+	cmd.Flags().Int("walkers", 8, "Number of directories read concurrently while traversing the tree")
+	cmd.Flags().StringArrayP("reference", "R", nil, "Marks a directory as a read-only reference (e.g. an archive). Only groups with files outside the references are reported, and reference files are never modified. Can be repeated")
+	cmd.Flags().BoolP("verbose", "v", false, "Enables verbose mode")
+}
+
+// addResolveFlags registers the flags controlling how the groups are resolved.
+func addResolveFlags(cmd *cobra.Command) {
+	cmd.Flags().String("keep-policy", "", "Resolves every group without prompting, keeping the file picked by the given policies and deleting the rest. A comma separated list applied in order as tie breakers (oldest, newest, shortest-path, longest-path, shallowest, preferred, lexicographic)")
+	cmd.Flags().StringArray("prefer", nil, "Preferred path for the 'preferred' keep policy. Can be repeated, in order of preference")
+	cmd.Flags().String("link", "", "Combined with 'keep-policy', replaces the removed duplicates with links to the kept file (symlink, hardlink) instead of deleting them")
+	cmd.Flags().String("rules", "", "Resolves every group without prompting, as decided by the given rule file. See 'dedupe rules test' to check a rule file against a saved report")
+	cmd.Flags().Bool("verify", false, "Re-calculates the checksums of the kept file and the duplicate right before acting on it, instead of only checking their metadata")
+	cmd.Flags().Bool("rehash", false, "Combined with 'load-from', re-calculates the checksum of every file of the report to find the ones changed since it was saved, instead of only checking their size and modification time")
+	cmd.Flags().StringP("journal", "j", "", "Appends every action taken to the given journal file (JSON lines) instead of a new journal in $XDG_STATE_HOME/dedupe. Actions are always journaled so they can be reverted with 'dedupe undo'")
+	cmd.Flags().StringP("quarantine", "q", "", "Moves the duplicates to the given quarantine directory instead of deleting them. See 'dedupe quarantine' to list, restore or purge them")
+	cmd.Flags().Bool("trash", false, "Moves the duplicates to the trash of the current user (freedesktop.org) instead of deleting them, so they can be restored from a file manager")
+	cmd.Flags().BoolP("dry-run", "d", false, "Prints the actions that would be taken without taking them")
+}
+
+// readIOMode returns the validated value of the 'io-mode' flag of the command.
+func readIOMode(cmd *cobra.Command) dedupe.IOMode {
+	value, _ := cmd.Flags().GetString("io-mode")
+	ioMode, err := dedupe.ParseIOMode(value)
+	if err != nil {
+		log.Errorf("Invalid I/O mode. %s", err.Error())
+		os.Exit(-1)
+	}
+	return ioMode
+}
+
+// newScanCli creates a cli from the scan flags of the command.
+func newScanCli(cmd *cobra.Command) *cli {
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	algorithm, _ := cmd.Flags().GetString("algorithm")
+	memLimit, _ := cmd.Flags().GetString("memory-limit")
+	tempDir, _ := cmd.Flags().GetString("temp-dir")
+	walkers, _ := cmd.Flags().GetInt("walkers")
+	references, _ := cmd.Flags().GetStringArray("reference")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	memoryLimit, err := parseByteSize(memLimit)
+	if err != nil {
+		log.Errorf("Invalid memory limit. %s", err.Error())
+		os.Exit(-1)
+	}
+
+	return &cli{
+		Verbose:     verbose,
+		Recursive:   recursive,
+		Algorithm:   dedupe.HashMode(algorithm),
+		IOMode:      readIOMode(cmd),
+		MemoryLimit: memoryLimit,
+		TempDir:     tempDir,
+		Walkers:     walkers,
+		References:  references,
+	}
+}
+
+// readResolveFlags sets the resolution flags of the command to the cli, validating them.
+func readResolveFlags(cmd *cobra.Command, c *cli) {
+	keepPolicy, _ := cmd.Flags().GetString("keep-policy")
+	prefer, _ := cmd.Flags().GetStringArray("prefer")
+	link, _ := cmd.Flags().GetString("link")
+	rules, _ := cmd.Flags().GetString("rules")
+	verify, _ := cmd.Flags().GetBool("verify")
+	rehash, _ := cmd.Flags().GetBool("rehash")
+	journal, _ := cmd.Flags().GetString("journal")
+	quarantine, _ := cmd.Flags().GetString("quarantine")
+	trash, _ := cmd.Flags().GetBool("trash")
+	dryrun, _ := cmd.Flags().GetBool("dry-run")
+
+	c.Prefer = prefer
+	c.Link = link
+	c.Verify = verify
+	c.Rehash = rehash
+	c.Journal = journal
+	c.Quarantine = quarantine
+	c.Trash = trash
+	c.DryRun = dryrun
+
+	var err error
+	if keepPolicy != "" {
+		if c.Policies, err = dedupe.ParseKeepPolicies(keepPolicy); err != nil {
+			log.Errorf("Invalid keep policy. %s", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	if link != "" && link != linkSymbolic && link != linkHard {
+		log.Errorf("Invalid link type '%s', expected symlink or hardlink", link)
+		os.Exit(-1)
+	}
+
+	if trash && quarantine != "" {
+		log.Error("The 'trash' and 'quarantine' flags cannot be used together")
+		os.Exit(-1)
+	}
+
+	if rules != "" {
+		if c.Rules, err = dedupe.LoadRules(rules); err != nil {
+			log.Errorf("Invalid rules. %s", err.Error())
+			os.Exit(-1)
+		}
+	}
+}
+
+// readFormatFlag sets the output format of the command to the cli, validating it.
+func readFormatFlag(cmd *cobra.Command, c *cli) {
+	format, _ := cmd.Flags().GetString("format")
+	if format != formatText {
+		if _, err := dedupe.NewReportWriter(dedupe.ReportFormat(format)); err != nil {
+			log.Errorf("Invalid format. %s", err.Error())
+			os.Exit(-1)
+		}
+		progress = os.Stderr
+	}
+	c.Format = format
+}
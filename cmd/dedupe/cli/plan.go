@@ -0,0 +1,280 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// Plan writes a resolution plan for the groups of the report to the output file (or the standard output),
+// proposing for each group what the keep policies, or the rules if set, would do. If edit is set, the
+// plan is opened in the editor of the user afterwards.
+func (c *cli) Plan(report *dedupe.DupeReport, output string, edit bool) {
+	c.report = report
+	plan := &dedupe.Plan{Algorithm: c.Algorithm, Created: report.Created}
+	if plan.Created.IsZero() {
+		plan.Created = time.Now()
+	}
+	for _, r := range report.References {
+		plan.References = append(plan.References, absOrSelf(r))
+	}
+
+	var checksums []string
+	for k := range report.Dupes {
+		checksums = append(checksums, k)
+	}
+	sort.Strings(checksums)
+
+	for _, k := range checksums {
+		group, err := c.proposeGroup(k, report.Dupes[k])
+		if err != nil {
+			log.Warnf("Skipping group %s. %s", k, err.Error())
+			continue
+		}
+		plan.Groups = append(plan.Groups, group)
+	}
+
+	out := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Errorf("Unable to create plan file %s. %s", output, err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := dedupe.WritePlan(out, plan); err != nil {
+		log.Errorf("Unable to write plan. %s", err.Error())
+		os.Exit(1)
+	}
+	if output == "" {
+		return
+	}
+
+	fmt.Println(a.Green("Plan written to "), a.Cyan(output), a.Gray(12, fmt.Sprintf("(%d groups)", len(plan.Groups))))
+	if edit {
+		if err := openEditor(output); err != nil {
+			log.Errorf("Unable to open the editor. %s", err.Error())
+			os.Exit(1)
+		}
+	}
+	fmt.Println(a.Green("Apply it with: "), a.Bold("dedupe apply "+output))
+}
+
+// proposeGroup builds the planned actions for a group, with absolute paths so the plan can be applied
+// from any directory.
+func (c *cli) proposeGroup(checksum string, files []string) (*dedupe.PlanGroup, error) {
+	group := &dedupe.PlanGroup{Checksum: checksum, Size: -1}
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			group.Size = info.Size()
+			break
+		}
+	}
+	if group.Size < 0 {
+		return nil, fmt.Errorf("none of its files is available")
+	}
+
+	actions := map[string]dedupe.PlanAction{}
+
+	if c.Rules != nil {
+		decision, err := c.Rules.Decide(c.report, files)
+		if err != nil {
+			return nil, err
+		}
+		if decision.Err != nil {
+			return nil, decision.Err
+		}
+		for _, fd := range decision.Files {
+			actions[fd.Path] = planActionOf(fd.Action)
+		}
+	} else {
+		keep := ""
+		if refs, _ := c.report.SplitReferences(files); len(refs) > 0 {
+			keep = refs[0]
+		} else if sel, err := dedupe.SelectKeep(files, c.Prefer, c.Policies...); err != nil {
+			return nil, err
+		} else {
+			keep = sel.Keep
+		}
+
+		for _, f := range files {
+			switch {
+			case f == keep:
+				actions[f] = dedupe.PlanKeep
+			case c.report.IsReference(f):
+				actions[f] = dedupe.PlanSkip
+			case c.Link == linkHard:
+				actions[f] = dedupe.PlanHardlink
+			case c.Link == linkSymbolic:
+				actions[f] = dedupe.PlanSymlink
+			default:
+				actions[f] = dedupe.PlanDelete
+			}
+		}
+	}
+
+	for _, f := range files {
+		group.Entries = append(group.Entries, &dedupe.PlanEntry{Action: actions[f], Path: absOrSelf(f)})
+	}
+	return group, nil
+}
+
+func planActionOf(action dedupe.RuleAction) dedupe.PlanAction {
+	switch action {
+	case dedupe.RuleKeep:
+		return dedupe.PlanKeep
+	case dedupe.RuleDelete:
+		return dedupe.PlanDelete
+	case dedupe.RuleLink:
+		return dedupe.PlanSymlink
+	case dedupe.RuleHardlink:
+		return dedupe.PlanHardlink
+	default:
+		return dedupe.PlanSkip
+	}
+}
+
+// loadPlan reads a plan file, exiting on failure.
+func loadPlan(planFile string) *dedupe.Plan {
+	plan, err := dedupe.LoadPlan(planFile)
+	if err != nil {
+		log.Errorf("Invalid plan. %s", err.Error())
+		os.Exit(1)
+	}
+	return plan
+}
+
+// Apply executes a plan file. Each group is validated against the current state of its files first, and
+// groups that fail the validation are not touched at all. The references of the plan are combined with
+// the ones of the cli, so removing them from the plan does not lift their protection. Files modified after
+// the plan was created are refused, unless the plan has no creation time.
+func (c *cli) Apply(planFile string, verifyKeep bool) {
+	plan := loadPlan(planFile)
+
+	if plan.Algorithm != "" {
+		c.Algorithm = plan.Algorithm
+	}
+	c.since = plan.Created
+	c.References = planReferences(plan, c.References)
+
+	if c.Quarantine == "" {
+		for _, g := range plan.Groups {
+			for _, e := range g.Entries {
+				if e.Action == dedupe.PlanQuarantine {
+					log.Errorf("The plan quarantines files (line %d) but no quarantine directory was given", e.Line)
+					os.Exit(1)
+				}
+			}
+		}
+	}
+
+	refused := 0
+	for _, g := range plan.Groups {
+		fmt.Println()
+		fmt.Println(a.Green("Checksum:  "), a.Cyan(g.Checksum), a.Gray(12, fmt.Sprintf("[line %d]", g.Line)))
+
+		err := g.Validate(c.References, plan.Created)
+		if err == nil && verifyKeep {
+			err = g.VerifyKeep(c.Algorithm, c.IOMode)
+		}
+		if err != nil {
+			refused++
+			fmt.Println(a.Bold(a.Red("(refused) ")), err.Error())
+			continue
+		}
+
+		keep := g.Keep()
+		for _, e := range g.Entries {
+			switch e.Action {
+			case dedupe.PlanKeep:
+				fmt.Println(a.Bold(a.Green("(keep) ")), e.Path)
+			case dedupe.PlanSkip:
+				fmt.Println(a.Bold(a.Yellow("(skipped) ")), e.Path)
+			default:
+				c.resolve(dedupe.ActionType(e.Action), g.Checksum, keep, []string{e.Path})
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(a.Green("Groups:"), len(plan.Groups), a.Red("Refused:"), refused)
+	if c.freed > 0 {
+		fmt.Println(a.Green("Space freed:"), a.Cyan(formatBytes(c.freed)))
+	}
+	fmt.Println()
+	if refused > 0 {
+		os.Exit(1)
+	}
+}
+
+// Script writes a shell script performing the actions of the plan. Groups that fail the validation
+// against the current state of the files are left out.
+func (c *cli) Script(planFile, output string) {
+	plan := loadPlan(planFile)
+
+	valid := &dedupe.Plan{Algorithm: plan.Algorithm, Created: plan.Created, References: planReferences(plan, c.References)}
+	for _, g := range plan.Groups {
+		if err := g.Validate(valid.References, plan.Created); err != nil {
+			fmt.Println(a.Bold(a.Red("(refused) ")), a.Cyan(g.Checksum), a.Gray(12, fmt.Sprintf("[line %d]", g.Line)), err.Error())
+			continue
+		}
+		valid.Groups = append(valid.Groups, g)
+	}
+
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		log.Errorf("Unable to create script %s. %s", output, err.Error())
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	if err := dedupe.WriteScript(f, valid); err != nil {
+		log.Errorf("Unable to write script. %s", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(a.Green("Script written to "), a.Cyan(output), a.Gray(12, fmt.Sprintf("(%d of %d groups)", len(valid.Groups), len(plan.Groups))))
+}
+
+// planReferences returns the references of the plan along with the given ones, as absolute paths.
+func planReferences(plan *dedupe.Plan, references []string) []string {
+	var ret []string
+	for _, r := range append(append([]string{}, plan.References...), references...) {
+		ret = append(ret, absOrSelf(r))
+	}
+	return ret
+}
+
+// openEditor opens the file in $VISUAL or $EDITOR (vi if neither is set) and waits for it to exit.
+func openEditor(file string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	args := append(strings.Fields(editor), file)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func absOrSelf(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan [paths...]",
+	Short: "writes an editable resolution plan for the duplicates found in the given paths",
+	Long: `Finds the duplicates in the given paths (or loads a saved report) and writes a plan listing every
+group with the proposed action for each file, as decided by the keep policies or the rules. The plan can be
+edited by hand and executed afterwards with 'dedupe apply'.`,
+	Args: cobra.ArbitraryArgs,
+	Run:  runPlan,
+}
+
+func init() {
+	planCmd.Flags().StringP("output", "o", "", "File the plan is written to. Defaults to the standard output")
+	planCmd.Flags().BoolP("edit", "e", false, "Opens the plan in $EDITOR once written. Requires 'output'")
+	planCmd.Flags().StringP("load-from", "l", "", "Plans the groups of a saved report instead of scanning")
+	addScanFlags(planCmd)
+	planCmd.Flags().String("keep-policy", "", "Policies picking the file to keep in each group, as a comma separated list of tie breakers. Defaults to lexicographic")
+	planCmd.Flags().StringArray("prefer", nil, "Preferred path for the 'preferred' keep policy. Can be repeated, in order of preference")
+	planCmd.Flags().String("link", "", "Proposes replacing the duplicates with links to the kept file (symlink, hardlink) instead of deleting them")
+	planCmd.Flags().String("rules", "", "Proposes the actions decided by the given rule file instead of the keep policies")
+	rootCmd.AddCommand(planCmd)
+}
+
+func runPlan(cmd *cobra.Command, args []string) {
+	output, _ := cmd.Flags().GetString("output")
+	edit, _ := cmd.Flags().GetBool("edit")
+	load, _ := cmd.Flags().GetString("load-from")
+
+	if !validate(args) && load == "" {
+		log.Error("No starting path or report provided")
+		cmd.Usage()
+		os.Exit(-1)
+	}
+	if edit && output == "" {
+		log.Error("The 'edit' flag requires an output file")
+		os.Exit(-1)
+	}
+	if output == "" {
+		progress = os.Stderr
+	}
+
+	c := newScanCli(cmd)
+	readResolveFlags(cmd, c)
+
+	var report *dedupe.DupeReport
+	if load != "" {
+		var err error
+		if report, err = dedupe.LoadReport(load); err != nil {
+			log.Errorf("Unable to load report. %s", err.Error())
+			os.Exit(1)
+		}
+		if report.Algorithm != "" {
+			c.Algorithm = report.Algorithm
+		}
+		c.revalidate(report)
+	} else {
+		report = c.scan(args...)
+	}
+	c.Plan(report, output, edit)
+}
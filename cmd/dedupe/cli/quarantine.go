@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// QuarantineList prints the files currently held in the quarantine directory.
+func (c *cli) QuarantineList(dir string) {
+	q, entries := openQuarantine(dir)
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+		fmt.Println(a.Gray(12, e.Time.Format(time.RFC3339)), e.Original, a.Gray(12, formatBytes(e.Size)))
+	}
+	fmt.Println()
+	fmt.Println(a.Green("Quarantine:"), a.Cyan(q.Dir()))
+	fmt.Println(a.Green("Entries:   "), len(entries), a.Gray(12, formatBytes(total)))
+}
+
+// QuarantineRestore moves back to their original location the quarantined files under any of the given
+// paths, or all of them if no path is given.
+func (c *cli) QuarantineRestore(dir string, paths []string) {
+	q, entries := openQuarantine(dir)
+
+	for i, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			paths[i] = abs
+		}
+	}
+
+	var selected []*dedupe.QuarantineEntry
+	for _, e := range entries {
+		if len(paths) == 0 || dedupe.IsUnder(e.Original, paths...) {
+			selected = append(selected, e)
+		}
+	}
+
+	if c.DryRun {
+		for _, e := range selected {
+			fmt.Println(a.Bold(a.Magenta("(to restore) ")), e.Original)
+		}
+		return
+	}
+
+	restored, err := q.Restore(selected)
+	for _, e := range restored {
+		fmt.Println(a.Bold(a.Green("(restored) ")), e.Original)
+	}
+	if err != nil {
+		log.Errorf("Unable to restore some files. %s", err.Error())
+		os.Exit(1)
+	}
+}
+
+// QuarantinePurge permanently deletes the quarantined files older than the given age.
+func (c *cli) QuarantinePurge(dir string, olderThan time.Duration) {
+	q, entries := openQuarantine(dir)
+
+	var selected []*dedupe.QuarantineEntry
+	for _, e := range entries {
+		if time.Since(e.Time) >= olderThan {
+			selected = append(selected, e)
+		}
+	}
+
+	if c.DryRun {
+		for _, e := range selected {
+			fmt.Println(a.Bold(a.Magenta("(to purge) ")), e.Original)
+		}
+		return
+	}
+
+	purged, err := q.Purge(selected)
+	var freed int64
+	for _, e := range purged {
+		freed += e.Size
+		fmt.Println(a.Bold(a.Red("(purged) ")), e.Original)
+	}
+	fmt.Println()
+	fmt.Println(a.Green("Space freed:"), a.Cyan(formatBytes(freed)))
+	if err != nil {
+		log.Errorf("Unable to purge some files. %s", err.Error())
+		os.Exit(1)
+	}
+}
+
+func openQuarantine(dir string) (*dedupe.Quarantine, []*dedupe.QuarantineEntry) {
+	if _, err := os.Stat(dir); err != nil {
+		log.Errorf("Unable to open the quarantine. %s", err.Error())
+		os.Exit(1)
+	}
+	q, err := dedupe.OpenQuarantine(dir, "")
+	if err != nil {
+		log.Errorf("Unable to open the quarantine. %s", err.Error())
+		os.Exit(1)
+	}
+	entries, err := q.Entries()
+	if err != nil {
+		log.Errorf("Unable to read the quarantine. %s", err.Error())
+		os.Exit(1)
+	}
+	return q, entries
+}
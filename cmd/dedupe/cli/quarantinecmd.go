@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "lists, restores or purges the files moved to a quarantine directory with '--quarantine'",
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list DIR",
+	Short: "lists the files held in the quarantine directory",
+	Args:  cobra.ExactArgs(1),
+	Run:   runQuarantineList,
+}
+
+var quarantineRestoreCmd = &cobra.Command{
+	Use:   "restore DIR [paths...]",
+	Short: "moves quarantined files back to their original location",
+	Long: `Moves the quarantined files back to their original location. If paths are given, only the files
+originally under them are restored, otherwise all of them are. Files whose original path is taken are
+left in quarantine.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runQuarantineRestore,
+}
+
+var quarantinePurgeCmd = &cobra.Command{
+	Use:   "purge DIR",
+	Short: "permanently deletes quarantined files older than the given number of days",
+	Args:  cobra.ExactArgs(1),
+	Run:   runQuarantinePurge,
+}
+
+func init() {
+	quarantineRestoreCmd.Flags().BoolP("dry-run", "d", false, "Prints the files that would be restored without taking any actions")
+	quarantinePurgeCmd.Flags().Int("older-than", -1, "Purges the entries quarantined at least this number of days ago. 0 purges all of them")
+	quarantinePurgeCmd.Flags().BoolP("dry-run", "d", false, "Prints the files that would be purged without taking any actions")
+
+	quarantineCmd.AddCommand(quarantineListCmd, quarantineRestoreCmd, quarantinePurgeCmd)
+	rootCmd.AddCommand(quarantineCmd)
+}
+
+func runQuarantineList(cmd *cobra.Command, args []string) {
+	c := &cli{}
+	c.QuarantineList(args[0])
+}
+
+func runQuarantineRestore(cmd *cobra.Command, args []string) {
+	dryrun, _ := cmd.Flags().GetBool("dry-run")
+
+	c := &cli{DryRun: dryrun}
+	c.QuarantineRestore(args[0], args[1:])
+}
+
+func runQuarantinePurge(cmd *cobra.Command, args []string) {
+	olderThan, _ := cmd.Flags().GetInt("older-than")
+	dryrun, _ := cmd.Flags().GetBool("dry-run")
+
+	if olderThan < 0 {
+		log.Error("The age of the entries to purge is required, use '--older-than'")
+		os.Exit(-1)
+	}
+
+	c := &cli{DryRun: dryrun}
+	c.QuarantinePurge(args[0], time.Duration(olderThan)*24*time.Hour)
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// mappingPrefix starts the name of the mapping files written by default, which are never renamed.
+const mappingPrefix = ".dedupe-rename-"
+
+// Rename renames the files in the given paths to their hash, and writes the old and new names to the
+// mapping file, or to a new one in the target directory or the first path if empty. The mapping is
+// written on dry runs as well, so the planned names can be reviewed.
+func (c *cli) Rename(paths []string, opts *dedupe.RenameOptions, mapping string) {
+	opts.Mode = c.Algorithm
+	opts.IOMode = c.IOMode
+	opts.DryRun = c.DryRun
+
+	if opts.Target != "" && !c.DryRun {
+		if err := os.MkdirAll(opts.Target, 0755); err != nil {
+			log.Errorf("Unable to create target directory %s. %s", opts.Target, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if mapping == "" {
+		mapping = defaultMapping(paths, opts.Target, c.DryRun)
+	}
+
+	files, errs := c.listFiles(paths)
+	for _, err := range errs {
+		fmt.Println(a.Red("Unable to read "), err.Error())
+	}
+	files = withoutMappings(files, mapping)
+
+	// The mapping is created before any file is renamed, so no rename goes unrecorded if it cannot be.
+	out, err := os.Create(mapping)
+	if err != nil {
+		log.Errorf("Unable to create mapping file. %s", err.Error())
+		os.Exit(1)
+	}
+
+	renamer := dedupe.NewRenamer(opts)
+	var results []*dedupe.RenameResult
+	counts := map[dedupe.RenameStatus]int{}
+
+	for _, f := range files {
+		res := renamer.Rename(f)
+		results = append(results, res)
+		counts[res.Status]++
+		printRename(res, c.DryRun)
+	}
+
+	if err := writeMapping(out, results); err != nil {
+		log.Errorf("Unable to write mapping file %s. %s", mapping, err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Println()
+	fmt.Println(a.Green("Renamed:   "), counts[dedupe.RenameDone])
+	fmt.Println(a.Green("Unchanged: "), counts[dedupe.RenameUnchanged])
+	fmt.Println(a.Yellow("Duplicates:"), counts[dedupe.RenameDuplicate])
+	fmt.Println(a.Red("Failed:    "), counts[dedupe.RenameFailed])
+	fmt.Println(a.Green("Mapping:   "), a.Cyan(mapping))
+
+	if counts[dedupe.RenameFailed]+len(errs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// listFiles returns the regular files in the given paths, sorted, descending into subdirectories if the
+// cli is recursive.
+func (c *cli) listFiles(paths []string) ([]string, []error) {
+	var files []string
+	var errs []error
+
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && !c.Recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	sort.Strings(files)
+	return files, errs
+}
+
+func printRename(res *dedupe.RenameResult, dryRun bool) {
+	switch {
+	case res.Status == dedupe.RenameFailed:
+		fmt.Println(a.Red("Unable to rename file "), res.From)
+		fmt.Println(a.Red("    "), res.Err.Error())
+	case res.Status == dedupe.RenameUnchanged:
+		fmt.Println(a.Bold(a.Gray(12, "(unchanged) ")), res.From)
+	case res.Status == dedupe.RenameDuplicate:
+		fmt.Println(a.Bold(a.Yellow("(duplicate) ")), res.From, a.Gray(12, "same contents as "+res.To))
+	case dryRun:
+		fmt.Println(a.Bold(a.Magenta("(to rename) ")), res.From, " > ", res.To)
+	default:
+		fmt.Println(a.Bold(a.Green("(renamed) ")), res.From, " > ", res.To)
+	}
+}
+
+// defaultMapping returns a new mapping file in the target directory, or in the first path when renaming in
+// place or when the target is not created yet on a dry run.
+func defaultMapping(paths []string, target string, dryRun bool) string {
+	dir := target
+	if _, err := os.Stat(target); target == "" || (dryRun && err != nil) {
+		dir = paths[0]
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+	}
+	name := mappingPrefix + time.Now().Format("20060102-150405")
+	if dryRun {
+		name += ".dry-run"
+	}
+	return filepath.Join(dir, name+".csv")
+}
+
+// withoutMappings removes the mapping file and the ones written by previous runs from the files, so they
+// keep their names.
+func withoutMappings(files []string, mapping string) []string {
+	var ret []string
+	for _, f := range files {
+		name := filepath.Base(f)
+		if absOrSelf(f) == absOrSelf(mapping) || (strings.HasPrefix(name, mappingPrefix) && filepath.Ext(name) == ".csv") {
+			continue
+		}
+		ret = append(ret, f)
+	}
+	return ret
+}
+
+func writeMapping(f *os.File, results []*dedupe.RenameResult) error {
+	if err := dedupe.WriteRenameMapping(f, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
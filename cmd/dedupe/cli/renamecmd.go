@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename PATH [paths...]",
+	Short: "renames files to the hash of their contents",
+	Long: `Renames every file in the given paths to '<hash>.<ext>', in its own directory or moved into the
+directory given with '--to'. Files with the same contents map to the same name: by default the first one
+in lexicographic order gets it and the others are left in place, with '--duplicates suffix' they are
+renamed to '<hash>-N.<ext>' instead. A file whose hash name is taken by a file with different contents is
+never overwritten.
+
+The old and the new name of every file are written as CSV to the file given with '--mapping', or to a new
+'.dedupe-rename-<time>.csv' in the target directory or the first path, on dry runs as well (with a
+'.dry-run.csv' extension). Mapping files are never renamed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runRename,
+}
+
+func init() {
+	renameCmd.Flags().BoolP("recursive", "r", false, "Renames the files in the subdirectories as well")
+	renameCmd.Flags().StringP("algorithm", "a", string(dedupe.HashSHA256), "Indicates the hashing algorithm to use for checksums (md5, sha256). Default is sha256")
+	renameCmd.Flags().String("io-mode", string(dedupe.IOBuffered), "Indicates how files are read while hashing (buffered, nocache, direct)")
+	renameCmd.Flags().String("to", "", "Moves the renamed files into the given directory instead of renaming them in place")
+	renameCmd.Flags().String("duplicates", string(dedupe.DuplicateSkip), "What to do with the files whose contents already have a file with their hash name (skip, suffix)")
+	renameCmd.Flags().StringP("mapping", "m", "", "Writes the old and new name of every file to the given CSV file instead of a new one in the target directory or the first path")
+	renameCmd.Flags().BoolP("dry-run", "d", false, "Prints the new names without renaming any file")
+	rootCmd.AddCommand(renameCmd)
+}
+
+func runRename(cmd *cobra.Command, args []string) {
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	algorithm, _ := cmd.Flags().GetString("algorithm")
+	to, _ := cmd.Flags().GetString("to")
+	duplicates, _ := cmd.Flags().GetString("duplicates")
+	mapping, _ := cmd.Flags().GetString("mapping")
+	dryrun, _ := cmd.Flags().GetBool("dry-run")
+
+	mode, err := dedupe.ParseDuplicateMode(duplicates)
+	if err != nil {
+		log.Errorf("Invalid duplicates mode. %s", err.Error())
+		os.Exit(-1)
+	}
+
+	c := &cli{
+		Recursive: recursive,
+		Algorithm: dedupe.HashMode(algorithm),
+		IOMode:    readIOMode(cmd),
+		DryRun:    dryrun,
+	}
+	c.Rename(args, &dedupe.RenameOptions{Target: to, Duplicates: mode}, mapping)
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// MergeReports unites the given reports and saves the result to the output file, or writes it to the
+// standard output in the format of the cli if no output file is given.
+func (c *cli) MergeReports(files []string, output string) {
+	var reports []*dedupe.DupeReport
+	for _, f := range files {
+		reports = append(reports, loadReport(f))
+	}
+
+	merged, err := dedupe.MergeReports(reports...)
+	if err != nil {
+		log.Errorf("Unable to merge reports. %s", err.Error())
+		os.Exit(1)
+	}
+
+	if output == "" {
+		c.writeReport(merged)
+		return
+	}
+	if err := dedupe.SaveReport(output, merged); err != nil {
+		log.Errorf("Unable to save report. %s", err.Error())
+		os.Exit(1)
+	}
+
+	state := merged.Progress()
+	fmt.Println(a.Green("Merged report saved to "), a.Cyan(output), a.Gray(12, fmt.Sprintf("(%d groups, %s reclaimable)", state.Groups, formatBytes(state.PendingBytes))))
+}
+
+// DiffReports prints what changed between two reports.
+func (c *cli) DiffReports(from, to string) {
+	diff, err := dedupe.DiffReports(loadReport(from), loadReport(to))
+	if err != nil {
+		log.Errorf("Unable to compare reports. %s", err.Error())
+		os.Exit(1)
+	}
+
+	if len(diff.Groups) == 0 {
+		fmt.Println(a.Green("No changes."))
+		return
+	}
+
+	for _, g := range diff.Groups {
+		fmt.Println(changeLabel(g.Change), a.Cyan(g.Checksum), a.Gray(12, describeGroupDiff(g)), formatDelta(g.Delta))
+		if !c.Verbose {
+			continue
+		}
+		for _, f := range g.Added {
+			fmt.Println(a.Green("    + "), f)
+		}
+		for _, f := range g.Removed {
+			fmt.Println(a.Red("    - "), f)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(a.Cyan("New:     "), diff.Count(dedupe.GroupNew))
+	fmt.Println(a.Cyan("Resolved:"), diff.Count(dedupe.GroupResolved))
+	fmt.Println(a.Cyan("Grown:   "), diff.Count(dedupe.GroupGrown))
+	fmt.Println(a.Cyan("Shrunk:  "), diff.Count(dedupe.GroupShrunk))
+	fmt.Println(a.Cyan("Moved:   "), diff.Count(dedupe.GroupMoved))
+	fmt.Println(a.Bold(a.Cyan("Reclaimable:")), formatDelta(diff.Delta))
+}
+
+// QueryReport writes the groups of the report selected by the query in the format of the cli, or saves
+// them to the output file if given.
+func (c *cli) QueryReport(file string, query *dedupe.ReportQuery, output string) {
+	result, err := query.Apply(loadReport(file))
+	if err != nil {
+		log.Errorf("Unable to query report. %s", err.Error())
+		os.Exit(1)
+	}
+
+	if output != "" {
+		if err := dedupe.SaveReport(output, result); err != nil {
+			log.Errorf("Unable to save report. %s", err.Error())
+			os.Exit(1)
+		}
+		state := result.Progress()
+		fmt.Println(a.Green("Selected groups saved to "), a.Cyan(output), a.Gray(12, fmt.Sprintf("(%d groups, %s reclaimable)", state.Groups, formatBytes(state.PendingBytes))))
+		return
+	}
+
+	if c.Format != formatText {
+		c.writeReport(result)
+		return
+	}
+
+	var total int64
+	groups := result.Groups()
+	for _, g := range groups {
+		total += g.Reclaimable()
+		fmt.Println(a.Cyan(g.Checksum), a.Gray(12, fmt.Sprintf("%d copies of %s, %s reclaimable", len(g.Files), formatBytes(g.Size), formatBytes(g.Reclaimable()))))
+		for _, f := range g.Files {
+			fmt.Println(a.Gray(12, "  - "), f)
+		}
+	}
+	fmt.Println()
+	fmt.Println(a.Green("Groups:     "), len(groups))
+	fmt.Println(a.Green("Reclaimable:"), formatBytes(total))
+}
+
+func loadReport(file string) *dedupe.DupeReport {
+	report, err := dedupe.LoadReport(file)
+	if err != nil {
+		log.Errorf("Unable to load report. %s", err.Error())
+		os.Exit(1)
+	}
+	return report
+}
+
+func changeLabel(change dedupe.GroupChange) a.Value {
+	label := fmt.Sprintf("%-10s", "("+string(change)+")")
+	switch change {
+	case dedupe.GroupNew, dedupe.GroupGrown:
+		return a.Bold(a.Red(label))
+	case dedupe.GroupResolved, dedupe.GroupShrunk:
+		return a.Bold(a.Green(label))
+	default:
+		return a.Bold(a.Yellow(label))
+	}
+}
+
+func describeGroupDiff(g *dedupe.GroupDiff) string {
+	size := formatBytes(g.Size)
+	if g.Size < 0 {
+		size = "unknown size"
+	}
+	switch g.Change {
+	case dedupe.GroupNew:
+		return fmt.Sprintf("%d copies of %s", len(g.Added), size)
+	case dedupe.GroupResolved:
+		return fmt.Sprintf("%d copies of %s", len(g.Removed), size)
+	default:
+		return fmt.Sprintf("%d added, %d removed, %s each", len(g.Added), len(g.Removed), size)
+	}
+}
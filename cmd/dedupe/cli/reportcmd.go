@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "tools to combine, compare and query saved reports",
+}
+
+var reportMergeCmd = &cobra.Command{
+	Use:   "merge REPORT REPORT [reports...]",
+	Short: "combines saved reports into one, uniting their groups by checksum",
+	Long: `Combines saved reports, e.g. the scans of different shares, into one. Groups with the same checksum
+are united, and the roots and errors of all the reports are kept. The reports must have been calculated
+with the same algorithm.`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  runReportMerge,
+}
+
+var reportDiffCmd = &cobra.Command{
+	Use:   "diff OLD NEW",
+	Short: "lists the groups that are new, resolved, grown or shrunk between two saved reports",
+	Long: `Compares two saved reports, e.g. last month's scan and today's, and lists the new groups, the
+resolved groups, and the groups whose number of copies grew or shrunk, with the change in reclaimable
+bytes of each of them and of the whole report.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runReportDiff,
+}
+
+var reportQueryCmd = &cobra.Command{
+	Use:   "query REPORT",
+	Short: "filters and sorts the groups of a saved report",
+	Long: `Selects and orders the groups of a saved report without rescanning, and writes them in any of the
+supported formats. The filter and the sort keys are expressions in the language of the rule files, e.g.
+
+  dedupe report query report.json --where 'wasted > 100MB'
+  dedupe report query report.json --where 'under("/projects") and ext == "mov"'
+  dedupe report query report.json --sort -wasted --limit 50
+
+A group is selected if any of its files matches the filter. Besides the attributes of the rule files,
+'wasted' is the space that can be reclaimed from the group. Sort keys prefixed by '-' are descending.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runReportQuery,
+}
+
+func init() {
+	reportMergeCmd.Flags().StringP("output", "o", "", "Saves the merged report to the given file instead of writing it to the standard output")
+	reportMergeCmd.Flags().StringP("format", "f", string(dedupe.FormatJSON), "Output format of the merged report when written to the standard output (json, ndjson, csv, nul, fdupes, html)")
+	reportDiffCmd.Flags().BoolP("verbose", "v", false, "Lists the files added to or removed from each group")
+	reportQueryCmd.Flags().StringP("where", "w", "", "Only selects the groups with a file matching the given expression")
+	reportQueryCmd.Flags().StringArrayP("sort", "s", nil, "Sorts the groups by the given expression, descending if prefixed by '-'. Can be repeated, in order of priority. Defaults to the reclaimable space")
+	reportQueryCmd.Flags().IntP("limit", "n", 0, "Only keeps the given number of groups")
+	reportQueryCmd.Flags().StringP("format", "f", formatText, "Output format: text, or one of json, ndjson, csv, nul, fdupes and html")
+	reportQueryCmd.Flags().StringP("output", "o", "", "Saves the selected groups as a report to the given file, e.g. to resolve them with '--load-from'")
+
+	reportCmd.AddCommand(reportMergeCmd, reportDiffCmd, reportQueryCmd)
+	rootCmd.AddCommand(reportCmd)
+}
+
+func runReportMerge(cmd *cobra.Command, args []string) {
+	output, _ := cmd.Flags().GetString("output")
+	format, _ := cmd.Flags().GetString("format")
+
+	if _, err := dedupe.NewReportWriter(dedupe.ReportFormat(format)); err != nil {
+		log.Errorf("Invalid format. %s", err.Error())
+		os.Exit(-1)
+	}
+
+	c := &cli{Format: format}
+	c.MergeReports(args, output)
+}
+
+func runReportDiff(cmd *cobra.Command, args []string) {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	c := &cli{Verbose: verbose}
+	c.DiffReports(args[0], args[1])
+}
+
+func runReportQuery(cmd *cobra.Command, args []string) {
+	where, _ := cmd.Flags().GetString("where")
+	sorts, _ := cmd.Flags().GetStringArray("sort")
+	limit, _ := cmd.Flags().GetInt("limit")
+	format, _ := cmd.Flags().GetString("format")
+	output, _ := cmd.Flags().GetString("output")
+
+	if format != formatText {
+		if _, err := dedupe.NewReportWriter(dedupe.ReportFormat(format)); err != nil {
+			log.Errorf("Invalid format. %s", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	query, err := dedupe.NewReportQuery(where, sorts, limit)
+	if err != nil {
+		log.Errorf("Invalid query. %s", err.Error())
+		os.Exit(-1)
+	}
+
+	c := &cli{Format: format}
+	c.QueryReport(args[0], query, output)
+}
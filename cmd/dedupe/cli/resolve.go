@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/dedupe/shutdown"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// resolve applies the given action to each of the files of a group, keeping 'keep'. Every action is
+// re-validated against the current state of the files before it is applied.
+func (c *cli) resolve(t dedupe.ActionType, checksum, keep string, files []string) {
+	if c.resolver == nil {
+		opts := &dedupe.ResolverOptions{
+			Mode:       c.Algorithm,
+			IOMode:     c.IOMode,
+			Rehash:     c.Verify,
+			DryRun:     c.DryRun,
+			References: c.references(),
+		}
+		if c.report != nil {
+			opts.Since = c.report.Created
+		} else {
+			opts.Since = c.since
+		}
+		if !c.DryRun {
+			if c.Journal == "" {
+				c.Journal = defaultJournal()
+			}
+			journal, err := dedupe.OpenJournal(c.Journal, c.Algorithm)
+			if err != nil {
+				log.Errorf("Unable to open the journal, no action will be taken. %s", err.Error())
+				os.Exit(1)
+			}
+			shutdown.AddShutdownHook(journal.Close)
+			opts.Journal = journal
+			fmt.Fprintln(progress, a.Gray(12, "Journaling every action to "+c.Journal+", revert them with 'dedupe undo'"))
+		}
+		if c.Quarantine != "" {
+			q, err := dedupe.OpenQuarantine(c.Quarantine, c.Algorithm)
+			if err != nil {
+				log.Errorf("Unable to open the quarantine, no action will be taken. %s", err.Error())
+				os.Exit(1)
+			}
+			opts.Quarantine = q
+		}
+		c.resolver = dedupe.NewResolver()
+		c.resolver.SetOptions(opts)
+	}
+
+	if t == dedupe.ActionDelete && c.Quarantine != "" {
+		t = dedupe.ActionQuarantine
+	} else if t == dedupe.ActionDelete && c.Trash {
+		t = dedupe.ActionTrash
+	}
+
+	if t == dedupe.ActionDelete && keep == "" && len(files) > 0 {
+		log.Warn("No copy of the group is kept, the deleted files cannot be restored with 'dedupe undo'")
+	}
+
+	for _, f := range files {
+		result := c.resolver.Apply(&dedupe.Action{
+			Type:     t,
+			Keep:     keep,
+			Target:   f,
+			Checksum: checksum,
+		})
+		c.printResult(result)
+		c.freed += result.Freed
+		if c.group != nil && !result.DryRun {
+			c.group.Add(result)
+		}
+	}
+}
+
+// defaultJournal returns a new journal file in the state directory of the user
+// ($XDG_STATE_HOME/dedupe, ~/.local/state/dedupe by default), named after the current time.
+func defaultJournal() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Errorf("Unable to find the home directory for the journal, use '--journal' to set one. %s", err.Error())
+			os.Exit(1)
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	dir = filepath.Join(dir, "dedupe")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Errorf("Unable to create the journal directory, use '--journal' to set one. %s", err.Error())
+		os.Exit(1)
+	}
+	return filepath.Join(dir, "journal-"+time.Now().Format("20060102-150405")+".jsonl")
+}
+
+func (c *cli) references() []string {
+	if c.report != nil {
+		return c.report.References
+	}
+	return c.References
+}
+
+func (c *cli) printResult(result *dedupe.ActionResult) {
+	action := result.Action
+
+	if result.Err != nil {
+		fmt.Println(a.Red(fmt.Sprintf("Unable to %s file ", action.Type)), action.Target)
+		fmt.Println(a.Red("    "), result.Err.Error())
+		return
+	}
+
+	switch {
+	case result.DryRun && action.Type == dedupe.ActionDelete:
+		fmt.Println(a.Bold(a.Magenta("(to delete) ")), action.Target)
+	case result.DryRun && action.Type == dedupe.ActionQuarantine:
+		fmt.Println(a.Bold(a.Magenta("(to quarantine) ")), action.Target)
+	case result.DryRun && action.Type == dedupe.ActionTrash:
+		fmt.Println(a.Bold(a.Magenta("(to trash) ")), action.Target)
+	case result.DryRun:
+		fmt.Println(a.Bold(a.Green(fmt.Sprintf("(%s to be created) ", action.Type))), action.Target, " > ", action.Keep)
+	case action.Type == dedupe.ActionDelete:
+		fmt.Println(a.Bold(a.Red("(deleted) ")), action.Target)
+	case action.Type == dedupe.ActionQuarantine:
+		fmt.Println(a.Bold(a.Yellow("(quarantined) ")), action.Target)
+	case action.Type == dedupe.ActionTrash:
+		fmt.Println(a.Bold(a.Yellow("(trashed) ")), action.Target)
+	default:
+		fmt.Println(a.Bold(a.Green(fmt.Sprintf("(%s) ", action.Type))), action.Target, " > ", action.Keep, a.Gray(12, "freed "+formatBytes(result.Freed)))
+	}
+}
+
+// Undo reverts the actions recorded in the given journal, most recent first.
+func (c *cli) Undo(journalFile string) {
+	entries, err := dedupe.ReadJournal(journalFile)
+	if err != nil {
+		log.Errorf("Unable to read journal. %s", err.Error())
+		os.Exit(1)
+	}
+
+	failed := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !e.Applied() {
+			fmt.Println(a.Bold(a.Gray(12, "(not applied) ")), e.Target, a.Gray(12, fmt.Sprintf("[%s failed, %s]", e.Action, e.Error)))
+			continue
+		}
+		from := e.Keep
+		if e.Location != "" {
+			from = e.Location
+		}
+		if c.DryRun {
+			fmt.Println(a.Bold(a.Magenta("(to restore) ")), e.Target, a.Gray(12, fmt.Sprintf("[%s, from %s]", e.Action, from)))
+			continue
+		}
+		if err := dedupe.Undo(e); err != nil {
+			failed++
+			fmt.Println(a.Red("Unable to restore file "), e.Target)
+			fmt.Println(a.Red("    "), err.Error())
+			continue
+		}
+		fmt.Println(a.Bold(a.Green("(restored) ")), e.Target, a.Gray(12, fmt.Sprintf("[%s, from %s]", e.Action, from)))
+	}
+
+	fmt.Println()
+	fmt.Println(a.Green("Entries:"), len(entries), a.Red("Failed:"), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
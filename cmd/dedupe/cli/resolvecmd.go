@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/jucardi/dedupe/shutdown"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve [paths...]",
+	Short: "finds the duplicates in the given paths and removes or links them",
+	Long: `Finds the duplicates in the given paths, or loads a saved report with '--load-from', and resolves
+each group: by asking which file to keep, or without prompting as decided by '--keep-policy' or '--rules'.
+The duplicates are deleted, moved to a quarantine or the trash, or replaced by links to the kept file.
+
+With '--save-to', the resolution of every group is recorded as it happens, so an interrupted session can
+be resumed with '--load-from'. Loaded reports are checked against the file system first, and files that
+were moved or modified since are left untouched.`,
+	Args: cobra.ArbitraryArgs,
+	Run:  runResolve,
+}
+
+func init() {
+	addScanFlags(resolveCmd)
+	addResolveFlags(resolveCmd)
+	resolveCmd.Flags().StringP("load-from", "l", "", "Resolves the groups of a saved report instead of scanning, skipping the ones already resolved")
+	resolveCmd.Flags().StringP("save-to", "s", "", "Saves the report and the resolution of each group to the given file. Defaults to the loaded report")
+	rootCmd.AddCommand(resolveCmd)
+}
+
+func runResolve(cmd *cobra.Command, args []string) {
+	load, _ := cmd.Flags().GetString("load-from")
+	save, _ := cmd.Flags().GetString("save-to")
+
+	if !validate(args) && load == "" {
+		log.Error("No starting path or progress file provided")
+		cmd.Usage()
+		os.Exit(-1)
+	}
+
+	shutdown.ListenForSignals()
+	log.Info("Listening for shutdown signals")
+
+	c := newScanCli(cmd)
+	readResolveFlags(cmd, c)
+	c.KeepOne = !c.unattended()
+	c.SaveTo = save
+
+	if load != "" {
+		if save == "" {
+			c.SaveTo = load
+		}
+		c.Load(load)
+	} else {
+		c.Start(args...)
+	}
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/spf13/cobra"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore STORE TARGET [roots...]",
+	Short: "rebuilds trees exported with 'dedupe export' from the store",
+	Long: `Rebuilds the trees exported to the store into the target directory, with their original mode and
+modification times. If roots are given, only the files originally under them are restored, otherwise all
+of them are. A single tree is restored directly into the target directory, several trees each into a
+subdirectory named after it. Existing files are never overwritten.`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  runRestore,
+}
+
+func init() {
+	restoreCmd.Flags().String("io-mode", string(dedupe.IOBuffered), "Indicates how files are read while verifying them (buffered, nocache, direct)")
+	restoreCmd.Flags().BoolP("dry-run", "d", false, "Prints the files that would be restored without taking any actions")
+	restoreCmd.Flags().BoolP("verbose", "v", false, "Prints every file restored")
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func runRestore(cmd *cobra.Command, args []string) {
+	dryrun, _ := cmd.Flags().GetBool("dry-run")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	c := &cli{
+		Verbose: verbose,
+		IOMode:  readIOMode(cmd),
+		DryRun:  dryrun,
+	}
+	c.Restore(args[0], args[1], args[2:])
+}
@@ -5,76 +5,77 @@ import (
 	"os"
 
 	"github.com/jucardi/dedupe/cmd/dedupe/version"
-	"github.com/jucardi/dedupe/dedupe"
 	"github.com/jucardi/dedupe/shutdown"
 	"github.com/jucardi/go-logger-lib/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-const (
-	usage = `%s -r -a md5 .`
-	long  = `
+const long = `
 Dedupe - Duplicates finder
     Version: V-%s
     Built: %s
+
+Finds files with identical contents with 'dedupe scan', and removes or links the duplicates with
+'dedupe resolve'. Saved reports can be combined, compared and queried with 'dedupe report'.
 `
-)
 
 var rootCmd = &cobra.Command{
-	Use:              "dedupe",
-	Short:            "finds duplicates in the given path",
-	Long:             fmt.Sprintf(long, version.Version, version.Built),
-	PersistentPreRun: initCmd,
-	Run:              run,
+	Use:   "dedupe",
+	Short: "finds duplicates in the given path",
+	Long:  fmt.Sprintf(long, version.Version, version.Built),
+	Args:  cobra.ArbitraryArgs,
+	Run:   runLegacy,
 }
 
 // Execute starts the execution of the run command.
 func Execute() {
+	// The flags of the versions before the subcommands, kept hidden so 'dedupe -r -a md5 .' still works.
+	addScanFlags(rootCmd)
+	addResolveFlags(rootCmd)
 	rootCmd.Flags().StringP("save-to", "s", "", "If provided, it will save the progress of the report and their resolution")
 	rootCmd.Flags().StringP("load-from", "l", "", "If provided, loads a previous progress to continue promting for resolution of duplicates")
-	rootCmd.Flags().StringP("algorithm", "a", string(dedupe.HashSHA256), "Indicates the hashing algorithm to use for checksums (md5, sha256). Default is sha256")
-	rootCmd.Flags().BoolP("recursive", "r", false, "Indicates if dedupe should find dupes recursively. Default is false")
 	rootCmd.Flags().BoolP("keep-one", "o", false, "Enables the 'keep one' mode. At the end of the report, for each duplication it dedupe will ask which file to keep")
-	rootCmd.Flags().BoolP("dry-run", "d", false, "Combined with 'keep-one', it prints the files that will be deleted without taking any actions")
-	rootCmd.Flags().BoolP("verbose", "v", false, "Enables verbose mode")
-	rootCmd.Flags().Bool("rename", false, "Renames the files to their hash")
-	rootCmd.Execute()
-}
+	rootCmd.Flags().StringP("format", "f", formatText, "Output format of the report")
+	rootCmd.Flags().Bool("rename", false, "No longer supported, see 'dedupe rename'")
+	rootCmd.Flags().VisitAll(func(f *pflag.Flag) { f.Hidden = true })
 
-func printUsage(cmd *cobra.Command) {
-	cmd.Println(fmt.Sprintf(long, version.Version, version.Built))
-	cmd.Usage()
-}
-
-func initCmd(cmd *cobra.Command, args []string) {
-	cmd.Use = fmt.Sprintf(usage, cmd.Use)
+	rootCmd.Execute()
 }
 
-func run(cmd *cobra.Command, args []string) {
-	shutdown.ListenForSignals()
-	log.Info("Listening for shutdown signals")
-
-	recursive, _ := cmd.Flags().GetBool("recursive")
-	algorithm, _ := cmd.Flags().GetString("algorithm")
+// runLegacy runs the invocation without a command of the versions before the subcommands, as 'scan' or
+// 'resolve' depending on the flags.
+func runLegacy(cmd *cobra.Command, args []string) {
 	keepone, _ := cmd.Flags().GetBool("keep-one")
-	dryrun, _ := cmd.Flags().GetBool("dry-run")
-	verbose, _ := cmd.Flags().GetBool("verbose")
+	rename, _ := cmd.Flags().GetBool("rename")
 	load, _ := cmd.Flags().GetString("load-from")
 	save, _ := cmd.Flags().GetString("save-to")
 
-	if !validate(args) && load == "" {
-		log.Error("No starting path or progress file provided")
-		printUsage(cmd)
+	if len(args) == 0 && load == "" {
+		cmd.Help()
+		return
+	}
+
+	// Renaming files is not reversible, so the old flag only points to the command replacing it.
+	if rename {
+		log.Error("The 'rename' flag is no longer supported, use 'dedupe rename' instead, which previews the new names with '--dry-run' and records them in a mapping file")
 		os.Exit(-1)
 	}
 
-	c := &cli{
-		Verbose:   verbose,
-		Recursive: recursive,
-		Algorithm: dedupe.HashMode(algorithm),
-		KeepOne:   keepone,
-		DryRun:    dryrun,
-		SaveTo:    save,
+	log.Warn("Running dedupe without a command is deprecated, use 'dedupe scan' or 'dedupe resolve'")
+
+	shutdown.ListenForSignals()
+	log.Info("Listening for shutdown signals")
+
+	c := newScanCli(cmd)
+	readResolveFlags(cmd, c)
+	readFormatFlag(cmd, c)
+	c.KeepOne = keepone
+	c.SaveTo = save
+
+	if c.Format != formatText && (c.KeepOne || c.unattended()) {
+		log.Error("The 'format' flag cannot be combined with 'keep-one', 'keep-policy' or 'rules'")
+		os.Exit(-1)
 	}
 
 	if load != "" {
@@ -83,10 +84,10 @@ func run(cmd *cobra.Command, args []string) {
 		}
 		c.Load(load)
 	} else {
-		c.Start(args[0])
+		c.Start(args...)
 	}
 }
 
 func validate(args []string) bool {
-	return len(args) == 1
+	return len(args) >= 1
 }
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// TestRules explains, for every group of the given report, how each rule applies to each file and what
+// the resulting action would be. No action is taken.
+func (c *cli) TestRules(rules *dedupe.RuleSet, reportFile string) {
+	report, err := dedupe.LoadReport(reportFile)
+	if err != nil {
+		log.Errorf("Unable to load report. %s", err.Error())
+		os.Exit(1)
+	}
+
+	var checksums []string
+	for k := range report.Dupes {
+		checksums = append(checksums, k)
+	}
+	sort.Strings(checksums)
+
+	for _, k := range checksums {
+		fmt.Println()
+		fmt.Println(a.Green("Checksum:  "), a.Cyan(k))
+
+		decision, err := rules.Decide(report, report.Dupes[k])
+		if err != nil {
+			fmt.Println(a.Red("  Unable to apply rules. "), err.Error())
+			continue
+		}
+
+		for _, fd := range decision.Files {
+			fmt.Println(" ", a.Bold(a.Blue(fd.Path)))
+			for _, m := range fd.Matches {
+				switch {
+				case m.Err != nil:
+					fmt.Println("    ", a.Red("error  "), a.Gray(12, m.Rule.String()), a.Red(m.Err.Error()))
+				case m.Matched:
+					fmt.Println("    ", a.Green("match  "), a.Gray(16, m.Rule.String()))
+				default:
+					fmt.Println("    ", a.Gray(8, "no     "), a.Gray(8, m.Rule.String()))
+				}
+			}
+			fmt.Println("    ", a.Bold(a.Yellow("=> "+string(fd.Action))), a.Gray(12, "["+describeRule(fd)+"]"))
+		}
+		if decision.Err != nil {
+			fmt.Println(a.Red("  Group skipped. "), decision.Err.Error())
+		}
+	}
+	fmt.Println()
+}
+
+func describeRule(fd *dedupe.FileDecision) string {
+	if fd.Rule == nil {
+		return fd.Reason
+	}
+	return fmt.Sprintf("%s, line %d", fd.Reason, fd.Rule.Line)
+}
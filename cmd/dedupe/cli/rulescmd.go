@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "tools to work with resolution rule files",
+}
+
+var rulesTestCmd = &cobra.Command{
+	Use:   "test RULES REPORT",
+	Short: "explains how each rule of a rule file applies to the groups of a saved report",
+	Long: `Evaluates every rule of the rule file against every file of the saved report, and prints which
+rules matched and the action each file would get. No action is taken.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runRulesTest,
+}
+
+func init() {
+	rulesCmd.AddCommand(rulesTestCmd)
+	rootCmd.AddCommand(rulesCmd)
+}
+
+func runRulesTest(cmd *cobra.Command, args []string) {
+	rules, err := dedupe.LoadRules(args[0])
+	if err != nil {
+		log.Errorf("Invalid rules. %s", err.Error())
+		os.Exit(-1)
+	}
+
+	c := &cli{}
+	c.TestRules(rules, args[1])
+}
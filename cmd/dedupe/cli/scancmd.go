@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"github.com/jucardi/dedupe/shutdown"
+	"github.com/jucardi/go-logger-lib/log"
+	"github.com/spf13/cobra"
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan PATH [paths...]",
+	Short: "finds the duplicates in the given paths",
+	Long: `Finds the files with identical contents in the given paths and lists them, or writes them in a
+machine readable format. No file is modified. The report can be saved with '--save-to' and resolved
+later with 'dedupe resolve --load-from', or explored with 'dedupe report'.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runScan,
+}
+
+func init() {
+	addScanFlags(scanCmd)
+	scanCmd.Flags().StringP("format", "f", formatText, "Output format of the report: text, or one of json, ndjson (one group per line), csv, nul (NUL terminated paths for 'xargs -0'), fdupes and html (self-contained page), written to the standard output")
+	scanCmd.Flags().StringP("save-to", "s", "", "Saves the report to the given file")
+	rootCmd.AddCommand(scanCmd)
+}
+
+func runScan(cmd *cobra.Command, args []string) {
+	save, _ := cmd.Flags().GetString("save-to")
+
+	shutdown.ListenForSignals()
+	log.Info("Listening for shutdown signals")
+
+	c := newScanCli(cmd)
+	readFormatFlag(cmd, c)
+	c.SaveTo = save
+	c.Start(args...)
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/jucardi/go-logger-lib/log"
+	a "github.com/logrusorgru/aurora"
+)
+
+// Export copies the files of the given trees into the store.
+func (c *cli) Export(storeDir string, paths []string) {
+	store, err := dedupe.OpenStore(storeDir, c.Algorithm, c.IOMode)
+	if err != nil {
+		log.Errorf("Unable to open the store. %s", err.Error())
+		os.Exit(1)
+	}
+
+	var (
+		files, objects, failed int
+		total, copied          int64
+	)
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			fmt.Println(a.Red("Unable to read "), err.Error())
+			failed++
+			continue
+		}
+		// A single file is exported relative to its directory.
+		base := root
+		if !info.IsDir() {
+			base = filepath.Dir(root)
+		}
+
+		list, errs := c.listFiles([]string{root})
+		for _, err := range errs {
+			fmt.Println(a.Red("Unable to read "), err.Error())
+			failed++
+		}
+		for _, f := range list {
+			entry, isNew, err := store.Add(base, f)
+			if err != nil {
+				fmt.Println(a.Red("Unable to export file "), f)
+				fmt.Println(a.Red("    "), err.Error())
+				failed++
+				continue
+			}
+			files++
+			total += entry.Size
+			if isNew {
+				objects++
+				copied += entry.Size
+			}
+			if c.Verbose {
+				label := a.Gray(12, "(known)    ")
+				if isNew {
+					label = a.Green("(copied)   ")
+				}
+				fmt.Println(a.Bold(label), f, a.Gray(12, entry.Checksum))
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(a.Green("Store:        "), a.Cyan(store.Dir()))
+	fmt.Println(a.Green("Files:        "), files, a.Gray(12, formatBytes(total)))
+	fmt.Println(a.Green("New contents: "), objects, a.Gray(12, formatBytes(copied)+" copied"))
+	fmt.Println(a.Green("Deduplicated: "), formatBytes(total-copied))
+	if failed > 0 {
+		fmt.Println(a.Red("Failed:       "), failed)
+		os.Exit(1)
+	}
+}
+
+// Restore rebuilds the trees exported to the store into the target directory. If roots are given, only
+// the files originally under them are restored.
+func (c *cli) Restore(storeDir, target string, roots []string) {
+	if _, err := os.Stat(storeDir); err != nil {
+		log.Errorf("Unable to open the store. %s", err.Error())
+		os.Exit(1)
+	}
+	store, err := dedupe.OpenStore(storeDir, "", c.IOMode)
+	if err != nil {
+		log.Errorf("Unable to open the store. %s", err.Error())
+		os.Exit(1)
+	}
+
+	entries, err := store.Entries()
+	if err != nil {
+		log.Errorf("Unable to read the store. %s", err.Error())
+		os.Exit(1)
+	}
+
+	if len(entries) == 0 {
+		log.Errorf("No files were exported to the store %s", storeDir)
+		os.Exit(1)
+	}
+
+	for i, r := range roots {
+		roots[i] = absOrSelf(r)
+	}
+	var selected []*dedupe.StoreEntry
+	trees := map[string]bool{}
+	for _, e := range entries {
+		if len(roots) == 0 || dedupe.IsUnder(e.Original(), roots...) {
+			selected = append(selected, e)
+			trees[e.Root] = true
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Println(a.Yellow("No exported files match."))
+		return
+	}
+
+	var restored, failed int
+	var total int64
+	for _, e := range selected {
+		dir := target
+		if len(trees) > 1 {
+			dir = filepath.Join(target, filepath.Base(e.Root))
+		}
+		dest, err := e.RestorePath(dir)
+		if err == nil && !c.DryRun {
+			err = store.Restore(e, dest)
+		}
+		if err != nil {
+			fmt.Println(a.Red("Unable to restore file "), e.Original())
+			fmt.Println(a.Red("    "), err.Error())
+			failed++
+			continue
+		}
+
+		restored++
+		total += e.Size
+		switch {
+		case c.DryRun:
+			fmt.Println(a.Bold(a.Magenta("(to restore) ")), dest, a.Gray(12, "from "+e.Original()))
+		case c.Verbose:
+			fmt.Println(a.Bold(a.Green("(restored) ")), dest)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(a.Green("Restored:"), restored, a.Gray(12, formatBytes(total)))
+	if failed > 0 {
+		fmt.Println(a.Red("Failed:  "), failed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo JOURNAL",
+	Short: "reverts the actions recorded in a journal",
+	Long: `Reverts the deletions and links recorded in a journal, most recent first. Every resolution journals
+its actions, to the file given with '--journal' or to a new file in $XDG_STATE_HOME/dedupe. Each removed
+copy is recreated from the file that was kept, as long as it still has the recorded checksum, and its
+original mode and modification time are restored. Actions that failed are left alone.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runUndo,
+}
+
+func init() {
+	undoCmd.Flags().BoolP("dry-run", "d", false, "Prints the files that would be restored without taking any actions")
+	rootCmd.AddCommand(undoCmd)
+}
+
+func runUndo(cmd *cobra.Command, args []string) {
+	dryrun, _ := cmd.Flags().GetBool("dry-run")
+
+	c := &cli{DryRun: dryrun}
+	c.Undo(args[0])
+}
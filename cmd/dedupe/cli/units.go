@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var byteUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses sizes such as '512MB', '2G' or '1048576' into a number of bytes.
+func parseByteSize(s string) (int64, error) {
+	val := strings.ToUpper(strings.TrimSpace(s))
+	if val == "" {
+		return 0, nil
+	}
+
+	factor := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(val, u.suffix) {
+			factor = u.factor
+			val = strings.TrimSpace(strings.TrimSuffix(val, u.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(val, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// formatBytes formats a number of bytes in a human readable way, e.g. '1.5 GB'.
+func formatBytes(n int64) string {
+	for _, u := range byteUnits[:4] {
+		if n >= u.factor {
+			return fmt.Sprintf("%.1f %s", float64(n)/float64(u.factor), u.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// formatDelta formats a change in bytes with its sign, e.g. '+1.5 GB'.
+func formatDelta(n int64) string {
+	switch {
+	case n > 0:
+		return "+" + formatBytes(n)
+	case n < 0:
+		return "-" + formatBytes(-n)
+	default:
+		return "0 B"
+	}
+}
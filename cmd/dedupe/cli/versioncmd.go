@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/jucardi/dedupe/cmd/dedupe/version"
+	"github.com/jucardi/dedupe/dedupe"
+	"github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "prints the version of dedupe",
+	Args:  cobra.NoArgs,
+	Run:   runVersion,
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
+
+func runVersion(cmd *cobra.Command, args []string) {
+	fmt.Printf("dedupe V-%s\n", version.Version)
+	fmt.Printf("  Built:          %s\n", version.Built)
+	fmt.Printf("  Report version: %d\n", dedupe.ReportVersion)
+}
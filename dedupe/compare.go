@@ -0,0 +1,146 @@
+package dedupe
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// CompareReport is the result of comparing the contents of two trees, regardless of the names and
+// locations of the files in each of them.
+type CompareReport struct {
+	A           string
+	B           string
+	OnlyA       []CompareEntry
+	OnlyB       []CompareEntry
+	Shared      []SharedContent
+	OnlyABytes  int64
+	OnlyBBytes  int64
+	SharedBytes int64
+	Errors      []error
+}
+
+// CompareEntry is a file whose contents only exist in one of the compared trees. The checksum is empty
+// when no file in the other tree had the same size, since then the file did not need to be hashed.
+type CompareEntry struct {
+	Path     string
+	Size     int64
+	Checksum string `json:",omitempty"`
+}
+
+// SharedContent is a content present in both trees, with all the paths where it was found on each side.
+type SharedContent struct {
+	Checksum string
+	Size     int64
+	A        []string
+	B        []string
+}
+
+// Compare scans both trees recursively and classifies every file as unique to A, unique to B or shared,
+// by content. Files are only hashed when the other tree has a file of the same size.
+func (s *service) Compare(a, b string) (*CompareReport, error) {
+	s.init()
+
+	for _, path := range []string{a, b} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading path %s, %v", path, err)
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("the give path is not a directory, %s", path)
+		}
+	}
+	if under(a, b) || under(b, a) {
+		return nil, fmt.Errorf("unable to compare %s and %s, one contains the other", a, b)
+	}
+
+	recursive := s.options.Recursive
+	s.options.Recursive = true
+	s.walk(a, b)
+	s.options.Recursive = recursive
+
+	ret := &CompareReport{A: a, B: b}
+	err := s.sizes.eachSize(func(size int64, files []string) error {
+		s.compareGroup(ret, size, files)
+		return nil
+	})
+	s.sizes = nil
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ret.OnlyA, func(i, j int) bool { return ret.OnlyA[i].Path < ret.OnlyA[j].Path })
+	sort.Slice(ret.OnlyB, func(i, j int) bool { return ret.OnlyB[i].Path < ret.OnlyB[j].Path })
+	sort.Slice(ret.Shared, func(i, j int) bool { return ret.Shared[i].A[0] < ret.Shared[j].A[0] })
+	ret.Errors = s.errs
+	return ret, nil
+}
+
+func (s *service) compareGroup(ret *CompareReport, size int64, files []string) {
+	var inA, inB []string
+	for _, f := range files {
+		if s.roots.under(f, ret.A) {
+			inA = append(inA, f)
+		} else {
+			inB = append(inB, f)
+		}
+	}
+
+	if len(inA) == 0 || len(inB) == 0 {
+		for _, f := range inA {
+			ret.addOnlyA(CompareEntry{Path: f, Size: size})
+		}
+		for _, f := range inB {
+			ret.addOnlyB(CompareEntry{Path: f, Size: size})
+		}
+		return
+	}
+
+	contents := map[string]*SharedContent{}
+	var order []string
+	for _, f := range files {
+		checksum, err := s.getHash(f)
+		if err != nil {
+			s.errs = append(s.errs, err)
+			continue
+		}
+		c, ok := contents[checksum]
+		if !ok {
+			c = &SharedContent{Checksum: checksum, Size: size}
+			contents[checksum] = c
+			order = append(order, checksum)
+		}
+		if s.roots.under(f, ret.A) {
+			c.A = append(c.A, f)
+		} else {
+			c.B = append(c.B, f)
+		}
+	}
+
+	for _, checksum := range order {
+		c := contents[checksum]
+		switch {
+		case len(c.B) == 0:
+			for _, f := range c.A {
+				ret.addOnlyA(CompareEntry{Path: f, Size: size, Checksum: checksum})
+			}
+		case len(c.A) == 0:
+			for _, f := range c.B {
+				ret.addOnlyB(CompareEntry{Path: f, Size: size, Checksum: checksum})
+			}
+		default:
+			ret.Shared = append(ret.Shared, *c)
+			ret.SharedBytes += size
+		}
+	}
+}
+
+func (r *CompareReport) addOnlyA(e CompareEntry) {
+	r.OnlyA = append(r.OnlyA, e)
+	r.OnlyABytes += e.Size
+}
+
+func (r *CompareReport) addOnlyB(e CompareEntry) {
+	r.OnlyB = append(r.OnlyB, e)
+	r.OnlyBBytes += e.Size
+}
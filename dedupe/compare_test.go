@@ -0,0 +1,128 @@
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		// want is where each file is classified: shared, onlyA or onlyB.
+		want map[string]string
+		// wantHashed are the files with a checksum, the ones with a file of the same size on the other side.
+		wantHashed []string
+	}{
+		{
+			name:  "identical",
+			files: map[string]string{"a/x": "same", "b/x": "same"},
+			want:  map[string]string{"a/x": "shared", "b/x": "shared"},
+		},
+		{
+			name:  "only left",
+			files: map[string]string{"a/x": "left"},
+			want:  map[string]string{"a/x": "onlyA"},
+		},
+		{
+			name:  "only right",
+			files: map[string]string{"b/sub/x": "right"},
+			want:  map[string]string{"b/sub/x": "onlyB"},
+		},
+		{
+			name:       "same path, different contents",
+			files:      map[string]string{"a/x": "v1", "b/x": "v2"},
+			want:       map[string]string{"a/x": "onlyA", "b/x": "onlyB"},
+			wantHashed: []string{"a/x", "b/x"},
+		},
+		{
+			name:  "same contents, different path",
+			files: map[string]string{"a/x": "moved", "b/sub/y": "moved", "a/copy": "moved"},
+			want:  map[string]string{"a/x": "shared", "b/sub/y": "shared", "a/copy": "shared"},
+		},
+		{
+			name:  "different sizes are not hashed",
+			files: map[string]string{"a/x": "short", "b/x": "longer"},
+			want:  map[string]string{"a/x": "onlyA", "b/x": "onlyB"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+			for _, root := range []string{a, b} {
+				if err := os.MkdirAll(root, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, contents := range tt.files {
+				writeFile(t, filepath.Join(dir, name), contents, past)
+			}
+
+			s := New()
+			s.SetOptions(&Options{Mode: HashSHA256})
+			report, err := s.Compare(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, hashed := map[string]string{}, []string{}
+			rel := func(f string) string {
+				r, _ := filepath.Rel(dir, f)
+				return filepath.ToSlash(r)
+			}
+			for class, entries := range map[string][]CompareEntry{"onlyA": report.OnlyA, "onlyB": report.OnlyB} {
+				for _, e := range entries {
+					got[rel(e.Path)] = class
+					if e.Checksum != "" {
+						hashed = append(hashed, rel(e.Path))
+					}
+				}
+			}
+			var shared int64
+			for _, c := range report.Shared {
+				if c.Checksum != sha256Of(tt.files[rel(c.A[0])]) {
+					t.Errorf("shared checksum = %s", c.Checksum)
+				}
+				for _, f := range append(c.A, c.B...) {
+					got[rel(f)] = "shared"
+				}
+				shared += c.Size
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classification = %v, want %v", got, tt.want)
+			}
+			if want := sortedCopy(tt.wantHashed); !reflect.DeepEqual(sortedCopy(hashed), want) {
+				t.Errorf("hashed = %v, want %v", hashed, want)
+			}
+			if report.SharedBytes != shared {
+				t.Errorf("SharedBytes = %d, want %d", report.SharedBytes, shared)
+			}
+			var onlyA int64
+			for _, e := range report.OnlyA {
+				onlyA += e.Size
+			}
+			if report.OnlyABytes != onlyA || len(report.Errors) != 0 {
+				t.Errorf("OnlyABytes = %d, want %d, errors %v", report.OnlyABytes, onlyA, report.Errors)
+			}
+		})
+	}
+
+	// Invalid trees.
+	writeFile(t, filepath.Join(a, "sub", "x"), "x", past)
+	writeFile(t, filepath.Join(b, "x"), "x", past)
+	for _, paths := range [][2]string{{a, filepath.Join(a, "sub")}, {filepath.Join(b, "x"), a}, {a, filepath.Join(dir, "missing")}} {
+		s := New()
+		s.SetOptions(&Options{Mode: HashSHA256})
+		if _, err := s.Compare(paths[0], paths[1]); err == nil {
+			t.Errorf("Compare(%s, %s) succeeded", paths[0], paths[1])
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package dedupe
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ConsolidatePlaced = ConsolidateStatus("placed")
+	// ConsolidateExisting is a file whose contents were already at its destination, e.g. from a previous run.
+	ConsolidateExisting = ConsolidateStatus("existing")
+	// ConsolidateDuplicate is a file that was not placed because another copy of its contents was.
+	ConsolidateDuplicate = ConsolidateStatus("duplicate")
+	ConsolidateFailed    = ConsolidateStatus("failed")
+)
+
+// ConsolidateStatus is the outcome of consolidating a file.
+type ConsolidateStatus string
+
+// ConsolidateOptions indicates how files are consolidated into the destination.
+type ConsolidateOptions struct {
+	Mode   HashMode
+	IOMode IOMode
+	// Move moves the files into the destination instead of copying them.
+	Move   bool
+	DryRun bool
+}
+
+// ConsolidateEntry is where a source file ended up in the destination. For duplicates, Dest is the copy
+// of their contents that was placed.
+type ConsolidateEntry struct {
+	Source   string
+	Dest     string
+	Checksum string
+	Status   ConsolidateStatus
+	Err      error
+}
+
+// Consolidator places files from several source trees into a single destination tree, at their path
+// relative to their source. A path taken by different contents is suffixed as 'name.N.ext'. It keeps track
+// of the paths taken in the current run, so dry runs report the same collisions as real ones.
+type Consolidator struct {
+	options *ConsolidateOptions
+	dest    string
+	hasher  *service
+	taken   map[string]string
+}
+
+// NewConsolidator creates a consolidator into the given destination directory.
+func NewConsolidator(dest string, opts *ConsolidateOptions) *Consolidator {
+	return &Consolidator{
+		options: opts,
+		dest:    dest,
+		hasher:  &service{options: &Options{Mode: opts.Mode, IOMode: opts.IOMode}},
+		taken:   map[string]string{},
+	}
+}
+
+// Place copies or moves the file, found under the given root, into the destination. If the checksum
+// is not empty, the file fails if its contents no longer match it. Copies are verified against the
+// source before they are reported as placed.
+func (c *Consolidator) Place(root, file, checksum string) *ConsolidateEntry {
+	ret := &ConsolidateEntry{Source: file, Checksum: checksum}
+
+	info, err := os.Lstat(file)
+	if err != nil {
+		return c.fail(ret, fmt.Errorf("unable to read file info of %s, %s", file, err.Error()))
+	}
+	rel, err := filepath.Rel(absPath(root), absPath(file))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return c.fail(ret, fmt.Errorf("unable to consolidate %s, it is not under %s", file, root))
+	}
+
+	// Copies are hashed while they are written, everything else has to be hashed up front.
+	if ret.Checksum == "" || c.options.Move || c.options.DryRun {
+		sum, err := c.hasher.getHash(file)
+		if err != nil {
+			return c.fail(ret, err)
+		}
+		if ret.Checksum != "" && sum != ret.Checksum {
+			return c.fail(ret, fmt.Errorf("unable to consolidate %s, it changed since it was scanned", file))
+		}
+		ret.Checksum = sum
+	}
+
+	target := filepath.Join(c.dest, rel)
+	ext := filepath.Ext(target)
+	stem := strings.TrimSuffix(target, ext)
+
+	for i := 0; ; i++ {
+		ret.Dest = target
+		if i > 0 {
+			ret.Dest = fmt.Sprintf("%s.%d%s", stem, i, ext)
+		}
+
+		sum, exists, err := c.checksumOf(ret.Dest)
+		if err != nil {
+			return c.fail(ret, err)
+		}
+		if !exists {
+			break
+		}
+		if sum == ret.Checksum {
+			ret.Status = ConsolidateExisting
+			return ret
+		}
+	}
+
+	c.taken[ret.Dest] = ret.Checksum
+	ret.Status = ConsolidatePlaced
+	if c.options.DryRun {
+		return ret
+	}
+
+	if err := c.write(ret, info); err != nil {
+		delete(c.taken, ret.Dest)
+		return c.fail(ret, err)
+	}
+	return ret
+}
+
+// Duplicate records a file whose contents were placed from another source file.
+func (c *Consolidator) Duplicate(file string, placed *ConsolidateEntry) *ConsolidateEntry {
+	ret := &ConsolidateEntry{Source: file, Dest: placed.Dest, Checksum: placed.Checksum, Status: ConsolidateDuplicate}
+	if placed.Status == ConsolidateFailed {
+		return c.fail(ret, fmt.Errorf("no copy of the contents of %s was placed, %s failed", file, placed.Source))
+	}
+	return ret
+}
+
+func (c *Consolidator) write(entry *ConsolidateEntry, info os.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(entry.Dest), 0755); err != nil {
+		return fmt.Errorf("unable to create directory for %s, %s", entry.Dest, err.Error())
+	}
+
+	if c.options.Move {
+		return moveFile(entry.Source, entry.Dest, info.Mode(), info.ModTime(), c.options.Mode)
+	}
+
+	sum, err := copyFile(entry.Source, entry.Dest, c.hasher)
+	if err != nil {
+		return err
+	}
+	if entry.Checksum != "" && sum != entry.Checksum {
+		_ = os.Remove(entry.Dest)
+		return fmt.Errorf("unable to consolidate %s, it changed since it was scanned", entry.Source)
+	}
+	entry.Checksum = sum
+	if written, err := c.hasher.getHash(entry.Dest); err != nil || written != sum {
+		_ = os.Remove(entry.Dest)
+		return fmt.Errorf("unable to copy %s to %s, the copy could not be verified", entry.Source, entry.Dest)
+	}
+	_ = os.Chmod(entry.Dest, info.Mode().Perm())
+	_ = os.Chtimes(entry.Dest, info.ModTime(), info.ModTime())
+	return nil
+}
+
+// checksumOf returns the checksum of the file with the given name, if it exists or was taken in this run.
+func (c *Consolidator) checksumOf(file string) (string, bool, error) {
+	if sum, ok := c.taken[file]; ok {
+		return sum, true, nil
+	}
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read file info of %s, %s", file, err.Error())
+	}
+	if !info.Mode().IsRegular() {
+		return "", true, nil
+	}
+	sum, err := c.hasher.getHash(file)
+	return sum, true, err
+}
+
+func (c *Consolidator) fail(ret *ConsolidateEntry, err error) *ConsolidateEntry {
+	ret.Status = ConsolidateFailed
+	ret.Err = err
+	return ret
+}
+
+// WriteConsolidateManifest writes where every source file ended up as CSV, with the columns source,
+// destination, checksum, status and error.
+func WriteConsolidateManifest(w io.Writer, entries []*ConsolidateEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"source", "destination", "checksum", "status", "error"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		msg := ""
+		if e.Err != nil {
+			msg = e.Err.Error()
+		}
+		if err := cw.Write([]string{e.Source, e.Dest, e.Checksum, string(e.Status), msg}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
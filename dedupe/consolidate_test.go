@@ -0,0 +1,140 @@
+package dedupe
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConsolidatorPlace(t *testing.T) {
+	type placement struct {
+		root, name, contents string
+		wantDest             string
+		wantStatus           ConsolidateStatus
+	}
+	placements := []placement{
+		{"r1", "d/p.jpg", "one", "d/p.jpg", ConsolidatePlaced},
+		// d/p.1.jpg is taken by a file of another run.
+		{"r2", "d/p.jpg", "two", "d/p.2.jpg", ConsolidatePlaced},
+		{"r3", "d/p.jpg", "one", "d/p.jpg", ConsolidateExisting},
+		{"r4", "d/p.jpg", "two", "d/p.2.jpg", ConsolidateExisting},
+		{"r4", "d/q.jpg", "zero", "d/q.jpg", ConsolidatePlaced},
+		{"r1", "noext", "a", "noext", ConsolidatePlaced},
+		{"r2", "noext", "b", "noext.1", ConsolidatePlaced},
+		{"r3", "archive.tar.gz", "c", "archive.tar.gz", ConsolidatePlaced},
+		{"r4", "archive.tar.gz", "d", "archive.tar.1.gz", ConsolidatePlaced},
+	}
+
+	tests := []struct {
+		name string
+		opts ConsolidateOptions
+	}{
+		{name: "copy", opts: ConsolidateOptions{Mode: HashSHA256}},
+		{name: "move", opts: ConsolidateOptions{Mode: HashSHA256, Move: true}},
+		{name: "dry run", opts: ConsolidateOptions{Mode: HashSHA256, DryRun: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dest := filepath.Join(dir, "dest")
+			writeFile(t, filepath.Join(dest, "d", "p.1.jpg"), "zero", past)
+			opts := tt.opts
+			c := NewConsolidator(dest, &opts)
+
+			for _, p := range placements {
+				root := filepath.Join(dir, p.root)
+				file := writeFile(t, filepath.Join(root, p.name), p.contents, past)
+				got := c.Place(root, file, "")
+
+				wantDest := filepath.Join(dest, p.wantDest)
+				if got.Err != nil || got.Dest != wantDest || got.Status != p.wantStatus || got.Checksum != sha256Of(p.contents) {
+					t.Errorf("Place(%s) = %s (%s, %v), want %s (%s)", file, got.Dest, got.Status, got.Err, wantDest, p.wantStatus)
+				}
+				if exists(file) == (opts.Move && p.wantStatus == ConsolidatePlaced) {
+					t.Errorf("%s exists = %v", file, exists(file))
+				}
+				if !opts.DryRun && readFile(t, wantDest) != p.contents {
+					t.Errorf("%s holds %q, want %q", wantDest, readFile(t, wantDest), p.contents)
+				}
+			}
+			if opts.DryRun && exists(filepath.Join(dest, "d", "p.jpg")) {
+				t.Errorf("the dry run placed files")
+			}
+		})
+	}
+}
+
+func TestConsolidatorFailures(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	file := writeFile(t, filepath.Join(root, "x"), "data", past)
+	outside := writeFile(t, filepath.Join(dir, "outside"), "data", past)
+
+	tests := []struct {
+		name     string
+		file     string
+		checksum string
+		wantErr  string
+	}{
+		{name: "missing file", file: filepath.Join(root, "missing"), wantErr: "unable to read file info"},
+		{name: "outside of the root", file: outside, wantErr: "it is not under"},
+		{name: "changed since the scan", file: file, checksum: sha256Of("other"), wantErr: "it changed since it was scanned"},
+	}
+
+	for _, tt := range tests {
+		for _, move := range []bool{false, true} {
+			c := NewConsolidator(filepath.Join(dir, "dest"), &ConsolidateOptions{Mode: HashSHA256, Move: move})
+			got := c.Place(root, tt.file, tt.checksum)
+			if got.Status != ConsolidateFailed || got.Err == nil || !strings.Contains(got.Err.Error(), tt.wantErr) {
+				t.Errorf("%s (move %v): Place() = %s, %v, want %q", tt.name, move, got.Status, got.Err, tt.wantErr)
+			}
+		}
+	}
+	if exists(filepath.Join(dir, "dest", "x")) || !exists(file) {
+		t.Errorf("a failed placement changed the trees")
+	}
+
+	// Duplicates of a failed placement fail too.
+	c := NewConsolidator(filepath.Join(dir, "dest"), &ConsolidateOptions{Mode: HashSHA256})
+	failed := c.Place(root, outside, "")
+	if dup := c.Duplicate(file, failed); dup.Status != ConsolidateFailed || dup.Err == nil {
+		t.Errorf("Duplicate() = %s, %v", dup.Status, dup.Err)
+	}
+	placed := c.Place(root, file, "")
+	if dup := c.Duplicate(outside, placed); dup.Status != ConsolidateDuplicate || dup.Dest != placed.Dest {
+		t.Errorf("Duplicate() = %s, %s", dup.Status, dup.Dest)
+	}
+}
+
+func TestWriteConsolidateManifest(t *testing.T) {
+	entries := []*ConsolidateEntry{
+		{Source: "/a/x", Dest: "/d/x", Checksum: "abc", Status: ConsolidatePlaced},
+		{Source: "/a/\"y\", z", Status: ConsolidateFailed, Err: errors.New("boom")},
+	}
+	var buf bytes.Buffer
+	if err := WriteConsolidateManifest(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"source", "destination", "checksum", "status", "error"},
+		{"/a/x", "/d/x", "abc", "placed", ""},
+		{"/a/\"y\", z", "", "", "failed", "boom"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %q, want %q", rows, want)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
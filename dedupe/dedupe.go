@@ -3,13 +3,12 @@ package dedupe
 import (
 	"crypto/md5"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"hash"
-	"io"
-	"io/ioutil"
 	"os"
-
-	"github.com/jucardi/go-osx/paths"
+	"sync"
+	"time"
 )
 
 const (
@@ -20,28 +19,32 @@ const (
 type HashMode string
 
 type IDedupe interface {
-	FindDupes(path string) (*DupeReport, error)
+	FindDupes(paths ...string) (*DupeReport, error)
+	Compare(a, b string) (*CompareReport, error)
 	SetOptions(opts *Options)
 }
 
 type Options struct {
 	Mode                  HashMode
+	IOMode                IOMode
+	BufferSize            int
 	Recursive             bool
+	References            []string
+	Walkers               int
+	MemoryLimit           int64
+	TempDir               string
 	PotentialDupeCallback func(paths []string, size int64)
 	CurrentDirCallback    func(dir string)
 	ReadingHashCallback   func(file string)
 	HashReadCallback      func(file, hash string)
 }
 
-type DupeReport struct {
-	Dupes  map[string][]string
-	Errors []error
-}
-
 type service struct {
-	precheckMap map[int64][]string
-	errs        []error
-	options     *Options
+	mu      sync.Mutex
+	sizes   *sizeIndex
+	errs    []error
+	options *Options
+	roots   *rootCache
 }
 
 func New() IDedupe {
@@ -49,108 +52,174 @@ func New() IDedupe {
 }
 
 func (s *service) init() {
-	s.precheckMap = map[int64][]string{}
 	s.errs = []error{}
 	if s.options == nil {
 		s.SetOptions(&Options{})
 	}
+	s.sizes = newSizeIndex(s.options.MemoryLimit/2, s.options.TempDir)
+	s.roots = newRootCache()
 }
 
 func (s *service) SetOptions(opts *Options) {
 	s.options = opts
 }
 
-func (s *service) FindDupes(path string) (*DupeReport, error) {
+// FindDupes scans the given paths and the reference paths set in the options, and returns the groups of
+// files with identical contents. When references are set, groups made only of reference files are not
+// reported.
+func (s *service) FindDupes(paths ...string) (*DupeReport, error) {
 	s.init()
-	fi, err := os.Stat(path)
-	if err != nil {
-		return nil, fmt.Errorf("error reading path %s, %v", path, err)
-	}
-	if !fi.IsDir() {
-		return nil, fmt.Errorf("the give path is not a directory, %s", path)
-	}
-
-	s.processDir(path)
-	result := s.dedupe()
 
-	ret := &DupeReport{
-		Errors: s.errs,
-		Dupes:  map[string][]string{},
+	roots := append(append([]string{}, paths...), s.options.References...)
+	if len(roots) == 0 {
+		return nil, errors.New("no paths to scan were given")
 	}
 
-	for k, v := range result {
-		if len(v) <= 1 {
-			continue
+	for _, path := range roots {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading path %s, %v", path, err)
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("the give path is not a directory, %s", path)
 		}
-		ret.Dupes[k] = v
-	}
-	return ret, nil
-}
-
-func (s *service) processDir(path string) {
-	if s.options.CurrentDirCallback != nil {
-		s.options.CurrentDirCallback(path)
 	}
 
-	items, err := ioutil.ReadDir(path)
-
+	s.walk(s.walkRoots(roots)...)
+	dupes, sizes, err := s.dedupe()
 	if err != nil {
-		s.errs = append(s.errs, fmt.Errorf("error reading contents of path %s, %s", path, err.Error()))
-		return
+		return nil, err
 	}
 
-	var dirs []string
+	return &DupeReport{
+		Errors:     s.errs,
+		Dupes:      dupes,
+		Sizes:      sizes,
+		Algorithm:  s.algorithm(),
+		Created:    time.Now(),
+		Roots:      roots,
+		References: s.options.References,
+	}, nil
+}
 
-	for _, item := range items {
-		if item.IsDir() {
-			dirs = append(dirs, item.Name())
-			continue
+// walkRoots removes the duplicated roots and, when scanning recursively, the roots nested in another one
+// so no file is visited twice. Roots are compared once resolved, so a root given through a symlink or as
+// both a relative and an absolute path is walked only once.
+func (s *service) walkRoots(roots []string) []string {
+	var ret []string
+	for i, root := range roots {
+		skip := false
+		for j, other := range roots {
+			if i == j {
+				continue
+			}
+			if resolveDir(root) == resolveDir(other) {
+				skip = j < i
+			} else if s.options.Recursive && underPath(resolveDir(root), resolveDir(other)) {
+				skip = true
+			}
+			if skip {
+				break
+			}
+		}
+		if !skip {
+			ret = append(ret, root)
 		}
-		s.precheck(path, item)
-	}
-
-	if !s.options.Recursive {
-		return
-	}
-
-	for _, dir := range dirs {
-		s.processDir(paths.Combine(path, dir))
 	}
+	return ret
 }
 
 func (s *service) precheck(path string, fInfo os.FileInfo) {
-	filePath := paths.Combine(path, fInfo.Name())
-	if _, ok := s.precheckMap[fInfo.Size()]; !ok {
-		s.precheckMap[fInfo.Size()] = []string{filePath}
-		return
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count, err := s.sizes.add(path, fInfo.Name(), fInfo.Size())
+	if err != nil {
+		s.errs = append(s.errs, err)
 	}
-	s.precheckMap[fInfo.Size()] = append(s.precheckMap[fInfo.Size()], filePath)
-	if s.options.PotentialDupeCallback != nil {
-		s.options.PotentialDupeCallback(s.precheckMap[fInfo.Size()], fInfo.Size())
+	if count > 1 && s.options.PotentialDupeCallback != nil {
+		s.options.PotentialDupeCallback(s.sizes.bucket(fInfo.Size()), fInfo.Size())
 	}
 }
 
-func (s *service) dedupe() map[string][]string {
-	m := map[string][]string{}
-	for _, v := range s.precheckMap {
-		if len(v) <= 1 {
-			continue
-		}
+// dedupe hashes every file that shares its size with another one and returns the groups of files with the
+// same checksum, along with the size of the files of each group. Both stages keep their memory use under
+// Options.MemoryLimit by spilling to disk.
+func (s *service) dedupe() (map[string][]string, map[string]int64, error) {
+	hashes := newHashIndex(s.options.MemoryLimit/2, s.options.TempDir)
 
-		for _, file := range v {
+	// Files only present in the reference roots are of no interest, no need to hash them.
+	err := s.sizes.each(func(size int64, files []string) error {
+		if s.allReferences(files) {
+			return nil
+		}
+		for _, file := range files {
 			checksum, err := s.getHash(file)
 			if err != nil {
 				s.errs = append(s.errs, err)
 				continue
 			}
-			if _, ok := m[checksum]; !ok {
-				m[checksum] = []string{file}
-			} else {
-				m[checksum] = append(m[checksum], file)
+			if err := hashes.add(checksum, file); err != nil {
+				s.errs = append(s.errs, err)
+			}
+		}
+		return nil
+	})
+	s.sizes = nil
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ret := map[string][]string{}
+	sizes := map[string]int64{}
+	if err := hashes.each(func(checksum string, files []string) error {
+		if s.allReferences(files) {
+			return nil
+		}
+		ret[checksum] = files
+		for _, f := range files {
+			if info, err := os.Lstat(f); err == nil {
+				sizes[checksum] = info.Size()
+				break
 			}
 		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	return ret, sizes, nil
+}
+
+func (s *service) allReferences(files []string) bool {
+	if len(s.options.References) == 0 {
+		return false
+	}
+	for _, f := range files {
+		if !s.roots.underAny(f, s.options.References) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *service) algorithm() HashMode {
+	return algorithmOf(s.options.Mode)
+}
+
+// algorithmOf returns the algorithm used for the given mode, sha256 unless md5 is requested.
+func algorithmOf(mode HashMode) HashMode {
+	if mode == HashMD5 {
+		return HashMD5
 	}
-	return m
+	return HashSHA256
+}
+
+// checksumLength returns the number of hex digits of the checksums calculated with the given mode.
+func checksumLength(mode HashMode) int {
+	if algorithmOf(mode) == HashMD5 {
+		return md5.Size * 2
+	}
+	return sha256.Size * 2
 }
 
 func (s *service) getHasher() hash.Hash {
@@ -167,7 +236,7 @@ func (s *service) getHash(file string) (string, error) {
 		s.options.ReadingHashCallback(file)
 	}
 
-	f, err := os.Open(file)
+	f, mode, err := openForHash(file, s.options.IOMode)
 	if err != nil {
 		return "", fmt.Errorf("unable to read file %s, %s", file, err.Error())
 	}
@@ -175,8 +244,20 @@ func (s *service) getHash(file string) (string, error) {
 	defer f.Close()
 	h := s.getHasher()
 
-	if _, err := io.Copy(h, f); err != nil {
-		return "", fmt.Errorf("unable to calculate checksum of file %s, %s", file, err.Error())
+	if err := s.readInto(h, f, mode); err != nil {
+		if mode != IODirect || !isDirectIOUnsupported(err) {
+			return "", fmt.Errorf("unable to calculate checksum of file %s, %s", file, err.Error())
+		}
+		// The filesystem rejected direct reads, retry going through the page cache.
+		retry, err := os.Open(file)
+		if err != nil {
+			return "", fmt.Errorf("unable to read file %s, %s", file, err.Error())
+		}
+		defer retry.Close()
+		h.Reset()
+		if err := s.readInto(h, retry, IONoCache); err != nil {
+			return "", fmt.Errorf("unable to calculate checksum of file %s, %s", file, err.Error())
+		}
 	}
 
 	checksum := fmt.Sprintf("%x", h.Sum(nil))
@@ -0,0 +1,144 @@
+package dedupe
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	GroupNew      = GroupChange("new")
+	GroupResolved = GroupChange("resolved")
+	GroupGrown    = GroupChange("grown")
+	GroupShrunk   = GroupChange("shrunk")
+	// GroupMoved is a group with the same number of copies, some of them at different paths.
+	GroupMoved = GroupChange("moved")
+)
+
+// GroupChange is how a group changed between two reports.
+type GroupChange string
+
+// GroupDiff is a group that changed between two reports.
+type GroupDiff struct {
+	Checksum string
+	Change   GroupChange
+	Size     int64
+	// Added and Removed are the files that only appear in the new and the old report respectively.
+	Added   []string
+	Removed []string
+	// Delta is the change in reclaimable bytes, positive if the group wastes more space than before.
+	Delta int64
+}
+
+// ReportDiff is what changed between two reports.
+type ReportDiff struct {
+	Groups []*GroupDiff
+	// Delta is the change in reclaimable bytes of the whole report.
+	Delta int64
+}
+
+// Count returns the number of groups with the given change.
+func (d *ReportDiff) Count(change GroupChange) int {
+	n := 0
+	for _, g := range d.Groups {
+		if g.Change == change {
+			n++
+		}
+	}
+	return n
+}
+
+var changeOrder = map[GroupChange]int{GroupNew: 0, GroupGrown: 1, GroupShrunk: 2, GroupMoved: 3, GroupResolved: 4}
+
+// DiffReports compares two reports calculated with the same algorithm. Groups that are no longer in the
+// new report, or that are resolved in it, are resolved. The groups are sorted by change, then by the
+// magnitude of their delta.
+func DiffReports(from, to *DupeReport) (*ReportDiff, error) {
+	if from.Algorithm != "" && to.Algorithm != "" && from.Algorithm != to.Algorithm {
+		return nil, fmt.Errorf("the reports were calculated with different algorithms, %s and %s", from.Algorithm, to.Algorithm)
+	}
+
+	before := pendingGroups(from)
+	after := pendingGroups(to)
+	ret := &ReportDiff{}
+
+	for checksum, g := range after {
+		prev, ok := before[checksum]
+		if !ok {
+			ret.add(&GroupDiff{Checksum: checksum, Change: GroupNew, Size: g.Size, Added: g.Files, Delta: g.Reclaimable()})
+			continue
+		}
+
+		d := &GroupDiff{Checksum: checksum, Size: g.Size, Delta: g.Reclaimable() - prev.Reclaimable()}
+		d.Added, d.Removed = diffFiles(prev.Files, g.Files)
+		switch {
+		case len(g.Files) > len(prev.Files):
+			d.Change = GroupGrown
+		case len(g.Files) < len(prev.Files):
+			d.Change = GroupShrunk
+		case len(d.Added) > 0:
+			d.Change = GroupMoved
+		default:
+			continue
+		}
+		ret.add(d)
+	}
+
+	for checksum, g := range before {
+		if _, ok := after[checksum]; !ok {
+			ret.add(&GroupDiff{Checksum: checksum, Change: GroupResolved, Size: g.Size, Removed: g.Files, Delta: -g.Reclaimable()})
+		}
+	}
+
+	sort.Slice(ret.Groups, func(i, j int) bool {
+		a, b := ret.Groups[i], ret.Groups[j]
+		if a.Change != b.Change {
+			return changeOrder[a.Change] < changeOrder[b.Change]
+		}
+		if ma, mb := abs(a.Delta), abs(b.Delta); ma != mb {
+			return ma > mb
+		}
+		return a.Checksum < b.Checksum
+	})
+	return ret, nil
+}
+
+func (d *ReportDiff) add(g *GroupDiff) {
+	d.Groups = append(d.Groups, g)
+	d.Delta += g.Delta
+}
+
+func pendingGroups(r *DupeReport) map[string]*DupeGroup {
+	ret := map[string]*DupeGroup{}
+	for _, g := range r.Groups() {
+		if !r.IsResolved(g.Checksum) {
+			ret[g.Checksum] = g
+		}
+	}
+	return ret
+}
+
+// diffFiles returns the files only in b and the files only in a. Both lists must be sorted.
+func diffFiles(a, b []string) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			removed = append(removed, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			added = append(added, b[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return added, removed
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package dedupe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffReports(t *testing.T) {
+	from := &DupeReport{
+		Algorithm: HashSHA256,
+		Dupes: map[string][]string{
+			"same":     {"/a/1", "/a/2"},
+			"grown":    {"/b/1", "/b/2"},
+			"shrunk":   {"/c/1", "/c/2", "/c/3"},
+			"moved":    {"/d/1", "/d/2"},
+			"gone":     {"/e/1", "/e/2"},
+			"resolved": {"/f/1", "/f/2"},
+		},
+		Sizes: map[string]int64{"same": 1, "grown": 10, "shrunk": 100, "moved": 5, "gone": 7, "resolved": 3},
+	}
+	to := &DupeReport{
+		Dupes: map[string][]string{
+			"same":     {"/a/2", "/a/1"},
+			"grown":    {"/b/1", "/b/2", "/b/3"},
+			"shrunk":   {"/c/1", "/c/3"},
+			"moved":    {"/d/1", "/d/9"},
+			"resolved": {"/f/1", "/f/2"},
+			"new":      {"/g/1", "/g/2", "/g/3"},
+		},
+		Sizes:       map[string]int64{"same": 1, "grown": 10, "shrunk": 100, "moved": 5, "resolved": 3, "new": 2},
+		Resolutions: map[string]*Resolution{"resolved": {Decision: DecisionDeleted, Outcome: OutcomeDone}},
+	}
+
+	want := []*GroupDiff{
+		{Checksum: "new", Change: GroupNew, Size: 2, Added: []string{"/g/1", "/g/2", "/g/3"}, Delta: 4},
+		{Checksum: "grown", Change: GroupGrown, Size: 10, Added: []string{"/b/3"}, Delta: 10},
+		{Checksum: "shrunk", Change: GroupShrunk, Size: 100, Removed: []string{"/c/2"}, Delta: -100},
+		{Checksum: "moved", Change: GroupMoved, Size: 5, Added: []string{"/d/9"}, Removed: []string{"/d/2"}},
+		{Checksum: "gone", Change: GroupResolved, Size: 7, Removed: []string{"/e/1", "/e/2"}, Delta: -7},
+		{Checksum: "resolved", Change: GroupResolved, Size: 3, Removed: []string{"/f/1", "/f/2"}, Delta: -3},
+	}
+
+	got, err := DiffReports(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Groups) != len(want) {
+		t.Fatalf("DiffReports() = %d groups, want %d", len(got.Groups), len(want))
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(got.Groups[i], w) {
+			t.Errorf("group %d = %+v, want %+v", i, got.Groups[i], w)
+		}
+	}
+	if got.Delta != 4+10-100-7-3 {
+		t.Errorf("Delta = %d", got.Delta)
+	}
+	if got.Count(GroupResolved) != 2 || got.Count(GroupNew) != 1 {
+		t.Errorf("Count() = %d resolved, %d new", got.Count(GroupResolved), got.Count(GroupNew))
+	}
+
+	if _, err := DiffReports(from, &DupeReport{Algorithm: HashMD5}); err == nil {
+		t.Error("DiffReports() compared reports of different algorithms")
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	tests := []struct {
+		a, b           []string
+		added, removed []string
+	}{
+		{a: nil, b: nil},
+		{a: []string{"1", "2"}, b: []string{"1", "2"}},
+		{a: nil, b: []string{"1"}, added: []string{"1"}},
+		{a: []string{"1"}, b: nil, removed: []string{"1"}},
+		{a: []string{"1", "3", "5"}, b: []string{"2", "3", "4", "6"}, added: []string{"2", "4", "6"}, removed: []string{"1", "5"}},
+	}
+
+	for _, tt := range tests {
+		added, removed := diffFiles(tt.a, tt.b)
+		if !reflect.DeepEqual(added, tt.added) || !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("diffFiles(%v, %v) = %v, %v, want %v, %v", tt.a, tt.b, added, removed, tt.added, tt.removed)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package dedupe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	FormatJSON   = ReportFormat("json")
+	FormatNDJSON = ReportFormat("ndjson")
+	FormatCSV    = ReportFormat("csv")
+	FormatNUL    = ReportFormat("nul")
+	FormatFdupes = ReportFormat("fdupes")
+)
+
+// ReportFormat is a machine readable output format for reports.
+type ReportFormat string
+
+// IReportWriter writes a report in a given format. Groups are always written in the order of
+// DupeReport.Groups, so the output of the same report is always the same, and groups with less than two
+// files are left out.
+type IReportWriter interface {
+	Write(w io.Writer, report *DupeReport) error
+}
+
+var reportWriters = map[ReportFormat]IReportWriter{
+	FormatJSON:   &jsonWriter{},
+	FormatNDJSON: &ndjsonWriter{},
+	FormatCSV:    &csvWriter{},
+	FormatNUL:    &nulWriter{},
+	FormatFdupes: &fdupesWriter{},
+}
+
+// ReportFormats returns the supported output formats.
+func ReportFormats() []ReportFormat {
+	return []ReportFormat{FormatJSON, FormatNDJSON, FormatCSV, FormatNUL, FormatFdupes, FormatHTML}
+}
+
+// NewReportWriter returns the writer for the given format.
+func NewReportWriter(format ReportFormat) (IReportWriter, error) {
+	if w, ok := reportWriters[format]; ok {
+		return w, nil
+	}
+	return nil, fmt.Errorf("unknown format '%s'", format)
+}
+
+// duplicates returns a copy of the report without the groups left with less than two files, e.g. by
+// editing or merging reports, which are not duplicates anymore.
+func duplicates(report *DupeReport) *DupeReport {
+	ret := *report
+	ret.Dupes = map[string][]string{}
+	for checksum, files := range report.Dupes {
+		if len(files) >= 2 {
+			ret.Dupes[checksum] = files
+		}
+	}
+	return &ret
+}
+
+func errorStrings(errs []error) []string {
+	ret := []string{}
+	for _, e := range errs {
+		ret = append(ret, e.Error())
+	}
+	return ret
+}
+
+// jsonWriter writes the whole report as a single JSON document, in the same versioned format reports are
+// saved in.
+type jsonWriter struct{}
+
+func (*jsonWriter) Write(w io.Writer, report *DupeReport) error {
+	data, err := json.Marshal(duplicates(report))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// ndjsonWriter writes one JSON object per group and line.
+type ndjsonWriter struct{}
+
+func (*ndjsonWriter) Write(w io.Writer, report *DupeReport) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, g := range duplicates(report).Groups() {
+		if err := enc.Encode(toReportGroup(g)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// csvWriter writes one row per file, with the number of the group it belongs to.
+type csvWriter struct{}
+
+func (*csvWriter) Write(w io.Writer, report *DupeReport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"group", "checksum", "size", "path"}); err != nil {
+		return err
+	}
+	for i, g := range duplicates(report).Groups() {
+		for _, f := range g.Files {
+			if err := cw.Write([]string{strconv.Itoa(i + 1), g.Checksum, strconv.FormatInt(g.Size, 10), f}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// nulWriter writes every path terminated by a NUL byte, for 'xargs -0'. Groups are not delimited, since
+// an empty record would be an empty argument; the other formats tell groups apart.
+type nulWriter struct{}
+
+func (*nulWriter) Write(w io.Writer, report *DupeReport) error {
+	bw := bufio.NewWriter(w)
+	for _, g := range duplicates(report).Groups() {
+		for _, f := range g.Files {
+			bw.WriteString(f)
+			bw.WriteByte(0)
+		}
+	}
+	return bw.Flush()
+}
+
+// fdupesWriter writes the same layout as fdupes: one path per line, with groups separated by an empty
+// line.
+type fdupesWriter struct{}
+
+func (*fdupesWriter) Write(w io.Writer, report *DupeReport) error {
+	bw := bufio.NewWriter(w)
+	for _, g := range duplicates(report).Groups() {
+		for _, f := range g.Files {
+			bw.WriteString(f)
+			bw.WriteByte('\n')
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,107 @@
+package dedupe
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReportWriters(t *testing.T) {
+	report := &DupeReport{
+		Dupes: map[string][]string{
+			"aa": {"/b/x", "/a/x"},
+			"bb": {"/c/with, comma", "/c/y", "/c/line\nbreak"},
+			// Left with a single file, e.g. by merging or editing reports.
+			"cc": {"/single"},
+		},
+		Sizes:     map[string]int64{"aa": 100, "bb": 10, "cc": 5},
+		Algorithm: HashSHA256,
+		Roots:     []string{"/"},
+		Errors:    []error{errors.New("unable to read /z")},
+	}
+
+	tests := []struct {
+		format ReportFormat
+		want   string
+	}{
+		{
+			format: FormatJSON,
+			want: `{
+  "version": 2,
+  "algorithm": "sha256",
+  "roots": [
+    "/"
+  ],
+  "groups": [
+    {
+      "checksum": "aa",
+      "size": 100,
+      "files": [
+        "/a/x",
+        "/b/x"
+      ]
+    },
+    {
+      "checksum": "bb",
+      "size": 10,
+      "files": [
+        "/c/line\nbreak",
+        "/c/with, comma",
+        "/c/y"
+      ]
+    }
+  ],
+  "errors": [
+    "unable to read /z"
+  ]
+}
+`,
+		},
+		{
+			format: FormatNDJSON,
+			want: `{"checksum":"aa","size":100,"files":["/a/x","/b/x"]}
+{"checksum":"bb","size":10,"files":["/c/line\nbreak","/c/with, comma","/c/y"]}
+`,
+		},
+		{
+			format: FormatCSV,
+			want: "group,checksum,size,path\n" +
+				"1,aa,100,/a/x\n" +
+				"1,aa,100,/b/x\n" +
+				"2,bb,10,\"/c/line\nbreak\"\n" +
+				"2,bb,10,\"/c/with, comma\"\n" +
+				"2,bb,10,/c/y\n",
+		},
+		{
+			format: FormatNUL,
+			want:   "/a/x\x00/b/x\x00/c/line\nbreak\x00/c/with, comma\x00/c/y\x00",
+		},
+		{
+			format: FormatFdupes,
+			want:   "/a/x\n/b/x\n\n/c/line\nbreak\n/c/with, comma\n/c/y\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			w, err := NewReportWriter(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := w.Write(&buf, report); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewReportWriter("xml"); err == nil {
+		t.Errorf("NewReportWriter(xml) succeeded")
+	}
+	if len(report.Dupes) != 3 {
+		t.Errorf("writing the report changed its groups: %v", report.Dupes)
+	}
+}
@@ -0,0 +1,348 @@
+package dedupe
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const FormatHTML = ReportFormat("html")
+
+func init() {
+	reportWriters[FormatHTML] = &htmlWriter{}
+}
+
+// htmlWriter writes a single self-contained HTML page: summary totals, the groups sorted by reclaimable
+// space with collapsible path lists, a search box, and a treemap of the wasted space per directory. All
+// styles and scripts are inline, the page makes no network request.
+type htmlWriter struct{}
+
+type htmlPage struct {
+	Generated   string
+	Roots       []string
+	References  []string
+	Errors      []string
+	Groups      []*htmlGroup
+	Files       int
+	Total       int64
+	Reclaimable int64
+	Tree        *treeNode
+}
+
+type htmlGroup struct {
+	Checksum    string
+	Size        int64
+	Reclaimable int64
+	Files       []htmlFile
+	Search      string
+}
+
+type htmlFile struct {
+	Path      string
+	Reference bool
+}
+
+// treeNode is a directory of the treemap. Size is the wasted space under it, Own the part of it held by
+// files directly in the directory.
+type treeNode struct {
+	Name     string      `json:"name"`
+	Size     int64       `json:"size"`
+	Own      int64       `json:"own"`
+	Children []*treeNode `json:"children,omitempty"`
+
+	index map[string]*treeNode
+}
+
+func (*htmlWriter) Write(w io.Writer, report *DupeReport) error {
+	page := &htmlPage{
+		Generated:  time.Now().Format("2006-01-02 15:04:05"),
+		Roots:      report.Roots,
+		References: report.References,
+		Errors:     errorStrings(report.Errors),
+		Tree:       &treeNode{Name: "."},
+	}
+
+	for _, g := range duplicates(report).Groups() {
+		hg := &htmlGroup{Checksum: g.Checksum, Size: g.Size, Reclaimable: g.Reclaimable()}
+		for _, f := range g.Files {
+			hg.Files = append(hg.Files, htmlFile{Path: f, Reference: report.IsReference(f)})
+		}
+		if len(page.Groups) == 0 && filepath.IsAbs(g.Files[0]) {
+			page.Tree.Name = "/"
+		}
+		hg.Search = strings.ToLower(strings.Join(g.Files, "\n"))
+		page.Groups = append(page.Groups, hg)
+
+		page.Files += len(g.Files)
+		page.Reclaimable += hg.Reclaimable
+		if g.Size > 0 {
+			page.Total += g.Size * int64(len(g.Files))
+		}
+
+		// Every copy accounts for its share of the space the group wastes.
+		if hg.Reclaimable > 0 {
+			for _, f := range g.Files {
+				page.Tree.add(filepath.Dir(f), hg.Reclaimable/int64(len(g.Files)))
+			}
+		}
+	}
+	page.Tree.compact()
+
+	return htmlTemplate.Execute(w, page)
+}
+
+func (n *treeNode) add(dir string, size int64) {
+	n.Size += size
+	node := n
+	for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		child, ok := node.index[part]
+		if !ok {
+			child = &treeNode{Name: part}
+			if node.index == nil {
+				node.index = map[string]*treeNode{}
+			}
+			node.index[part] = child
+			node.Children = append(node.Children, child)
+		}
+		child.Size += size
+		node = child
+	}
+	node.Own += size
+}
+
+// compact merges the directories with a single subdirectory and no files of their own into it (a/b/c
+// instead of a > b > c), and sorts the children by size.
+func (n *treeNode) compact() {
+	for len(n.Children) == 1 && n.Own == 0 {
+		child := n.Children[0]
+		if n.Name == "." {
+			n.Name = child.Name
+		} else {
+			n.Name = strings.TrimSuffix(n.Name, "/") + "/" + child.Name
+		}
+		n.Own, n.Children = child.Own, child.Children
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Size != n.Children[j].Size {
+			return n.Children[i].Size > n.Children[j].Size
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, c := range n.Children {
+		c.compact()
+	}
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": humanBytes,
+	"short": func(s string) string {
+		if len(s) > 12 {
+			return s[:12]
+		}
+		return s
+	},
+}).Parse(htmlSource))
+
+const htmlSource = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Dedupe report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #222; background: #f6f7f9; }
+header { background: #24292f; color: #fff; padding: 16px 24px; }
+header h1 { margin: 0; font-size: 20px; }
+header p { margin: 4px 0 0; color: #bbb; font-size: 13px; }
+main { padding: 16px 24px; max-width: 1200px; }
+section { background: #fff; border: 1px solid #ddd; border-radius: 6px; padding: 16px; margin-bottom: 16px; }
+h2 { font-size: 16px; margin: 0 0 12px; }
+.totals { display: flex; flex-wrap: wrap; gap: 12px; }
+.total { flex: 1; min-width: 150px; background: #f6f7f9; border-radius: 6px; padding: 12px; }
+.total b { display: block; font-size: 22px; }
+.total span { color: #666; font-size: 13px; }
+.paths { font-family: Menlo, Consolas, monospace; font-size: 12px; color: #555; }
+#treemap { position: relative; height: 420px; background: #eee; border-radius: 4px; overflow: hidden; }
+#treemap div { position: absolute; box-sizing: border-box; border: 1px solid #fff; overflow: hidden; font-size: 11px; padding: 2px 4px; color: #fff; cursor: pointer; }
+#treemap div.files { cursor: default; opacity: .7; }
+#crumbs { margin-bottom: 8px; font-size: 13px; }
+#crumbs a { color: #0969da; cursor: pointer; }
+#search { width: 100%; box-sizing: border-box; padding: 8px; font-size: 14px; border: 1px solid #ccc; border-radius: 4px; margin-bottom: 8px; }
+details { border-top: 1px solid #eee; padding: 6px 0; }
+summary { cursor: pointer; font-size: 14px; }
+summary .size { display: inline-block; min-width: 90px; font-weight: bold; }
+summary .sum { color: #888; font-family: Menlo, Consolas, monospace; font-size: 12px; }
+details ul { margin: 6px 0 0; padding-left: 24px; }
+li.ref { color: #1a7f37; }
+li.ref::after { content: " (reference)"; font-family: sans-serif; }
+.errors li { color: #cf222e; font-size: 13px; }
+</style>
+</head>
+<body>
+<header>
+<h1>Dedupe report</h1>
+<p>Generated {{.Generated}}</p>
+</header>
+<main>
+<section>
+<h2>Summary</h2>
+<div class="totals">
+<div class="total"><b>{{len .Groups}}</b><span>groups of duplicates</span></div>
+<div class="total"><b>{{.Files}}</b><span>files in groups</span></div>
+<div class="total"><b>{{bytes .Total}}</b><span>taken by duplicated files</span></div>
+<div class="total"><b>{{bytes .Reclaimable}}</b><span>reclaimable keeping one copy each</span></div>
+<div class="total"><b>{{len .Errors}}</b><span>errors</span></div>
+</div>
+{{if .Roots}}<p class="paths">Scanned: {{range $i, $r := .Roots}}{{if $i}}, {{end}}{{$r}}{{end}}</p>{{end}}
+{{if .References}}<p class="paths">References: {{range $i, $r := .References}}{{if $i}}, {{end}}{{$r}}{{end}}</p>{{end}}
+</section>
+
+<section>
+<h2>Wasted space by directory</h2>
+<div id="crumbs"></div>
+<div id="treemap"></div>
+</section>
+
+<section>
+<h2>Groups</h2>
+<input id="search" type="search" placeholder="Filter by path" autocomplete="off">
+<p id="shown" class="paths"></p>
+<div id="groups">
+{{range .Groups}}<details data-search="{{.Search}}">
+<summary><span class="size">{{bytes .Reclaimable}}</span> {{len .Files}} copies of {{bytes .Size}} <span class="sum">{{short .Checksum}}</span></summary>
+<ul class="paths">{{range .Files}}<li{{if .Reference}} class="ref"{{end}}>{{.Path}}</li>{{end}}</ul>
+</details>
+{{end}}</div>
+</section>
+
+{{if .Errors}}<section class="errors">
+<h2>Errors</h2>
+<ul>{{range .Errors}}<li>{{.}}</li>{{end}}</ul>
+</section>{{end}}
+</main>
+
+<script>
+(function () {
+	var tree = {{.Tree}};
+
+	function human(n) {
+		var units = ["B", "KiB", "MiB", "GiB", "TiB", "PiB"], i = 0;
+		while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+		return (i ? n.toFixed(1) : n) + " " + units[i];
+	}
+
+	function color(name) {
+		var h = 0;
+		for (var i = 0; i < name.length; i++) { h = (h * 31 + name.charCodeAt(i)) % 360; }
+		return "hsl(" + h + ", 45%, 45%)";
+	}
+
+	// squarify lays out the items (sorted by size, largest first) in the rectangle, keeping the
+	// rectangles as close to squares as possible.
+	function squarify(items, x, y, w, h, out) {
+		var total = 0;
+		items.forEach(function (it) { total += it.size; });
+		while (items.length) {
+			var vertical = w >= h, side = vertical ? h : w, row = [], rowSize = 0, best = Infinity;
+			var scale = (w * h) / total;
+			for (var i = 0; i < items.length; i++) {
+				var s = rowSize + items[i].size, area = s * scale, thick = area / side;
+				var worst = 0;
+				row.concat([items[i]]).forEach(function (it) {
+					var len = it.size * scale / thick;
+					worst = Math.max(worst, Math.max(len / thick, thick / len));
+				});
+				if (worst > best) { break; }
+				best = worst; row.push(items[i]); rowSize = s;
+			}
+			var thickness = rowSize * scale / side, offset = 0;
+			row.forEach(function (it) {
+				var len = it.size * scale / thickness;
+				out.push(vertical ? {item: it, x: x, y: y + offset, w: thickness, h: len}
+					: {item: it, x: x + offset, y: y, w: len, h: thickness});
+				offset += len;
+			});
+			if (vertical) { x += thickness; w -= thickness; } else { y += thickness; h -= thickness; }
+			total -= rowSize;
+			items = items.slice(row.length);
+		}
+		return out;
+	}
+
+	var map = document.getElementById("treemap"), crumbs = document.getElementById("crumbs"), path = [tree];
+
+	function render() {
+		var node = path[path.length - 1];
+		map.innerHTML = "";
+		crumbs.innerHTML = "";
+		path.forEach(function (n, i) {
+			var a = document.createElement(i === path.length - 1 ? "span" : "a");
+			a.textContent = n.name + " (" + human(n.size) + ")";
+			a.onclick = function () { path = path.slice(0, i + 1); render(); };
+			crumbs.appendChild(a);
+			if (i < path.length - 1) { crumbs.appendChild(document.createTextNode(" / ")); }
+		});
+
+		var items = (node.children || []).filter(function (c) { return c.size > 0; });
+		if (node.own > 0) { items.push({name: "(files in " + node.name + ")", size: node.own, files: true}); }
+		items.sort(function (a, b) { return b.size - a.size; });
+		if (!items.length) { map.textContent = "No wasted space."; return; }
+
+		squarify(items, 0, 0, map.clientWidth, map.clientHeight, []).forEach(function (r) {
+			var d = document.createElement("div");
+			d.style.left = r.x + "px"; d.style.top = r.y + "px";
+			d.style.width = r.w + "px"; d.style.height = r.h + "px";
+			d.style.background = color(r.item.name);
+			d.textContent = r.item.name + " " + human(r.item.size);
+			d.title = d.textContent;
+			if (r.item.files) {
+				d.className = "files";
+			} else {
+				d.onclick = function () { path.push(r.item); render(); };
+			}
+			map.appendChild(d);
+		});
+	}
+
+	var search = document.getElementById("search"), shown = document.getElementById("shown");
+	var groups = document.querySelectorAll("#groups details");
+
+	function filter() {
+		var q = search.value.toLowerCase(), count = 0;
+		groups.forEach(function (g) {
+			var match = !q || g.getAttribute("data-search").indexOf(q) >= 0;
+			g.style.display = match ? "" : "none";
+			if (match) { count++; }
+		});
+		shown.textContent = count + " of " + groups.length + " groups";
+	}
+
+	search.addEventListener("input", filter);
+	window.addEventListener("resize", render);
+	filter();
+	render();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,63 @@
+package dedupe
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHTMLWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		dupes   map[string][]string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "groups",
+			dupes: map[string][]string{"abc": {"/a/x", "/b/x"}, "def": {"/a/y", "/c/y", "/d/y"}},
+			want:  []string{"/a/x", "/b/x", "/a/y", "/d/y", `"name":"/"`},
+		},
+		{
+			name:    "single file groups are skipped",
+			dupes:   map[string][]string{"abc": {"/a/only"}, "def": {"rel/x", "rel/y"}},
+			want:    []string{"rel/x", "rel/y"},
+			notWant: []string{"/a/only"},
+		},
+		{
+			name:    "empty groups are skipped",
+			dupes:   map[string][]string{"c0ffee": {}, "decaf": nil},
+			notWant: []string{"c0ffee", "decaf"},
+		},
+		{name: "empty report", dupes: map[string][]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sizes := map[string]int64{}
+			for checksum := range tt.dupes {
+				sizes[checksum] = 10
+			}
+			report := &DupeReport{Dupes: tt.dupes, Sizes: sizes}
+
+			var buf bytes.Buffer
+			w, err := NewReportWriter(FormatHTML)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Write(&buf, report); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("the page does not contain %q", s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(buf.String(), s) {
+					t.Errorf("the page contains %q", s)
+				}
+			}
+		})
+	}
+}
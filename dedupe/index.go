@@ -0,0 +1,266 @@
+package dedupe
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pathTable is a compact, append-only store of file paths. Directories are interned so they are kept only
+// once, and each file is encoded in a shared arena as a varint directory id followed by its length-prefixed
+// name, so a file costs its name plus a few bytes instead of a full path string.
+type pathTable struct {
+	// prefixes holds, for each directory, what is prepended to the names of its files to get their path.
+	prefixes []string
+	dirIDs   map[string]uint32
+	arena    []byte
+	dirMem   int64
+}
+
+func (t *pathTable) add(dir, name string) uint64 {
+	if t.dirIDs == nil {
+		t.dirIDs = map[string]uint32{}
+	}
+	id, ok := t.dirIDs[dir]
+	if !ok {
+		id = uint32(len(t.prefixes))
+		t.prefixes = append(t.prefixes, pathPrefix(dir))
+		t.dirIDs[dir] = id
+		t.dirMem += int64(len(dir))*2 + 48
+	}
+
+	ref := uint64(len(t.arena))
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(id))
+	t.arena = append(t.arena, buf[:n]...)
+	n = binary.PutUvarint(buf[:], uint64(len(name)))
+	t.arena = append(t.arena, buf[:n]...)
+	t.arena = append(t.arena, name...)
+	return ref
+}
+
+func (t *pathTable) get(ref uint64) string {
+	return string(t.appendPath(nil, ref))
+}
+
+// appendPath appends the path of the file to buf, so paths can be read without allocating each of them.
+func (t *pathTable) appendPath(buf []byte, ref uint64) []byte {
+	b := t.arena[ref:]
+	id, n := binary.Uvarint(b)
+	b = b[n:]
+	l, n := binary.Uvarint(b)
+	b = b[n:]
+	return append(append(buf, t.prefixes[id]...), b[:l]...)
+}
+
+// pathPrefix returns what joining the directory with a file name prepends to the name.
+func pathPrefix(dir string) string {
+	const name = "f"
+	return strings.TrimSuffix(filepath.Join(dir, name), name)
+}
+
+func (t *pathTable) memSize() int64 {
+	return int64(cap(t.arena)) + t.dirMem
+}
+
+func (t *pathTable) reset() {
+	*t = pathTable{}
+}
+
+// sizeIndex groups the scanned files by size. When a memory limit is set and the index grows beyond it,
+// its contents are spilled to a sorted run on disk and merged back when iterating.
+type sizeIndex struct {
+	paths   pathTable
+	buckets map[int64][]uint64
+	refs    int64
+	runs    runSet
+	limit   int64
+}
+
+func newSizeIndex(limit int64, tempDir string) *sizeIndex {
+	return &sizeIndex{
+		buckets: map[int64][]uint64{},
+		runs:    runSet{dir: tempDir},
+		limit:   limit,
+	}
+}
+
+func (x *sizeIndex) memSize() int64 {
+	return x.paths.memSize() + x.refs*8 + int64(len(x.buckets))*64
+}
+
+// add registers a file and returns the number of files currently held in memory with the same size.
+func (x *sizeIndex) add(dir, name string, size int64) (int, error) {
+	x.buckets[size] = append(x.buckets[size], x.paths.add(dir, name))
+	x.refs++
+
+	count := len(x.buckets[size])
+	if x.limit > 0 && x.memSize() > x.limit {
+		return count, x.spill()
+	}
+	return count, nil
+}
+
+func (x *sizeIndex) bucket(size int64) []string {
+	var ret []string
+	for _, ref := range x.buckets[size] {
+		ret = append(ret, x.paths.get(ref))
+	}
+	return ret
+}
+
+// spill writes the index to a run sorted by size, streaming the paths straight from the arena so the
+// index never takes more memory than its limit.
+func (x *sizeIndex) spill() error {
+	sizes := make([]int64, 0, len(x.buckets))
+	for size := range x.buckets {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return uint64(sizes[i]) < uint64(sizes[j]) })
+
+	var buf []byte
+	err := x.runs.write(func(emit func(key string, path []byte) error) error {
+		for _, size := range sizes {
+			key := sizeKey(size)
+			for _, ref := range x.buckets[size] {
+				buf = x.paths.appendPath(buf[:0], ref)
+				if err := emit(key, buf); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		x.limit = 0
+		return err
+	}
+
+	x.buckets = map[int64][]uint64{}
+	x.refs = 0
+	x.paths.reset()
+	return nil
+}
+
+// each invokes fn for every size shared by more than one file.
+func (x *sizeIndex) each(fn func(size int64, files []string) error) error {
+	return x.eachSize(func(size int64, files []string) error {
+		if len(files) <= 1 {
+			return nil
+		}
+		return fn(size, files)
+	})
+}
+
+// eachSize invokes fn for every distinct size with all the files of that size.
+func (x *sizeIndex) eachSize(fn func(size int64, files []string) error) error {
+	defer x.runs.remove()
+
+	if x.runs.empty() {
+		for size := range x.buckets {
+			if err := fn(size, x.bucket(size)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := x.spill(); err != nil {
+		return err
+	}
+	return x.runs.groups(func(key string, files []string) error {
+		return fn(int64(binary.BigEndian.Uint64([]byte(key))), files)
+	})
+}
+
+func sizeKey(size int64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(size))
+	return string(buf[:])
+}
+
+// hashIndex groups files by checksum, spilling to sorted runs on disk the same way sizeIndex does.
+type hashIndex struct {
+	groups map[string][]string
+	mem    int64
+	runs   runSet
+	limit  int64
+}
+
+func newHashIndex(limit int64, tempDir string) *hashIndex {
+	return &hashIndex{
+		groups: map[string][]string{},
+		runs:   runSet{dir: tempDir},
+		limit:  limit,
+	}
+}
+
+func (x *hashIndex) add(checksum, file string) error {
+	if _, ok := x.groups[checksum]; !ok {
+		x.mem += int64(len(checksum)) + 64
+	}
+	x.groups[checksum] = append(x.groups[checksum], file)
+	x.mem += int64(len(file)) + 16
+
+	if x.limit > 0 && x.mem > x.limit {
+		return x.spill()
+	}
+	return nil
+}
+
+func (x *hashIndex) spill() error {
+	checksums := make([]string, 0, len(x.groups))
+	for checksum := range x.groups {
+		checksums = append(checksums, checksum)
+	}
+	sort.Strings(checksums)
+
+	var buf []byte
+	err := x.runs.write(func(emit func(key string, path []byte) error) error {
+		for _, checksum := range checksums {
+			for _, f := range x.groups[checksum] {
+				buf = append(buf[:0], f...)
+				if err := emit(checksum, buf); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		x.limit = 0
+		return err
+	}
+
+	x.groups = map[string][]string{}
+	x.mem = 0
+	return nil
+}
+
+// each invokes fn for every checksum shared by more than one file.
+func (x *hashIndex) each(fn func(checksum string, files []string) error) error {
+	defer x.runs.remove()
+
+	if x.runs.empty() {
+		for checksum, files := range x.groups {
+			if len(files) <= 1 {
+				continue
+			}
+			if err := fn(checksum, files); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := x.spill(); err != nil {
+		return err
+	}
+	return x.runs.groups(func(checksum string, files []string) error {
+		if len(files) <= 1 {
+			return nil
+		}
+		return fn(checksum, files)
+	})
+}
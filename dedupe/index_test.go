@@ -0,0 +1,223 @@
+package dedupe
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPathTable(t *testing.T) {
+	tests := []struct{ dir, name string }{
+		{"a/b", "x"},
+		{".", "x"},
+		{"./a", "x"},
+		{"/", "x"},
+		{"/a/b/", "x"},
+		{"a/../b", "x y"},
+	}
+
+	table := &pathTable{}
+	var refs []uint64
+	for _, tt := range tests {
+		refs = append(refs, table.add(tt.dir, tt.name))
+	}
+	for i, tt := range tests {
+		if got, want := table.get(refs[i]), filepath.Join(tt.dir, tt.name); got != want {
+			t.Errorf("get(%q, %q) = %q, want %q", tt.dir, tt.name, got, want)
+		}
+	}
+}
+
+// testFiles returns files spread over a few directories with sizes shared by some of them.
+func testFiles() (dirs, names []string, sizes []int64) {
+	for i := 0; i < 200; i++ {
+		dirs = append(dirs, fmt.Sprintf("root/d%d", i%7))
+		names = append(names, fmt.Sprintf("f%03d", i))
+		sizes = append(sizes, int64(i%23)*1000)
+	}
+	return dirs, names, sizes
+}
+
+func TestSizeIndexSpill(t *testing.T) {
+	dirs, names, sizes := testFiles()
+	want := map[int64][]string{}
+	for i := range names {
+		want[sizes[i]] = append(want[sizes[i]], filepath.Join(dirs[i], names[i]))
+	}
+
+	tests := []struct {
+		name      string
+		limit     int64
+		minSpills int
+	}{
+		{name: "in memory", limit: 0},
+		{name: "spills on every file", limit: 1, minSpills: len(names)},
+		{name: "spills a few times", limit: 1024, minSpills: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := newSizeIndex(tt.limit, t.TempDir())
+			for i := range names {
+				if _, err := x.add(dirs[i], names[i], sizes[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(x.runs.files) < tt.minSpills || (tt.minSpills == 0 && !x.runs.empty()) {
+				t.Errorf("%d runs spilled, want at least %d", len(x.runs.files), tt.minSpills)
+			}
+			runs := append([]string{}, x.runs.files...)
+
+			got := map[int64][]string{}
+			err := x.eachSize(func(size int64, files []string) error {
+				if _, ok := got[size]; ok {
+					t.Errorf("size %d visited twice", size)
+				}
+				got[size] = sortedCopy(files)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for size := range want {
+				sort.Strings(want[size])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("eachSize() = %v, want %v", got, want)
+			}
+			for _, f := range runs {
+				if exists(f) {
+					t.Errorf("run %s was not removed", f)
+				}
+			}
+		})
+	}
+}
+
+func TestHashIndexSpill(t *testing.T) {
+	_, names, _ := testFiles()
+	want := map[string][]string{}
+	for i, name := range names {
+		sum := fmt.Sprintf("%02x", i%31)
+		want[sum] = append(want[sum], name)
+	}
+
+	for _, limit := range []int64{0, 1, 512} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			x := newHashIndex(limit, t.TempDir())
+			for sum, files := range want {
+				for _, f := range files {
+					if err := x.add(sum, f); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if limit > 0 && len(x.runs.files) < 2 {
+				t.Errorf("%d runs spilled, want several", len(x.runs.files))
+			}
+
+			got := map[string][]string{}
+			if err := x.each(func(sum string, files []string) error {
+				got[sum] = sortedCopy(files)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			for sum := range want {
+				sort.Strings(want[sum])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("each() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRunSetGroups(t *testing.T) {
+	runs := [][][2]string{
+		{{"a", "1"}, {"b", "2"}, {"d", "3"}},
+		{{"a", "4"}, {"c", "5"}},
+		{},
+		{{"b", "6"}, {"d", "7"}, {"d", "8"}, {"e", "9"}},
+	}
+	want := map[string][]string{
+		"a": {"1", "4"},
+		"b": {"2", "6"},
+		"c": {"5"},
+		"d": {"3", "7", "8"},
+		"e": {"9"},
+	}
+
+	r := &runSet{dir: t.TempDir()}
+	defer r.remove()
+	for _, run := range runs {
+		err := r.write(func(emit func(key string, path []byte) error) error {
+			for _, rec := range run {
+				if err := emit(rec[0], []byte(rec[1])); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := map[string][]string{}
+	var keys []string
+	if err := r.groups(func(key string, paths []string) error {
+		keys = append(keys, key)
+		got[key] = sortedCopy(paths)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups() = %v, want %v", got, want)
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("groups() visited the keys out of order: %v", keys)
+	}
+}
+
+func TestFindDupesMemoryLimit(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 60; i++ {
+		writeFile(t, filepath.Join(root, fmt.Sprintf("d%d", i%5), fmt.Sprintf("f%02d", i)), fmt.Sprintf("contents %d", i%17), past)
+	}
+
+	scan := func(limit int64) map[string][]string {
+		s := New()
+		s.SetOptions(&Options{Recursive: true, Mode: HashSHA256, MemoryLimit: limit, TempDir: t.TempDir()})
+		report, err := s.FindDupes(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Errors) > 0 {
+			t.Fatal(report.Errors)
+		}
+		for _, files := range report.Dupes {
+			sort.Strings(files)
+		}
+		return report.Dupes
+	}
+
+	want := scan(0)
+	if len(want) != 17 {
+		t.Fatalf("found %d groups, want 17", len(want))
+	}
+	for _, limit := range []int64{1, 2048} {
+		if got := scan(limit); !reflect.DeepEqual(got, want) {
+			t.Errorf("with a memory limit of %d, FindDupes() = %v, want %v", limit, got, want)
+		}
+	}
+}
+
+func sortedCopy(files []string) []string {
+	ret := append([]string{}, files...)
+	sort.Strings(ret)
+	return ret
+}
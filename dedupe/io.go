@@ -0,0 +1,90 @@
+package dedupe
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+const (
+	// IOBuffered reads files through the regular page cache.
+	IOBuffered = IOMode("buffered")
+	// IONoCache reads files with large aligned buffers and advises the kernel to drop the pages once read,
+	// so hashing huge trees does not evict the page cache of other processes.
+	IONoCache = IOMode("nocache")
+	// IODirect bypasses the page cache entirely with direct I/O where the platform and filesystem support
+	// it, and falls back to IONoCache otherwise.
+	IODirect = IOMode("direct")
+
+	defaultBufferSize = 1 << 20
+	ioAlignment       = 4096
+)
+
+type IOMode string
+
+// ParseIOMode parses an I/O mode, an empty string being IOBuffered.
+func ParseIOMode(mode string) (IOMode, error) {
+	switch m := IOMode(strings.ToLower(mode)); m {
+	case "":
+		return IOBuffered, nil
+	case IOBuffered, IONoCache, IODirect:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown I/O mode '%s', expected %s, %s or %s", mode, IOBuffered, IONoCache, IODirect)
+}
+
+func (s *service) bufferSize() int {
+	size := s.options.BufferSize
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	if r := size % ioAlignment; r != 0 {
+		size += ioAlignment - r
+	}
+	return size
+}
+
+// readInto copies the contents of f into w honoring the configured IOMode.
+func (s *service) readInto(w io.Writer, f *os.File, mode IOMode) error {
+	switch mode {
+	case "", IOBuffered:
+		_, err := io.Copy(w, f)
+		return err
+	case IONoCache, IODirect:
+	default:
+		return fmt.Errorf("unknown I/O mode '%s'", mode)
+	}
+
+	buf := alignedBuffer(s.bufferSize())
+	var offset int64
+
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if _, e := w.Write(buf[:n]); e != nil {
+				return e
+			}
+			dropCache(f, offset, int64(n))
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// alignedBuffer returns a buffer of the given size whose first byte is aligned to ioAlignment, as
+// required by direct I/O.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+ioAlignment)
+	offset := 0
+	if r := int(uintptr(unsafe.Pointer(&buf[0])) & (ioAlignment - 1)); r != 0 {
+		offset = ioAlignment - r
+	}
+	return buf[offset : offset+size]
+}
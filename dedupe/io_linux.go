@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package dedupe
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func openForHash(file string, mode IOMode) (*os.File, IOMode, error) {
+	if mode == IODirect {
+		if f, err := os.OpenFile(file, os.O_RDONLY|syscall.O_DIRECT, 0); err == nil {
+			return f, IODirect, nil
+		}
+		mode = IONoCache
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, mode, err
+	}
+	if mode == IONoCache {
+		_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+	}
+	return f, mode, nil
+}
+
+func dropCache(f *os.File, offset, length int64) {
+	_ = unix.Fadvise(int(f.Fd()), offset, length, unix.FADV_DONTNEED)
+}
+
+func isDirectIOUnsupported(err error) bool {
+	return errors.Is(err, syscall.EINVAL)
+}
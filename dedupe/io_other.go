@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package dedupe
+
+import "os"
+
+func openForHash(file string, mode IOMode) (*os.File, IOMode, error) {
+	if mode == IODirect {
+		mode = IONoCache
+	}
+	f, err := os.Open(file)
+	return f, mode, err
+}
+
+func dropCache(*os.File, int64, int64) {}
+
+func isDirectIOUnsupported(error) bool {
+	return false
+}
@@ -0,0 +1,95 @@
+package dedupe
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const benchFileSize = 64 << 20
+
+func benchmarkHash(b *testing.B, mode IOMode) {
+	file := filepath.Join(b.TempDir(), "data.bin")
+	data := make([]byte, benchFileSize)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	s := &service{options: &Options{Mode: HashSHA256, IOMode: mode}}
+	b.SetBytes(benchFileSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := s.getHash(file); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHashBuffered(b *testing.B) { benchmarkHash(b, IOBuffered) }
+func BenchmarkHashNoCache(b *testing.B)  { benchmarkHash(b, IONoCache) }
+func BenchmarkHashDirect(b *testing.B)   { benchmarkHash(b, IODirect) }
+
+func TestParseIOMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    IOMode
+		wantErr bool
+	}{
+		{input: "", want: IOBuffered},
+		{input: "buffered", want: IOBuffered},
+		{input: "nocache", want: IONoCache},
+		{input: "Direct", want: IODirect},
+		{input: "no-cache", wantErr: true},
+		{input: "mmap", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseIOMode(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseIOMode(%q) = %q, %v, want %q, wantErr %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHashIOModes(t *testing.T) {
+	data := make([]byte, 3*defaultBufferSize+123)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	tests := []struct {
+		mode    IOMode
+		wantErr bool
+	}{
+		{mode: ""},
+		{mode: IOBuffered},
+		{mode: IONoCache},
+		{mode: IODirect},
+		{mode: IOMode("mmap"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			s := &service{options: &Options{Mode: HashSHA256, IOMode: tt.mode}}
+			got, err := s.getHash(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getHash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != want {
+				t.Errorf("getHash() = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package dedupe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// JournalPending is an action recorded right before it was applied, that has no outcome yet. It may
+	// or may not have been applied if dedupe was interrupted.
+	JournalPending = JournalStatus("pending")
+	JournalDone    = JournalStatus("done")
+	JournalFailed  = JournalStatus("failed")
+)
+
+// JournalStatus is the outcome of a journaled action.
+type JournalStatus string
+
+// JournalEntry is the record of an action applied by the resolver, with everything needed to undo it:
+// the survivor the duplicate was removed in favor of, the expected checksum, and the metadata the
+// duplicate had before the action. Entries written before outcomes were recorded have no status, and are
+// considered done.
+type JournalEntry struct {
+	Time      time.Time
+	Action    ActionType
+	Keep      string
+	Target    string
+	Checksum  string   `json:",omitempty"`
+	Algorithm HashMode `json:",omitempty"`
+	Size      int64
+	Mode      os.FileMode
+	ModTime   time.Time
+	Status    JournalStatus `json:",omitempty"`
+	Error     string        `json:",omitempty"`
+	// Location is where the target was moved to by a quarantine or trash action.
+	Location string `json:",omitempty"`
+	// Quarantine is the quarantine directory of a quarantine action.
+	Quarantine string `json:",omitempty"`
+}
+
+// Applied indicates whether the action of the entry may have been applied, i.e. it did not fail.
+func (e *JournalEntry) Applied() bool {
+	return e.Status != JournalFailed
+}
+
+// Journal is an append-only log of applied actions, one JSON entry per line.
+type Journal struct {
+	mu        sync.Mutex
+	f         *os.File
+	algorithm HashMode
+}
+
+// OpenJournal opens the journal file for appending, creating it if it does not exist. The algorithm is
+// the one the checksums of the recorded actions were calculated with.
+func OpenJournal(file string, algorithm HashMode) (*Journal, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open journal %s, %s", file, err.Error())
+	}
+	return &Journal{f: f, algorithm: algorithm}, nil
+}
+
+// Record appends an action about to be applied to the journal as pending, given the current metadata of its
+// target. Each entry is synced to disk before returning, so no action is ever applied without being
+// journaled. Its outcome is recorded with Finish once the action was applied.
+func (j *Journal) Record(action *Action, info os.FileInfo) (*JournalEntry, error) {
+	entry := &JournalEntry{
+		Time:      time.Now(),
+		Action:    action.Type,
+		Keep:      absPath(action.Keep),
+		Target:    absPath(action.Target),
+		Checksum:  action.Checksum,
+		Algorithm: j.algorithm,
+		Size:      info.Size(),
+		Mode:      info.Mode(),
+		ModTime:   info.ModTime(),
+		Status:    JournalPending,
+	}
+	if entry.Algorithm == "" {
+		entry.Algorithm = HashSHA256
+	}
+	return entry, j.write(entry)
+}
+
+// Finish records the outcome of the action of a pending entry, and where its target was moved to if it
+// was.
+func (j *Journal) Finish(entry *JournalEntry, location string, err error) error {
+	entry.Location = location
+	entry.Status = JournalDone
+	if err != nil {
+		entry.Status = JournalFailed
+		entry.Error = err.Error()
+	}
+	return j.write(entry)
+}
+
+func (j *Journal) write(entry *JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal journal entry, %s", err.Error())
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("unable to write journal %s, %s", j.f.Name(), err.Error())
+	}
+	return j.f.Sync()
+}
+
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// ReadJournal reads all the entries of a journal file, in the order they were recorded. The outcome of an
+// action replaces its pending entry.
+func ReadJournal(file string) ([]*JournalEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read journal %s, %s", file, err.Error())
+	}
+	defer f.Close()
+
+	var ret []*JournalEntry
+	pending := map[string]int{}
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if len(data) > 0 && len(bytes.TrimSpace(data)) > 0 {
+			entry := &JournalEntry{}
+			if e := json.Unmarshal(data, entry); e != nil {
+				return nil, fmt.Errorf("invalid journal entry at %s:%d, %s", file, line, e.Error())
+			}
+			key := entry.Time.Format(time.RFC3339Nano) + "\x00" + entry.Target
+			if i, ok := pending[key]; ok && entry.Status != JournalPending {
+				ret[i] = entry
+				delete(pending, key)
+				continue
+			}
+			if entry.Status == JournalPending {
+				pending[key] = len(ret)
+			}
+			ret = append(ret, entry)
+		}
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read journal %s, %s", file, err.Error())
+		}
+	}
+}
+
+// Undo reverts a journaled action. Quarantined and trashed files are moved back from the quarantine or the
+// trash. Otherwise, or if they are no longer there, the duplicate is recreated as an independent copy of
+// the survivor, with its original mode and modification time. The survivor must still have the recorded
+// checksum, and the target must still be in the state the action left it in.
+func Undo(entry *JournalEntry) error {
+	info, err := os.Lstat(entry.Target)
+
+	switch entry.Action {
+	case ActionDelete, ActionQuarantine, ActionTrash:
+		if err == nil {
+			return fmt.Errorf("unable to restore %s, a file already exists at that path", entry.Target)
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("unable to read file info of %s, %s", entry.Target, err.Error())
+		}
+	case ActionSymlink:
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("unable to restore %s, it is no longer the symbolic link created by dedupe", entry.Target)
+		}
+	case ActionHardlink:
+		if err != nil || !sameFile(entry.Target, entry.Keep) {
+			return fmt.Errorf("unable to restore %s, it is no longer a hard link to %s", entry.Target, entry.Keep)
+		}
+	default:
+		return fmt.Errorf("unable to undo unknown action '%s'", entry.Action)
+	}
+
+	switch {
+	case entry.Action == ActionQuarantine:
+		if restored, err := restoreQuarantined(entry); restored || err != nil {
+			return err
+		}
+	case entry.Action == ActionTrash && entry.Location != "":
+		if _, err := os.Lstat(entry.Location); err == nil {
+			return Untrash(entry.Location, entry.Target)
+		}
+	}
+
+	if entry.Keep == "" {
+		return fmt.Errorf("unable to restore %s, the whole group was deleted and there is no copy left", entry.Target)
+	}
+	return restoreCopy(entry)
+}
+
+// restoreQuarantined moves the quarantined target of the entry back and removes it from the manifest of
+// the quarantine. It returns false if the file is no longer in quarantine.
+func restoreQuarantined(entry *JournalEntry) (bool, error) {
+	if entry.Quarantine == "" || entry.Location == "" {
+		return false, nil
+	}
+	if _, err := os.Stat(entry.Quarantine); err != nil {
+		return false, nil
+	}
+	q, err := OpenQuarantine(entry.Quarantine, entry.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	entries, err := q.Entries()
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if filepath.Join(q.Dir(), e.Stored) == entry.Location && e.Original == entry.Target {
+			_, err := q.Restore([]*QuarantineEntry{e})
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// restoreCopy copies the survivor to a temporary file next to the target, checking its checksum on the
+// way, and renames it over the target once its metadata is restored.
+func restoreCopy(entry *JournalEntry) error {
+	src, err := os.Open(entry.Keep)
+	if err != nil {
+		return fmt.Errorf("unable to read survivor %s, %s", entry.Keep, err.Error())
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(entry.Target), ".dedupe-"+filepath.Base(entry.Target)+"-*")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file next to %s, %s", entry.Target, err.Error())
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	h := (&service{options: &Options{Mode: entry.Algorithm}}).getHasher()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), src); err != nil {
+		return fmt.Errorf("unable to copy %s, %s", entry.Keep, err.Error())
+	}
+	if checksum := fmt.Sprintf("%x", h.Sum(nil)); entry.Checksum != "" && checksum != entry.Checksum {
+		return fmt.Errorf("unable to restore %s, the survivor %s no longer has the recorded checksum", entry.Target, entry.Keep)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("unable to write %s, %s", tmp.Name(), err.Error())
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write %s, %s", tmp.Name(), err.Error())
+	}
+	if err := os.Chmod(tmp.Name(), entry.Mode.Perm()); err != nil {
+		return fmt.Errorf("unable to restore the mode of %s, %s", entry.Target, err.Error())
+	}
+	if err := os.Chtimes(tmp.Name(), entry.ModTime, entry.ModTime); err != nil {
+		return fmt.Errorf("unable to restore the timestamps of %s, %s", entry.Target, err.Error())
+	}
+	if err := os.Rename(tmp.Name(), entry.Target); err != nil {
+		return fmt.Errorf("unable to restore %s, %s", entry.Target, err.Error())
+	}
+	committed = true
+	return nil
+}
+
+func absPath(file string) string {
+	if file == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
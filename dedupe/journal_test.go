@@ -0,0 +1,234 @@
+package dedupe
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalOutcomes(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "journal.jsonl")
+	info := func(f string) os.FileInfo {
+		fi, err := os.Lstat(writeFile(t, f, "data", past))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi
+	}
+
+	j, err := OpenJournal(file, HashSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := j.Record(&Action{Type: ActionDelete, Keep: "k", Target: filepath.Join(dir, "done")}, info(filepath.Join(dir, "done")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, err := j.Record(&Action{Type: ActionDelete, Keep: "k", Target: filepath.Join(dir, "failed")}, info(filepath.Join(dir, "failed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.Record(&Action{Type: ActionSymlink, Keep: "k", Target: filepath.Join(dir, "pending")}, info(filepath.Join(dir, "pending"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Finish(failed, "", errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Finish(done, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	entries, err := ReadJournal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		target  string
+		status  JournalStatus
+		applied bool
+	}{
+		{"done", JournalDone, true},
+		{"failed", JournalFailed, false},
+		{"pending", JournalPending, true},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("ReadJournal() returned %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if filepath.Base(e.Target) != w.target || e.Status != w.status || e.Applied() != w.applied {
+			t.Errorf("entry %d = %s %s (applied %v), want %s %s (applied %v)", i, e.Target, e.Status, e.Applied(), w.target, w.status, w.applied)
+		}
+	}
+	if entries[1].Error != "boom" {
+		t.Errorf("failed entry error = %q", entries[1].Error)
+	}
+}
+
+func TestResolverJournalsOutcome(t *testing.T) {
+	dir := t.TempDir()
+	keep := writeFile(t, filepath.Join(dir, "a"), "data", past)
+	target := writeFile(t, filepath.Join(dir, "b"), "data", past)
+	file := filepath.Join(dir, "journal.jsonl")
+
+	j, err := OpenJournal(file, HashSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver()
+	r.SetOptions(&ResolverOptions{Journal: j})
+	if res := r.Apply(&Action{Type: ActionDelete, Keep: keep, Target: target}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	// Unknown actions pass the preflight but fail when applied.
+	if res := r.Apply(&Action{Type: ActionType("shred"), Keep: keep, Target: writeFile(t, target, "data", past)}); res.Err == nil {
+		t.Fatal("expected the unknown action to fail")
+	}
+	j.Close()
+
+	entries, err := ReadJournal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Status != JournalDone || entries[1].Status != JournalFailed {
+		t.Fatalf("ReadJournal() = %+v", entries)
+	}
+}
+
+// applyJournaled applies the action with a resolver journaling to a new journal, and returns the entry
+// recorded for it.
+func applyJournaled(t *testing.T, opts *ResolverOptions, action *Action) *JournalEntry {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := OpenJournal(file, HashSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Journal = j
+	r := NewResolver()
+	r.SetOptions(opts)
+	res := r.Apply(action)
+	j.Close()
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	entries, err := ReadJournal(file)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadJournal() = %v, %v", entries, err)
+	}
+	return entries[0]
+}
+
+func TestUndo(t *testing.T) {
+	tests := []struct {
+		action  ActionType
+		keep    bool
+		wantErr bool
+	}{
+		{action: ActionDelete, keep: true},
+		{action: ActionDelete, keep: false, wantErr: true},
+		{action: ActionSymlink, keep: true},
+		{action: ActionHardlink, keep: true},
+		{action: ActionQuarantine, keep: true},
+		{action: ActionQuarantine, keep: false},
+		{action: ActionTrash, keep: true},
+		{action: ActionTrash, keep: false},
+	}
+
+	for _, tt := range tests {
+		name := string(tt.action)
+		if !tt.keep {
+			name += " without a kept file"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			keep := writeFile(t, filepath.Join(dir, "a"), "data", past)
+			target := writeFile(t, filepath.Join(dir, "b"), "data", past)
+			if err := os.Chmod(target, 0600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+			if tt.action == ActionTrash && !trashSupported() {
+				t.Skip("the trash is not supported on this system")
+			}
+
+			opts := &ResolverOptions{Mode: HashSHA256}
+			if tt.action == ActionQuarantine {
+				q, err := OpenQuarantine(filepath.Join(dir, "quarantine"), HashSHA256)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts.Quarantine = q
+			}
+			action := &Action{Type: tt.action, Target: target, Checksum: sha256Of("data")}
+			if tt.keep {
+				action.Keep = keep
+			}
+			entry := applyJournaled(t, opts, action)
+
+			err := Undo(entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Undo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			info, err := os.Lstat(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Mode().IsRegular() || info.Mode().Perm() != 0600 || !info.ModTime().Equal(past) {
+				t.Errorf("restored file mode = %v, modTime = %v", info.Mode(), info.ModTime())
+			}
+			if sameFile(target, keep) {
+				t.Errorf("restored file is still linked to %s", keep)
+			}
+			if got := readFile(t, target); got != "data" {
+				t.Errorf("restored contents = %q", got)
+			}
+
+			if tt.action == ActionTrash {
+				infoFile := filepath.Join(dir, "data", "Trash", "info", filepath.Base(entry.Location)+".trashinfo")
+				if exists(entry.Location) || exists(infoFile) {
+					t.Errorf("the trash still holds %s", entry.Location)
+				}
+			}
+			if opts.Quarantine != nil {
+				left, err := opts.Quarantine.Entries()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(left) != 0 || exists(entry.Location) {
+					t.Errorf("the quarantine still holds %v", left)
+				}
+			}
+		})
+	}
+}
+
+func trashSupported() bool {
+	err := Untrash(filepath.Join(os.TempDir(), "dedupe-missing"), filepath.Join(os.TempDir(), "dedupe-missing"))
+	return err == nil || !strings.Contains(err.Error(), "not supported")
+}
+
+func TestUndoChangedSurvivor(t *testing.T) {
+	dir := t.TempDir()
+	keep := writeFile(t, filepath.Join(dir, "a"), "data", past)
+	target := writeFile(t, filepath.Join(dir, "b"), "data", past)
+	entry := applyJournaled(t, &ResolverOptions{}, &Action{Type: ActionDelete, Keep: keep, Target: target, Checksum: sha256Of("data")})
+
+	writeFile(t, keep, "DATA", past)
+	if err := Undo(entry); err == nil {
+		t.Fatal("Undo() restored a copy of a survivor with a different checksum")
+	}
+	if exists(target) {
+		t.Errorf("%s was restored", target)
+	}
+}
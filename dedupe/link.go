@@ -0,0 +1,66 @@
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrCrossDevice is returned when a hard link is requested between files on different devices.
+var ErrCrossDevice = errors.New("files are on different devices")
+
+// Hardlink replaces dupe with a hard link to keep. The link is created under a temporary name next to
+// dupe and renamed over it, so dupe is never missing even if the operation fails halfway. It refuses to
+// link files on different devices. The returned value is the number of bytes actually freed, which is
+// zero when dupe had other hard links or already was a link to keep.
+func Hardlink(keep, dupe string) (int64, error) {
+	keepInfo, err := os.Stat(keep)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read file info of %s, %s", keep, err.Error())
+	}
+	dupeInfo, err := os.Lstat(dupe)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read file info of %s, %s", dupe, err.Error())
+	}
+	if !dupeInfo.Mode().IsRegular() {
+		return 0, fmt.Errorf("unable to link %s, not a regular file", dupe)
+	}
+	if os.SameFile(keepInfo, dupeInfo) {
+		return 0, nil
+	}
+	if !sameDevice(keep, keepInfo, dupe, dupeInfo) {
+		return 0, fmt.Errorf("unable to link %s to %s, %w", dupe, keep, ErrCrossDevice)
+	}
+
+	tmp, err := tempName(dupe)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Link(keep, tmp); err != nil {
+		return 0, fmt.Errorf("unable to link %s to %s, %s", dupe, keep, err.Error())
+	}
+	if err := os.Rename(tmp, dupe); err != nil {
+		_ = os.Remove(tmp)
+		return 0, fmt.Errorf("unable to replace %s with a link, %s", dupe, err.Error())
+	}
+
+	if linkCount(dupeInfo) > 1 {
+		return 0, nil
+	}
+	return dupeInfo.Size(), nil
+}
+
+// tempName returns an unused name in the same directory as file, to stage its replacement.
+func tempName(file string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(file), ".dedupe-"+filepath.Base(file)+"-*")
+	if err != nil {
+		return "", fmt.Errorf("unable to create temporary file next to %s, %s", file, err.Error())
+	}
+	name := f.Name()
+	f.Close()
+	if err := os.Remove(name); err != nil {
+		return "", fmt.Errorf("unable to create temporary file next to %s, %s", file, err.Error())
+	}
+	return name, nil
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package dedupe
+
+import (
+	"os"
+	"syscall"
+)
+
+func sameDevice(_ string, a os.FileInfo, _ string, b os.FileInfo) bool {
+	sa, okA := a.Sys().(*syscall.Stat_t)
+	sb, okB := b.Sys().(*syscall.Stat_t)
+	if !okA || !okB {
+		return false
+	}
+	return sa.Dev == sb.Dev
+}
+
+func linkCount(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 1
+}
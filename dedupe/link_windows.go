@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func sameDevice(a string, _ os.FileInfo, b string, _ os.FileInfo) bool {
+	va, errA := filepath.Abs(a)
+	vb, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return strings.EqualFold(filepath.VolumeName(va), filepath.VolumeName(vb))
+}
+
+func linkCount(os.FileInfo) uint64 {
+	return 1
+}
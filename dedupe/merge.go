@@ -0,0 +1,89 @@
+package dedupe
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MergeReports unions the groups of the given reports by checksum, e.g. to combine the scans of different
+// shares. All the reports must have been calculated with the same algorithm. The merged report is as old
+// as the oldest report, and keeps the resolution of a group only if it covers all the merged files.
+func MergeReports(reports ...*DupeReport) (*DupeReport, error) {
+	ret := &DupeReport{
+		Dupes:  map[string][]string{},
+		Sizes:  map[string]int64{},
+		Errors: []error{},
+	}
+	files := map[string]map[string]bool{}
+	resolutions := map[string]*DupeGroup{}
+
+	for i, r := range reports {
+		if r.Algorithm != "" {
+			if ret.Algorithm != "" && ret.Algorithm != r.Algorithm {
+				return nil, fmt.Errorf("report %d was calculated with %s, the previous ones with %s", i+1, r.Algorithm, ret.Algorithm)
+			}
+			ret.Algorithm = r.Algorithm
+		}
+		if !r.Created.IsZero() && (ret.Created.IsZero() || r.Created.Before(ret.Created)) {
+			ret.Created = r.Created
+		}
+		ret.Roots = appendMissing(ret.Roots, r.Roots...)
+		ret.References = appendMissing(ret.References, r.References...)
+		ret.Errors = append(ret.Errors, r.Errors...)
+
+		for _, g := range r.Groups() {
+			if g.Size >= 0 {
+				if size, ok := ret.Sizes[g.Checksum]; ok && size != g.Size {
+					return nil, fmt.Errorf("group %s has %d bytes in report %d, and %d bytes in a previous one", g.Checksum, g.Size, i+1, size)
+				}
+				ret.Sizes[g.Checksum] = g.Size
+			}
+
+			set, ok := files[g.Checksum]
+			if !ok {
+				set = map[string]bool{}
+				files[g.Checksum] = set
+			}
+			for _, f := range g.Files {
+				if !set[f] {
+					set[f] = true
+					ret.Dupes[g.Checksum] = append(ret.Dupes[g.Checksum], f)
+				}
+			}
+
+			// The resolution of the largest resolved version of the group is kept if it covers all the files.
+			if res := r.Resolutions[g.Checksum]; res != nil {
+				if prev, ok := resolutions[g.Checksum]; !ok || len(g.Files) > len(prev.Files) {
+					resolutions[g.Checksum] = g
+					ret.SetResolution(g.Checksum, res)
+				}
+			}
+		}
+	}
+
+	for checksum, g := range resolutions {
+		if len(g.Files) < len(ret.Dupes[checksum]) {
+			delete(ret.Resolutions, checksum)
+		}
+	}
+	for _, files := range ret.Dupes {
+		sort.Strings(files)
+	}
+	return ret, nil
+}
+
+func appendMissing(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, existing := range list {
+			if existing == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,109 @@
+package dedupe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeReports(t *testing.T) {
+	done := &Resolution{Decision: DecisionDeleted, Outcome: OutcomeDone}
+	older, newer := past.Add(-time.Hour), past
+
+	tests := []struct {
+		name            string
+		reports         []*DupeReport
+		wantDupes       map[string][]string
+		wantSizes       map[string]int64
+		wantRoots       []string
+		wantResolutions []string
+		wantErr         string
+	}{
+		{
+			name: "disjoint and shared groups",
+			reports: []*DupeReport{
+				{Algorithm: HashSHA256, Roots: []string{"/a"}, Dupes: map[string][]string{"x": {"/a/2", "/a/1"}, "y": {"/a/3", "/a/4"}}, Sizes: map[string]int64{"x": 10, "y": 5}},
+				{Roots: []string{"/b", "/a"}, Dupes: map[string][]string{"x": {"/b/1", "/a/1"}, "z": {"/b/2", "/b/3"}}, Sizes: map[string]int64{"x": 10}},
+			},
+			wantDupes: map[string][]string{"x": {"/a/1", "/a/2", "/b/1"}, "y": {"/a/3", "/a/4"}, "z": {"/b/2", "/b/3"}},
+			wantSizes: map[string]int64{"x": 10, "y": 5},
+			wantRoots: []string{"/a", "/b"},
+		},
+		{
+			name: "resolution covering every file is kept",
+			reports: []*DupeReport{
+				{Dupes: map[string][]string{"x": {"/a/1", "/a/2"}}, Resolutions: map[string]*Resolution{"x": done}},
+				{Dupes: map[string][]string{"x": {"/a/1"}}},
+			},
+			wantDupes:       map[string][]string{"x": {"/a/1", "/a/2"}},
+			wantResolutions: []string{"x"},
+		},
+		{
+			name: "resolution of a subset of the files is dropped",
+			reports: []*DupeReport{
+				{Dupes: map[string][]string{"x": {"/a/1", "/a/2"}}, Resolutions: map[string]*Resolution{"x": done}},
+				{Dupes: map[string][]string{"x": {"/b/1", "/b/2"}}},
+			},
+			wantDupes: map[string][]string{"x": {"/a/1", "/a/2", "/b/1", "/b/2"}},
+		},
+		{
+			name: "different algorithms",
+			reports: []*DupeReport{
+				{Algorithm: HashSHA256, Dupes: map[string][]string{}},
+				{Algorithm: HashMD5, Dupes: map[string][]string{}},
+			},
+			wantErr: "report 2 was calculated with md5, the previous ones with sha256",
+		},
+		{
+			name: "different sizes",
+			reports: []*DupeReport{
+				{Dupes: map[string][]string{"x": {"/a/1", "/a/2"}}, Sizes: map[string]int64{"x": 10}},
+				{Dupes: map[string][]string{"x": {"/b/1", "/b/2"}}, Sizes: map[string]int64{"x": 11}},
+			},
+			wantErr: "group x has 11 bytes in report 2, and 10 bytes in a previous one",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.reports[0].Created = newer
+			if len(tt.reports) > 1 {
+				tt.reports[1].Created = older
+			}
+			got, err := MergeReports(tt.reports...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("MergeReports() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got.Dupes, tt.wantDupes) {
+				t.Errorf("Dupes = %v, want %v", got.Dupes, tt.wantDupes)
+			}
+			if tt.wantSizes == nil {
+				tt.wantSizes = map[string]int64{}
+			}
+			if !reflect.DeepEqual(got.Sizes, tt.wantSizes) {
+				t.Errorf("Sizes = %v, want %v", got.Sizes, tt.wantSizes)
+			}
+			if !reflect.DeepEqual(got.Roots, tt.wantRoots) {
+				t.Errorf("Roots = %v, want %v", got.Roots, tt.wantRoots)
+			}
+			var resolved []string
+			for checksum := range got.Resolutions {
+				resolved = append(resolved, checksum)
+			}
+			if !reflect.DeepEqual(resolved, tt.wantResolutions) {
+				t.Errorf("resolved groups = %v, want %v", resolved, tt.wantResolutions)
+			}
+			if !got.Created.Equal(older) {
+				t.Errorf("Created = %v, want the oldest %v", got.Created, older)
+			}
+		})
+	}
+}
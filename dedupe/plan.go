@@ -0,0 +1,350 @@
+package dedupe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	PlanKeep       = PlanAction("keep")
+	PlanSkip       = PlanAction("skip")
+	PlanDelete     = PlanAction(ActionDelete)
+	PlanSymlink    = PlanAction(ActionSymlink)
+	PlanHardlink   = PlanAction(ActionHardlink)
+	PlanQuarantine = PlanAction(ActionQuarantine)
+	PlanTrash      = PlanAction(ActionTrash)
+)
+
+// PlanAction is what a plan does with a file of a group. Other than 'keep' and 'skip', plan actions are
+// resolver actions.
+type PlanAction string
+
+var planActions = []PlanAction{PlanKeep, PlanSkip, PlanDelete, PlanSymlink, PlanHardlink, PlanQuarantine, PlanTrash}
+
+// Plan is an editable list of the resolution actions to take on each group of duplicates. It is written
+// as a text file the user can review and change before applying it:
+//
+//	algorithm sha256
+//	created   2020-01-02T03:04:05Z
+//	reference /archive
+//
+//	group <checksum> <size>
+//	keep      /photos/a.jpg
+//	delete    /photos/copy of a.jpg
+//	hardlink  /backup/a.jpg
+//
+// Lines starting with '#' are comments. Paths that cannot be written verbatim on a line (e.g. with
+// leading or trailing spaces, or line breaks) are written as Go quoted strings. Created is when the
+// checksums of the plan were calculated, files modified after it are not acted on.
+type Plan struct {
+	Algorithm  HashMode
+	Created    time.Time
+	References []string
+	Groups     []*PlanGroup
+}
+
+// PlanGroup is a group of duplicates of a plan. Size is the size every file of the group had when the
+// plan was generated.
+type PlanGroup struct {
+	Checksum string
+	Size     int64
+	Entries  []*PlanEntry
+	Line     int
+}
+
+// PlanEntry is the action planned for a single file.
+type PlanEntry struct {
+	Action PlanAction
+	Path   string
+	Line   int
+}
+
+// LoadPlan reads a plan file.
+func LoadPlan(file string) (*Plan, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan file %s, %s", file, err.Error())
+	}
+	defer f.Close()
+
+	plan, err := ParsePlan(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return plan, nil
+}
+
+// ParsePlan parses a plan read from r. See Plan for the format.
+func ParsePlan(r io.Reader) (*Plan, error) {
+	plan := &Plan{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var group *PlanGroup
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		keyword, rest := splitPlanLine(text)
+		switch keyword {
+		case "algorithm":
+			if HashMode(rest) != HashMD5 && HashMode(rest) != HashSHA256 {
+				return nil, fmt.Errorf("line %d: unknown algorithm '%s'", line, rest)
+			}
+			plan.Algorithm = HashMode(rest)
+		case "created":
+			created, err := time.Parse(time.RFC3339Nano, rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid time '%s', expected RFC 3339", line, rest)
+			}
+			plan.Created = created
+		case "reference":
+			path, err := unquotePlanPath(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err.Error())
+			}
+			plan.References = append(plan.References, path)
+		case "group":
+			fields := strings.Fields(rest)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: expected 'group <checksum> <size>'", line)
+			}
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("line %d: invalid size '%s'", line, fields[1])
+			}
+			group = &PlanGroup{Checksum: fields[0], Size: size, Line: line}
+			plan.Groups = append(plan.Groups, group)
+		default:
+			if !isPlanAction(PlanAction(keyword)) {
+				return nil, fmt.Errorf("line %d: unknown action '%s'", line, keyword)
+			}
+			if group == nil {
+				return nil, fmt.Errorf("line %d: '%s' found before any 'group' line", line, keyword)
+			}
+			path, err := unquotePlanPath(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err.Error())
+			}
+			group.Entries = append(group.Entries, &PlanEntry{Action: PlanAction(keyword), Path: path, Line: line})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Checksums end up in generated scripts, so anything but the digits of a checksum is refused.
+	for _, g := range plan.Groups {
+		if !validChecksum(g.Checksum, plan.Algorithm) {
+			return nil, fmt.Errorf("line %d: invalid %s checksum '%s'", g.Line, algorithmOf(plan.Algorithm), g.Checksum)
+		}
+	}
+	return plan, nil
+}
+
+// WritePlan writes the plan to w, with a header explaining how to edit it.
+func WritePlan(w io.Writer, plan *Plan) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# dedupe plan, generated %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintln(bw, "#")
+	fmt.Fprintln(bw, "# Change the action of any file, then run 'dedupe apply' with this file. Actions:")
+	fmt.Fprintln(bw, "#   keep       the file survives, links point to the first kept file of the group")
+	fmt.Fprintln(bw, "#   skip       the file is left untouched")
+	fmt.Fprintln(bw, "#   delete     the file is deleted")
+	fmt.Fprintln(bw, "#   symlink    the file is replaced by a symbolic link to the kept file")
+	fmt.Fprintln(bw, "#   hardlink   the file is replaced by a hard link to the kept file")
+	fmt.Fprintln(bw, "#   quarantine the file is moved to the quarantine directory (requires --quarantine)")
+	fmt.Fprintln(bw, "#   trash      the file is moved to the trash")
+	fmt.Fprintln(bw, "#")
+	fmt.Fprintln(bw, "# A group is only applied if one of its files is kept. Removing a line is the same as 'skip'.")
+	fmt.Fprintln(bw)
+
+	if plan.Algorithm != "" {
+		fmt.Fprintf(bw, "algorithm %s\n", plan.Algorithm)
+	}
+	if !plan.Created.IsZero() {
+		fmt.Fprintf(bw, "created   %s\n", plan.Created.Format(time.RFC3339Nano))
+	}
+	for _, r := range plan.References {
+		fmt.Fprintf(bw, "reference %s\n", quotePlanPath(r))
+	}
+
+	for _, g := range plan.Groups {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, "group %s %d\n", g.Checksum, g.Size)
+		for _, e := range g.Entries {
+			fmt.Fprintf(bw, "%-10s %s\n", e.Action, quotePlanPath(e.Path))
+		}
+	}
+	return bw.Flush()
+}
+
+// Keep returns the file every link of the group points to, the first one kept.
+func (g *PlanGroup) Keep() string {
+	for _, e := range g.Entries {
+		if e.Action == PlanKeep {
+			return e.Path
+		}
+	}
+	return ""
+}
+
+// Validate checks the group is safe to apply: some copy must survive, no file under the given references
+// is removed, and every file must still exist with the size recorded in the plan and, if since is set, not
+// have been modified after it. It does not check the contents, see VerifyKeep.
+func (g *PlanGroup) Validate(references []string, since time.Time) error {
+	if err := g.check(references); err != nil || !g.removes() {
+		return err
+	}
+
+	for _, e := range g.Entries {
+		if e.Action == PlanSkip {
+			continue
+		}
+		info, err := os.Lstat(e.Path)
+		if err != nil {
+			return fmt.Errorf("unable to read file info of %s, %s", e.Path, err.Error())
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is no longer a regular file, %w", e.Path, ErrChanged)
+		}
+		if info.Size() != g.Size {
+			return fmt.Errorf("%s no longer has the planned size, %w", e.Path, ErrChanged)
+		}
+		if modifiedSince(info, since) {
+			return fmt.Errorf("%s was modified after the plan was created, %w", e.Path, ErrChanged)
+		}
+	}
+	return nil
+}
+
+// VerifyKeep re-calculates the checksum of the files kept by the group, so a mistyped keep line that
+// happens to have the right size never leaves the group without a copy of its contents.
+func (g *PlanGroup) VerifyKeep(mode HashMode, ioMode IOMode) error {
+	if !g.removes() {
+		return nil
+	}
+	h := &service{options: &Options{Mode: mode, IOMode: ioMode}}
+	for _, e := range g.Entries {
+		if e.Action != PlanKeep {
+			continue
+		}
+		sum, err := h.getHash(e.Path)
+		if err != nil {
+			return err
+		}
+		if sum != g.Checksum {
+			return fmt.Errorf("the kept file %s (line %d) does not have the checksum of the group, %w", e.Path, e.Line, ErrChanged)
+		}
+	}
+	return nil
+}
+
+// check validates the actions of the group without looking at the files.
+func (g *PlanGroup) check(references []string) error {
+	seen := map[string]bool{}
+	removed := 0
+
+	for _, e := range g.Entries {
+		clean := filepath.Clean(e.Path)
+		if seen[clean] {
+			return fmt.Errorf("%s is listed more than once (line %d)", e.Path, e.Line)
+		}
+		seen[clean] = true
+		if !e.removes() {
+			continue
+		}
+		if underAny(e.Path, references) {
+			return fmt.Errorf("refusing to %s %s (line %d), it is a reference file", e.Action, e.Path, e.Line)
+		}
+		removed++
+	}
+
+	if removed == 0 {
+		return nil
+	}
+	if removed == len(g.Entries) {
+		return fmt.Errorf("refusing to remove every copy of the group")
+	}
+	if g.Keep() == "" {
+		return fmt.Errorf("no file of the group is kept")
+	}
+	return nil
+}
+
+func (g *PlanGroup) removes() bool {
+	for _, e := range g.Entries {
+		if e.removes() {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *PlanEntry) removes() bool {
+	return e.Action != PlanKeep && e.Action != PlanSkip
+}
+
+func isPlanAction(a PlanAction) bool {
+	for _, p := range planActions {
+		if a == p {
+			return true
+		}
+	}
+	return false
+}
+
+// validChecksum returns whether s is a checksum calculated with the given algorithm, in lowercase hex.
+func validChecksum(s string, algorithm HashMode) bool {
+	if len(s) != checksumLength(algorithm) {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPlanLine(text string) (string, string) {
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimSpace(text[i:])
+}
+
+func quotePlanPath(path string) string {
+	if path == "" || strings.HasPrefix(path, `"`) || strings.TrimSpace(path) != path || !strconv.CanBackquote(path) {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+func unquotePlanPath(s string) (string, error) {
+	if s == "" {
+		return "", fmt.Errorf("missing path")
+	}
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	path, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted path %s", s)
+	}
+	return path, nil
+}
@@ -0,0 +1,211 @@
+package dedupe
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePlan(t *testing.T) {
+	sum := sha256Of("data")
+	tests := []struct {
+		name    string
+		input   string
+		want    *Plan
+		wantErr string
+	}{
+		{
+			name: "groups and references",
+			input: `# comment
+algorithm sha256
+reference /archive
+
+group ` + sum + ` 12
+keep   /a/x
+delete /a/y
+symlink "/a/ z "
+`,
+			want: &Plan{
+				Algorithm:  HashSHA256,
+				References: []string{"/archive"},
+				Groups: []*PlanGroup{{Checksum: sum, Size: 12, Line: 5, Entries: []*PlanEntry{
+					{Action: PlanKeep, Path: "/a/x", Line: 6},
+					{Action: PlanDelete, Path: "/a/y", Line: 7},
+					{Action: PlanSymlink, Path: "/a/ z ", Line: 8},
+				}}},
+			},
+		},
+		{name: "unknown action", input: "group " + sum + " 1\nerase /a\n", wantErr: "line 2: unknown action 'erase'"},
+		{name: "entry before group", input: "keep /a\n", wantErr: "line 1: 'keep' found before any 'group' line"},
+		{name: "invalid size", input: "group abc -1\n", wantErr: "line 1: invalid size '-1'"},
+		{name: "missing size", input: "group abc\n", wantErr: "line 1: expected 'group <checksum> <size>'"},
+		{name: "missing path", input: "group " + sum + " 1\nkeep\n", wantErr: "line 2: missing path"},
+		{name: "invalid quoted path", input: "group " + sum + " 1\nkeep \"/a\n", wantErr: "line 2: invalid quoted path"},
+		{name: "unknown algorithm", input: "algorithm crc32\n", wantErr: "line 1: unknown algorithm 'crc32'"},
+		{name: "short checksum", input: "group abc 1\nkeep /a\n", wantErr: "line 1: invalid sha256 checksum 'abc'"},
+		{name: "uppercase checksum", input: "group " + strings.ToUpper(sum) + " 1\n", wantErr: "line 1: invalid sha256 checksum"},
+		{name: "checksum of another algorithm", input: "algorithm md5\ngroup " + sum + " 1\n", wantErr: "line 2: invalid md5 checksum"},
+		{name: "shell command as checksum", input: "group $(rm${IFS}-rf${IFS}~) 4\n", wantErr: "line 1: invalid sha256 checksum"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePlan(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePlan() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePlan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePlanRoundTrip(t *testing.T) {
+	plan := &Plan{
+		Algorithm:  HashMD5,
+		References: []string{"/ref dir"},
+		Groups: []*PlanGroup{{Checksum: "900150983cd24fb0d6963f7d28e17f72", Size: 3, Entries: []*PlanEntry{
+			{Action: PlanKeep, Path: "/a/plain"},
+			{Action: PlanDelete, Path: " leading space"},
+			{Action: PlanHardlink, Path: "/a/line\nbreak"},
+			{Action: PlanSkip, Path: `"quoted"`},
+		}}},
+	}
+
+	var buf bytes.Buffer
+	if err := WritePlan(&buf, plan); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParsePlan(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Algorithm != plan.Algorithm || !reflect.DeepEqual(got.References, plan.References) || len(got.Groups) != 1 {
+		t.Fatalf("ParsePlan(WritePlan()) = %+v", got)
+	}
+	for i, e := range got.Groups[0].Entries {
+		if want := plan.Groups[0].Entries[i]; e.Action != want.Action || e.Path != want.Path {
+			t.Errorf("entry %d = %s %q, want %s %q", i, e.Action, e.Path, want.Action, want.Path)
+		}
+	}
+}
+
+func TestPlanGroupValidate(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, filepath.Join(dir, "a"), "data", past)
+	b := writeFile(t, filepath.Join(dir, "b"), "data", past)
+	other := writeFile(t, filepath.Join(dir, "other"), "DATA", past)
+	ref := writeFile(t, filepath.Join(dir, "ref", "c"), "data", past)
+	longer := writeFile(t, filepath.Join(dir, "longer"), "longer", past)
+	touched := writeFile(t, filepath.Join(dir, "touched"), "data", past.Add(time.Minute))
+
+	entries := func(actions ...string) []*PlanEntry {
+		var ret []*PlanEntry
+		for i := 0; i < len(actions); i += 2 {
+			ret = append(ret, &PlanEntry{Action: PlanAction(actions[i]), Path: actions[i+1], Line: i/2 + 2})
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name       string
+		entries    []*PlanEntry
+		references []string
+		since      time.Time
+		wantErr    string
+		keepErr    bool
+	}{
+		{name: "keep and delete", entries: entries("keep", a, "delete", b)},
+		{name: "nothing removed", entries: entries("keep", a, "skip", b)},
+		{name: "every copy removed", entries: entries("delete", a, "delete", b), wantErr: "every copy"},
+		{name: "only skipped and removed", entries: entries("skip", a, "delete", b), wantErr: "no file of the group is kept"},
+		{name: "listed twice", entries: entries("keep", a, "delete", a), wantErr: "more than once"},
+		{name: "missing file", entries: entries("keep", a, "delete", filepath.Join(dir, "missing")), wantErr: "unable to read file info"},
+		{name: "different size", entries: entries("keep", a, "delete", longer), wantErr: "planned size"},
+		{name: "reference removed", entries: entries("keep", a, "delete", ref), references: []string{filepath.Join(dir, "ref")}, wantErr: "reference file"},
+		{name: "reference kept", entries: entries("keep", ref, "delete", a), references: []string{filepath.Join(dir, "ref")}},
+		{name: "kept file with other contents", entries: entries("keep", other, "delete", a), keepErr: true},
+		{name: "modified after the plan", entries: entries("keep", a, "delete", touched), since: past, wantErr: "modified after the plan was created"},
+		{name: "modified before the plan", entries: entries("keep", a, "delete", touched), since: past.Add(time.Hour)},
+		{name: "plan without creation time", entries: entries("keep", a, "delete", touched)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &PlanGroup{Checksum: sha256Of("data"), Size: 4, Entries: tt.entries, Line: 1}
+			err := g.Validate(tt.references, tt.since)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			err = g.VerifyKeep(HashSHA256, IOBuffered)
+			if (err != nil) != tt.keepErr {
+				t.Fatalf("VerifyKeep() error = %v, wantErr %v", err, tt.keepErr)
+			}
+			if err != nil && !errors.Is(err, ErrChanged) {
+				t.Errorf("VerifyKeep() error = %v, want ErrChanged", err)
+			}
+		})
+	}
+}
+
+func TestApplyPlanModifiedTarget(t *testing.T) {
+	dir := t.TempDir()
+	keep := writeFile(t, filepath.Join(dir, "keep"), "data", past)
+	target := writeFile(t, filepath.Join(dir, "target"), "data", past)
+
+	var buf bytes.Buffer
+	err := WritePlan(&buf, &Plan{Algorithm: HashSHA256, Created: past.Add(time.Minute), Groups: []*PlanGroup{{
+		Checksum: sha256Of("data"),
+		Size:     4,
+		Entries:  []*PlanEntry{{Action: PlanKeep, Path: keep}, {Action: PlanDelete, Path: target}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := ParsePlan(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Created.Equal(past.Add(time.Minute)) {
+		t.Fatalf("Created = %v, want %v", plan.Created, past.Add(time.Minute))
+	}
+
+	// Rewritten after the plan with contents of the same size.
+	writeFile(t, target, "DATA", time.Time{})
+
+	g := plan.Groups[0]
+	if err := g.Validate(plan.References, plan.Created); !errors.Is(err, ErrChanged) {
+		t.Errorf("Validate() error = %v, want ErrChanged", err)
+	}
+	if err := g.VerifyKeep(plan.Algorithm, IOBuffered); err != nil {
+		t.Errorf("VerifyKeep() error = %v", err)
+	}
+
+	r := NewResolver()
+	r.SetOptions(&ResolverOptions{Mode: plan.Algorithm, Since: plan.Created})
+	result := r.Apply(&Action{Type: ActionDelete, Keep: keep, Target: target, Checksum: g.Checksum})
+	if !errors.Is(result.Err, ErrChanged) {
+		t.Errorf("Apply() error = %v, want ErrChanged", result.Err)
+	}
+	if readFile(t, target) != "DATA" {
+		t.Errorf("the modified target was deleted")
+	}
+}
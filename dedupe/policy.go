@@ -0,0 +1,167 @@
+package dedupe
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	KeepOldest        = KeepPolicy("oldest")
+	KeepNewest        = KeepPolicy("newest")
+	KeepShortestPath  = KeepPolicy("shortest-path")
+	KeepLongestPath   = KeepPolicy("longest-path")
+	KeepShallowest    = KeepPolicy("shallowest")
+	KeepPreferred     = KeepPolicy("preferred")
+	KeepLexicographic = KeepPolicy("lexicographic")
+)
+
+// KeepPolicy is a rule to automatically pick which file of a group of duplicates survives.
+type KeepPolicy string
+
+var keepPolicies = []KeepPolicy{KeepOldest, KeepNewest, KeepShortestPath, KeepLongestPath, KeepShallowest, KeepPreferred, KeepLexicographic}
+
+// Selection is the outcome of applying keep policies to a group of duplicates. Policy is the last policy
+// that narrowed down the candidates, and Reason describes every policy that did, in order.
+type Selection struct {
+	Keep   string
+	Remove []string
+	Policy KeepPolicy
+	Reason string
+}
+
+type candidate struct {
+	path  string
+	info  os.FileInfo
+	depth int
+}
+
+// ParseKeepPolicies parses a comma separated list of keep policies, e.g. 'preferred,oldest'.
+func ParseKeepPolicies(s string) ([]KeepPolicy, error) {
+	var ret []KeepPolicy
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		valid := false
+		for _, k := range keepPolicies {
+			if KeepPolicy(p) == k {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown keep policy '%s'", p)
+		}
+		ret = append(ret, KeepPolicy(p))
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no keep policy given")
+	}
+	return ret, nil
+}
+
+// SelectKeep picks the file to keep in a group of duplicates. The policies are applied in order, each
+// one narrowing down the candidates left by the previous one, and any remaining tie is broken in
+// lexicographic order so the result is deterministic. The preferred paths are only used by KeepPreferred,
+// in order of preference.
+func SelectKeep(files []string, preferred []string, policies ...KeepPolicy) (*Selection, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to select from")
+	}
+
+	var cands []*candidate
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read file info of %s, %s", f, err.Error())
+		}
+		cands = append(cands, &candidate{path: f, info: info, depth: depth(f)})
+	}
+
+	ret := &Selection{}
+	var reasons []string
+	for _, p := range policies {
+		if len(cands) == 1 {
+			break
+		}
+		narrowed, reason := p.narrow(cands, preferred)
+		if len(narrowed) < len(cands) {
+			ret.Policy = p
+			reasons = append(reasons, fmt.Sprintf("%s: %s", p, reason))
+		}
+		cands = narrowed
+	}
+
+	sort.Slice(cands, func(i, j int) bool { return cands[i].path < cands[j].path })
+	if len(cands) > 1 || ret.Policy == "" {
+		ret.Policy = KeepLexicographic
+		reasons = append(reasons, fmt.Sprintf("%s: first in lexicographic order", KeepLexicographic))
+	}
+	ret.Reason = strings.Join(reasons, ", then ")
+
+	ret.Keep = cands[0].path
+	for _, f := range files {
+		if f != ret.Keep {
+			ret.Remove = append(ret.Remove, f)
+		}
+	}
+	return ret, nil
+}
+
+// narrow returns the candidates tied for the best value according to the policy, and a description of
+// that value.
+func (p KeepPolicy) narrow(cands []*candidate, preferred []string) ([]*candidate, string) {
+	switch p {
+	case KeepOldest:
+		best := bestBy(cands, func(c *candidate) int64 { return c.info.ModTime().UnixNano() })
+		return best, "oldest modification time, " + best[0].info.ModTime().Format(time.RFC3339)
+	case KeepNewest:
+		best := bestBy(cands, func(c *candidate) int64 { return -c.info.ModTime().UnixNano() })
+		return best, "newest modification time, " + best[0].info.ModTime().Format(time.RFC3339)
+	case KeepShortestPath:
+		best := bestBy(cands, func(c *candidate) int64 { return int64(len(c.path)) })
+		return best, fmt.Sprintf("shortest path, %d characters", len(best[0].path))
+	case KeepLongestPath:
+		best := bestBy(cands, func(c *candidate) int64 { return -int64(len(c.path)) })
+		return best, fmt.Sprintf("longest path, %d characters", len(best[0].path))
+	case KeepShallowest:
+		best := bestBy(cands, func(c *candidate) int64 { return int64(c.depth) })
+		return best, fmt.Sprintf("shallowest location, depth %d", best[0].depth)
+	case KeepPreferred:
+		for _, pref := range preferred {
+			var matches []*candidate
+			for _, c := range cands {
+				if under(c.path, pref) {
+					matches = append(matches, c)
+				}
+			}
+			if len(matches) > 0 {
+				return matches, "under preferred path " + pref
+			}
+		}
+	}
+	return cands, ""
+}
+
+func bestBy(cands []*candidate, value func(c *candidate) int64) []*candidate {
+	var ret []*candidate
+	for _, c := range cands {
+		switch {
+		case len(ret) == 0 || value(c) < value(ret[0]):
+			ret = []*candidate{c}
+		case value(c) == value(ret[0]):
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+func depth(file string) int {
+	clean := filepath.ToSlash(filepath.Clean(file))
+	return strings.Count(strings.Trim(clean, "/"), "/")
+}
@@ -0,0 +1,127 @@
+package dedupe
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectKeep(t *testing.T) {
+	dir := t.TempDir()
+	old := past.Add(-time.Hour)
+	files := map[string]time.Time{
+		"a/x":       past,
+		"b/x":       old,
+		"b/y":       old,
+		"pref/c/x":  past,
+		"pref/long": old,
+	}
+	for name, mtime := range files {
+		writeFile(t, filepath.Join(dir, name), "data", mtime)
+	}
+	pref := filepath.Join(dir, "pref")
+	at := func(names ...string) []string {
+		var ret []string
+		for _, n := range names {
+			ret = append(ret, filepath.Join(dir, n))
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name       string
+		files      []string
+		policies   []KeepPolicy
+		wantKeep   string
+		wantPolicy KeepPolicy
+		wantReason []string
+	}{
+		{
+			name:       "single policy",
+			files:      at("a/x", "b/x"),
+			policies:   []KeepPolicy{KeepOldest},
+			wantKeep:   "b/x",
+			wantPolicy: KeepOldest,
+			wantReason: []string{"oldest: oldest modification time"},
+		},
+		{
+			name:       "every narrowing policy is reported",
+			files:      at("a/x", "pref/c/x", "pref/long"),
+			policies:   []KeepPolicy{KeepPreferred, KeepNewest},
+			wantKeep:   "pref/c/x",
+			wantPolicy: KeepNewest,
+			wantReason: []string{"preferred: under preferred path " + pref, "newest: newest modification time"},
+		},
+		{
+			name:       "policies that do not narrow are not reported",
+			files:      at("b/x", "b/y", "a/x"),
+			policies:   []KeepPolicy{KeepShallowest, KeepOldest, KeepShortestPath},
+			wantKeep:   "b/x",
+			wantPolicy: KeepLexicographic,
+			wantReason: []string{"oldest: oldest modification time", "lexicographic: first in lexicographic order"},
+		},
+		{
+			name:       "policies after a single candidate are not applied",
+			files:      at("a/x", "pref/long"),
+			policies:   []KeepPolicy{KeepPreferred, KeepShortestPath},
+			wantKeep:   "pref/long",
+			wantPolicy: KeepPreferred,
+			wantReason: []string{"preferred: under preferred path " + pref},
+		},
+		{
+			name:       "no policy narrows",
+			files:      at("b/y", "b/x"),
+			policies:   []KeepPolicy{KeepOldest, KeepPreferred},
+			wantKeep:   "b/x",
+			wantPolicy: KeepLexicographic,
+			wantReason: []string{"lexicographic: first in lexicographic order"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := SelectKeep(tt.files, []string{pref}, tt.policies...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.wantKeep); sel.Keep != want || sel.Policy != tt.wantPolicy {
+				t.Errorf("SelectKeep() = %s (%s), want %s (%s)", sel.Keep, sel.Policy, want, tt.wantPolicy)
+			}
+			if len(sel.Remove) != len(tt.files)-1 {
+				t.Errorf("SelectKeep() removes %v", sel.Remove)
+			}
+
+			reasons := strings.Split(sel.Reason, ", then ")
+			if len(reasons) != len(tt.wantReason) {
+				t.Fatalf("SelectKeep() reason = %q, want %q", sel.Reason, tt.wantReason)
+			}
+			for i, want := range tt.wantReason {
+				if !strings.HasPrefix(reasons[i], want) {
+					t.Errorf("SelectKeep() reason %d = %q, want %q", i, reasons[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseKeepPolicies(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []KeepPolicy
+		wantErr bool
+	}{
+		{input: "oldest", want: []KeepPolicy{KeepOldest}},
+		{input: " preferred, shallowest ,", want: []KeepPolicy{KeepPreferred, KeepShallowest}},
+		{input: "oldest,biggest", wantErr: true},
+		{input: " , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseKeepPolicies(tt.input)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseKeepPolicies(%q) = %v, %v, want %v, wantErr %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
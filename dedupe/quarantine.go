@@ -0,0 +1,334 @@
+package dedupe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	ActionQuarantine = ActionType("quarantine")
+
+	quarantineManifest = "manifest.jsonl"
+	quarantineFiles    = "files"
+)
+
+// QuarantineEntry is the record of a file moved into quarantine. Stored is the location of the file
+// relative to the quarantine directory, which mirrors the original absolute path of the file.
+type QuarantineEntry struct {
+	Time      time.Time
+	Original  string
+	Stored    string
+	Keep      string   `json:",omitempty"`
+	Checksum  string   `json:",omitempty"`
+	Algorithm HashMode `json:",omitempty"`
+	Size      int64
+	Mode      os.FileMode
+	ModTime   time.Time
+}
+
+// Quarantine is a holding directory where duplicates are moved to instead of being deleted, so they can
+// be restored or purged later. It keeps a manifest of its entries next to the files.
+type Quarantine struct {
+	mu        sync.Mutex
+	dir       string
+	algorithm HashMode
+}
+
+// OpenQuarantine opens (creating it if needed) the quarantine directory. The algorithm is the one used to
+// verify cross-device moves.
+func OpenQuarantine(dir string, algorithm HashMode) (*Quarantine, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(abs, quarantineFiles), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create quarantine directory %s, %s", dir, err.Error())
+	}
+	if algorithm == "" {
+		algorithm = HashSHA256
+	}
+	return &Quarantine{dir: abs, algorithm: algorithm}, nil
+}
+
+func (q *Quarantine) Dir() string {
+	return q.dir
+}
+
+// Add moves the target of the action into the quarantine and records it in the manifest.
+func (q *Quarantine) Add(action *Action, info os.FileInfo) (*QuarantineEntry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	original := absPath(action.Target)
+	stored := q.storedName(original)
+
+	entry := &QuarantineEntry{
+		Time:      time.Now(),
+		Original:  original,
+		Stored:    stored,
+		Keep:      absPath(action.Keep),
+		Checksum:  action.Checksum,
+		Algorithm: q.algorithm,
+		Size:      info.Size(),
+		Mode:      info.Mode(),
+		ModTime:   info.ModTime(),
+	}
+
+	dest := filepath.Join(q.dir, stored)
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create quarantine directory for %s, %s", original, err.Error())
+	}
+	if err := moveFile(original, dest, entry.Mode, entry.ModTime, q.algorithm); err != nil {
+		return nil, err
+	}
+	if err := q.appendEntry(entry); err != nil {
+		// Put the file back, a quarantined file without a manifest entry could never be restored.
+		if e := moveFile(dest, original, entry.Mode, entry.ModTime, q.algorithm); e != nil {
+			return nil, fmt.Errorf("%s, and the file was left in %s: %s", err.Error(), dest, e.Error())
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+// storedName returns the location inside the quarantine for the given absolute path, adding a numeric
+// suffix if a file with the same original path is already quarantined.
+func (q *Quarantine) storedName(original string) string {
+	rel := strings.TrimPrefix(original, filepath.VolumeName(original))
+	rel = strings.TrimLeft(rel, string(filepath.Separator))
+	base := filepath.Join(quarantineFiles, rel)
+
+	name := base
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(filepath.Join(q.dir, name)); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+}
+
+// Entries returns all the entries currently in quarantine.
+func (q *Quarantine) Entries() ([]*QuarantineEntry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.readEntries()
+}
+
+// Restore moves the given entries back to their original location. Entries whose original path is taken
+// are not restored. The entries restored are removed from the manifest.
+func (q *Quarantine) Restore(entries []*QuarantineEntry) ([]*QuarantineEntry, error) {
+	return q.remove(entries, func(e *QuarantineEntry) error {
+		if _, err := os.Lstat(e.Original); err == nil {
+			return fmt.Errorf("unable to restore %s, a file already exists at that path", e.Original)
+		}
+		if err := os.MkdirAll(filepath.Dir(e.Original), 0755); err != nil {
+			return fmt.Errorf("unable to restore %s, %s", e.Original, err.Error())
+		}
+		return moveFile(filepath.Join(q.dir, e.Stored), e.Original, e.Mode, e.ModTime, q.algorithm)
+	})
+}
+
+// Purge permanently deletes the given entries from the quarantine.
+func (q *Quarantine) Purge(entries []*QuarantineEntry) ([]*QuarantineEntry, error) {
+	return q.remove(entries, func(e *QuarantineEntry) error {
+		if err := os.Remove(filepath.Join(q.dir, e.Stored)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to purge %s, %s", e.Original, err.Error())
+		}
+		return nil
+	})
+}
+
+// remove applies fn to each of the given entries and drops from the manifest the ones it succeeded for.
+// It returns the entries processed successfully and the errors of the rest.
+func (q *Quarantine) remove(entries []*QuarantineEntry, fn func(e *QuarantineEntry) error) ([]*QuarantineEntry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	current, err := q.readEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		done []*QuarantineEntry
+		errs []string
+	)
+	removed := map[string]bool{}
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		removed[e.Stored] = true
+		done = append(done, e)
+	}
+
+	var left []*QuarantineEntry
+	for _, e := range current {
+		if !removed[e.Stored] {
+			left = append(left, e)
+		}
+	}
+	if err := q.writeEntries(left); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return done, errors.New(strings.Join(errs, "; "))
+	}
+	return done, nil
+}
+
+func (q *Quarantine) manifestPath() string {
+	return filepath.Join(q.dir, quarantineManifest)
+}
+
+func (q *Quarantine) appendEntry(entry *QuarantineEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal quarantine entry, %s", err.Error())
+	}
+	f, err := os.OpenFile(q.manifestPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open quarantine manifest, %s", err.Error())
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("unable to write quarantine manifest, %s", err.Error())
+	}
+	return f.Sync()
+}
+
+func (q *Quarantine) readEntries() ([]*QuarantineEntry, error) {
+	f, err := os.Open(q.manifestPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read quarantine manifest, %s", err.Error())
+	}
+	defer f.Close()
+
+	var ret []*QuarantineEntry
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			entry := &QuarantineEntry{}
+			if e := json.Unmarshal(data, entry); e != nil {
+				return nil, fmt.Errorf("invalid quarantine manifest entry at line %d, %s", line, e.Error())
+			}
+			ret = append(ret, entry)
+		}
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read quarantine manifest, %s", err.Error())
+		}
+	}
+}
+
+// writeEntries replaces the manifest atomically with the given entries.
+func (q *Quarantine) writeEntries(entries []*QuarantineEntry) error {
+	tmp, err := os.CreateTemp(q.dir, ".manifest-*")
+	if err != nil {
+		return fmt.Errorf("unable to write quarantine manifest, %s", err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("unable to marshal quarantine entry, %s", err.Error())
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write quarantine manifest, %s", err.Error())
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write quarantine manifest, %s", err.Error())
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), q.manifestPath()); err != nil {
+		return fmt.Errorf("unable to write quarantine manifest, %s", err.Error())
+	}
+	return nil
+}
+
+// moveFile renames src to dst. If both are on different devices, it copies the file instead, verifies
+// the copy against the source, restores the given mode and modification time, and only then removes the
+// source.
+func moveFile(src, dst string, mode os.FileMode, modTime time.Time, algorithm HashMode) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return fmt.Errorf("unable to move %s to %s, %s", src, dst, err.Error())
+	}
+
+	h := &service{options: &Options{Mode: algorithm}}
+	srcSum, err := copyFile(src, dst, h)
+	if err != nil {
+		return err
+	}
+	dstSum, err := h.getHash(dst)
+	if err != nil || dstSum != srcSum {
+		_ = os.Remove(dst)
+		return fmt.Errorf("unable to move %s to %s, the copy could not be verified", src, dst)
+	}
+	_ = os.Chmod(dst, mode.Perm())
+	_ = os.Chtimes(dst, modTime, modTime)
+
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("%s was copied to %s but could not be removed, %s", src, dst, err.Error())
+	}
+	return nil
+}
+
+// copyFile copies src into the new file dst and returns the checksum of the data copied.
+func copyFile(src, dst string, h *service) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("unable to read file %s, %s", src, err.Error())
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("unable to create file %s, %s", dst, err.Error())
+	}
+
+	hasher := h.getHasher()
+	if _, err := io.Copy(io.MultiWriter(out, hasher), in); err != nil {
+		out.Close()
+		_ = os.Remove(dst)
+		return "", fmt.Errorf("unable to copy %s to %s, %s", src, dst, err.Error())
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		_ = os.Remove(dst)
+		return "", fmt.Errorf("unable to copy %s to %s, %s", src, dst, err.Error())
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return "", fmt.Errorf("unable to copy %s to %s, %s", src, dst, err.Error())
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
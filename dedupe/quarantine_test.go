@@ -0,0 +1,131 @@
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// quarantineTestFiles quarantines the given files, returning their entries.
+func quarantineTestFiles(t *testing.T, q *Quarantine, files ...string) []*QuarantineEntry {
+	t.Helper()
+	var ret []*QuarantineEntry
+	for _, f := range files {
+		info, err := os.Lstat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := q.Add(&Action{Type: ActionQuarantine, Target: f, Checksum: sha256Of(readFile(t, f))}, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+func TestQuarantineAdd(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenQuarantine(filepath.Join(dir, "q"), HashSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same path quarantined twice is stored under two names.
+	file := filepath.Join(dir, "a", "x")
+	first := quarantineTestFiles(t, q, writeFile(t, file, "one", past))[0]
+	second := quarantineTestFiles(t, q, writeFile(t, file, "two", past))[0]
+
+	if first.Stored == second.Stored {
+		t.Fatalf("both copies are stored as %s", first.Stored)
+	}
+	if !strings.HasSuffix(second.Stored, ".1") {
+		t.Errorf("second copy stored as %s", second.Stored)
+	}
+	for e, want := range map[*QuarantineEntry]string{first: "one", second: "two"} {
+		if got := readFile(t, filepath.Join(q.Dir(), e.Stored)); got != want {
+			t.Errorf("%s holds %q, want %q", e.Stored, got, want)
+		}
+		if e.Original != file || e.Size != int64(len(want)) || !e.ModTime.Equal(past) {
+			t.Errorf("entry = %+v", e)
+		}
+	}
+	if exists(file) {
+		t.Errorf("%s was not moved", file)
+	}
+
+	entries, err := q.Entries()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Entries() = %v, %v", entries, err)
+	}
+}
+
+func TestQuarantineRestorePurge(t *testing.T) {
+	tests := []struct {
+		name     string
+		purge    bool
+		occupied bool
+		wantErr  bool
+	}{
+		{name: "restore"},
+		{name: "restore over an existing file", occupied: true, wantErr: true},
+		{name: "purge", purge: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q, err := OpenQuarantine(filepath.Join(dir, "q"), HashSHA256)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x := writeFile(t, filepath.Join(dir, "a", "x"), "x", past)
+			y := writeFile(t, filepath.Join(dir, "a", "y"), "y", past)
+			entries := quarantineTestFiles(t, q, x, y)
+			if err := os.RemoveAll(filepath.Join(dir, "a")); err != nil {
+				t.Fatal(err)
+			}
+			if tt.occupied {
+				writeFile(t, x, "other", past)
+			}
+
+			var done []*QuarantineEntry
+			if tt.purge {
+				done, err = q.Purge(entries[:1])
+			} else {
+				done, err = q.Restore(entries[:1])
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			left, err := q.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored := filepath.Join(q.Dir(), entries[0].Stored)
+			switch {
+			case tt.wantErr:
+				if len(done) != 0 || len(left) != 2 || !exists(stored) || readFile(t, x) != "other" {
+					t.Errorf("a failed restore changed the quarantine: done %v, left %v", done, left)
+				}
+			case tt.purge:
+				if len(done) != 1 || len(left) != 1 || exists(stored) || exists(x) {
+					t.Errorf("purge: done %v, left %v, stored exists %v", done, left, exists(stored))
+				}
+			default:
+				if len(done) != 1 || len(left) != 1 || exists(stored) {
+					t.Errorf("restore: done %v, left %v, stored exists %v", done, left, exists(stored))
+				}
+				info, err := os.Stat(x)
+				if err != nil || readFile(t, x) != "x" || !info.ModTime().Equal(past) {
+					t.Errorf("restored file = %v, %v", info, err)
+				}
+			}
+			if len(left) > 0 && left[len(left)-1].Original != y {
+				t.Errorf("the entry of %s was dropped", y)
+			}
+		})
+	}
+}
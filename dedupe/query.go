@@ -0,0 +1,208 @@
+package dedupe
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReportQuery selects and orders the groups of a report without rescanning. The filter and the sort keys
+// are expressions in the language of the rule files (see RuleSet), evaluated against the files of each
+// group with the size recorded in the report. The modification times are only read from the files when
+// an expression uses mtime, newest or oldest.
+type ReportQuery struct {
+	where node
+	sorts []*sortKey
+	limit int
+	stat  bool
+}
+
+type sortKey struct {
+	source string
+	expr   node
+	desc   bool
+}
+
+var mtimeIdents = map[string]bool{"mtime": true, "newest": true, "oldest": true}
+
+// NewReportQuery creates a query. A group is selected if any of its files matches the where expression,
+// or always if it is empty. Groups are ordered by each sort expression in turn, evaluated against their
+// first file, descending if prefixed by '-', and then by reclaimable space. A limit greater than zero
+// keeps only that many groups.
+func NewReportQuery(where string, sorts []string, limit int) (*ReportQuery, error) {
+	q := &ReportQuery{limit: limit}
+
+	if strings.TrimSpace(where) != "" {
+		expr, err := parseExpr(where)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter '%s', %s", where, err.Error())
+		}
+		q.where = expr
+		q.stat = usesIdent(expr, mtimeIdents)
+	}
+
+	for _, s := range sorts {
+		key := &sortKey{source: strings.TrimSpace(s)}
+		src := key.source
+		if strings.HasPrefix(src, "-") {
+			key.desc = true
+			src = src[1:]
+		}
+		expr, err := parseExpr(src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sort key '%s', %s", s, err.Error())
+		}
+		key.expr = expr
+		q.sorts = append(q.sorts, key)
+		q.stat = q.stat || usesIdent(expr, mtimeIdents)
+	}
+	return q, nil
+}
+
+// Apply returns a report with the groups of the given report selected by the query, in the order of the
+// query.
+func (q *ReportQuery) Apply(report *DupeReport) (*DupeReport, error) {
+	type match struct {
+		group *DupeGroup
+		keys  []value
+	}
+
+	var matches []*match
+	now := time.Now()
+
+	for _, g := range report.Groups() {
+		envs := q.envs(report, g, now)
+
+		selected := q.where == nil
+		for _, env := range envs {
+			if selected {
+				break
+			}
+			v, err := q.where.eval(env)
+			if err != nil {
+				return nil, fmt.Errorf("unable to evaluate the filter on %s, %s", env.path, err.Error())
+			}
+			if v.kind != kindBool {
+				return nil, fmt.Errorf("the filter evaluates to a %s instead of a bool", v.kind)
+			}
+			selected = v.b
+		}
+		if !selected {
+			continue
+		}
+
+		m := &match{group: g}
+		for _, key := range q.sorts {
+			v, err := key.expr.eval(envs[0])
+			if err != nil {
+				return nil, fmt.Errorf("unable to evaluate the sort key '%s' on %s, %s", key.source, envs[0].path, err.Error())
+			}
+			if v.kind == kindBool {
+				return nil, fmt.Errorf("the sort key '%s' evaluates to a bool", key.source)
+			}
+			m.keys = append(m.keys, v)
+		}
+		matches = append(matches, m)
+	}
+
+	// Groups are already sorted by reclaimable space, which breaks the ties of a stable sort.
+	sort.SliceStable(matches, func(i, j int) bool {
+		for k, key := range q.sorts {
+			a, b := matches[i].keys[k], matches[j].keys[k]
+			c := 0
+			if a.kind == kindNumber && b.kind == kindNumber {
+				c = compareFloat(a.num, b.num)
+			} else {
+				c = strings.Compare(a.str, b.str)
+			}
+			if c != 0 {
+				return (c < 0) != key.desc
+			}
+		}
+		return false
+	})
+
+	if q.limit > 0 && len(matches) > q.limit {
+		matches = matches[:q.limit]
+	}
+
+	ret := &DupeReport{
+		Dupes:      map[string][]string{},
+		Sizes:      map[string]int64{},
+		Algorithm:  report.Algorithm,
+		Created:    report.Created,
+		Roots:      report.Roots,
+		References: report.References,
+		Errors:     report.Errors,
+		order:      []string{},
+	}
+	for _, m := range matches {
+		g := m.group
+		ret.Dupes[g.Checksum] = g.Files
+		if g.Size >= 0 {
+			ret.Sizes[g.Checksum] = g.Size
+		}
+		if res, ok := report.Resolutions[g.Checksum]; ok {
+			ret.SetResolution(g.Checksum, res)
+		}
+		ret.order = append(ret.order, g.Checksum)
+	}
+	return ret, nil
+}
+
+func (q *ReportQuery) envs(report *DupeReport, g *DupeGroup, now time.Time) []*ruleEnv {
+	envs := make([]*ruleEnv, len(g.Files))
+	for i, f := range g.Files {
+		envs[i] = &ruleEnv{
+			path:   f,
+			size:   g.Size,
+			depth:  depth(f),
+			root:   report.RootIndex(f),
+			count:  len(g.Files),
+			wasted: g.Reclaimable(),
+			now:    now,
+		}
+		if !q.stat {
+			continue
+		}
+		if info, err := os.Lstat(f); err == nil {
+			envs[i].mtime = info.ModTime()
+		}
+	}
+
+	for _, env := range envs {
+		for _, other := range envs {
+			if other.mtime.IsZero() {
+				continue
+			}
+			if env.newest.IsZero() || other.mtime.After(env.newest) {
+				env.newest = other.mtime
+			}
+			if env.oldest.IsZero() || other.mtime.Before(env.oldest) {
+				env.oldest = other.mtime
+			}
+		}
+	}
+	return envs
+}
+
+// usesIdent indicates whether the expression references any of the given attributes.
+func usesIdent(n node, names map[string]bool) bool {
+	switch n := n.(type) {
+	case *identNode:
+		return names[n.name]
+	case *callNode:
+		for _, a := range n.args {
+			if usesIdent(a, names) {
+				return true
+			}
+		}
+	case *unaryNode:
+		return usesIdent(n.x, names)
+	case *binaryNode:
+		return usesIdent(n.l, names) || usesIdent(n.r, names)
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package dedupe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReportQuery(t *testing.T) {
+	report := &DupeReport{
+		Dupes: map[string][]string{
+			"a": {"/photos/a.jpg", "/backup/a.jpg"},
+			"b": {"/photos/b.png", "/photos/c.png", "/tmp/b.png"},
+			"c": {"/docs/x.txt", "/backup/x.txt"},
+		},
+		Sizes:       map[string]int64{"a": 100, "b": 10, "c": 1000},
+		Resolutions: map[string]*Resolution{"b": {Decision: DecisionKept, Outcome: OutcomeDone}},
+	}
+
+	tests := []struct {
+		name    string
+		where   string
+		sorts   []string
+		limit   int
+		want    []string
+		wantErr string
+	}{
+		{name: "everything, largest reclaimable space first", want: []string{"c", "a", "b"}},
+		{name: "size", where: "size > 50", want: []string{"c", "a"}},
+		{name: "path of any file", where: `path ~ "/photos/*"`, want: []string{"a", "b"}},
+		{name: "any file outside of a path", where: `not under("/backup")`, want: []string{"c", "a", "b"}},
+		{name: "count", where: "count >= 3", want: []string{"b"}},
+		{name: "no match", where: "wasted > 1TB", want: []string{}},
+		{name: "sort by size", sorts: []string{"size"}, want: []string{"b", "a", "c"}},
+		{name: "sort descending", sorts: []string{"-size"}, want: []string{"c", "a", "b"}},
+		{name: "sort by string", sorts: []string{"name"}, want: []string{"a", "b", "c"}},
+		{name: "sort keys in order", sorts: []string{"-count", "-size"}, want: []string{"b", "c", "a"}},
+		{name: "ties keep the default order", sorts: []string{"count"}, want: []string{"c", "a", "b"}},
+		{name: "limit", sorts: []string{"size"}, limit: 2, want: []string{"b", "a"}},
+		{name: "filter, sort and limit", where: "size < 1000", sorts: []string{"-count"}, limit: 1, want: []string{"b"}},
+		{name: "invalid filter", where: "size >", wantErr: "invalid filter 'size >'"},
+		{name: "invalid sort key", sorts: []string{"-(size"}, wantErr: "invalid sort key '-(size'"},
+		{name: "filter that is not a bool", where: "size + 1", wantErr: "the filter evaluates to a number instead of a bool"},
+		{name: "filter that fails", where: `size == "big"`, wantErr: "unable to evaluate the filter"},
+		{name: "sort key that is a bool", sorts: []string{"size > 1"}, wantErr: "the sort key 'size > 1' evaluates to a bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewReportQuery(tt.where, tt.sorts, tt.limit)
+			var got *DupeReport
+			if err == nil {
+				got, err = q.Apply(report)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("query error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var checksums []string
+			for _, g := range got.Groups() {
+				checksums = append(checksums, g.Checksum)
+				if g.Size != report.Sizes[g.Checksum] || !reflect.DeepEqual(g.Files, sortedCopy(report.Dupes[g.Checksum])) {
+					t.Errorf("group %s = %d bytes %v", g.Checksum, g.Size, g.Files)
+				}
+			}
+			if checksums == nil {
+				checksums = []string{}
+			}
+			if !reflect.DeepEqual(checksums, tt.want) {
+				t.Errorf("groups = %v, want %v", checksums, tt.want)
+			}
+			if _, ok := got.Resolutions["b"]; ok != (len(got.Dupes["b"]) > 0) {
+				t.Errorf("resolution of b kept = %v", ok)
+			}
+		})
+	}
+}
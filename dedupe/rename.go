@@ -0,0 +1,183 @@
+package dedupe
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DuplicateSkip leaves a file in place when its content already has a file with its hash name.
+	DuplicateSkip = DuplicateMode("skip")
+	// DuplicateSuffix renames a file whose content already has a file with its hash name to
+	// '<hash>-N.<ext>'.
+	DuplicateSuffix = DuplicateMode("suffix")
+
+	RenameDone      = RenameStatus("renamed")
+	RenameUnchanged = RenameStatus("unchanged")
+	RenameDuplicate = RenameStatus("duplicate")
+	RenameFailed    = RenameStatus("failed")
+)
+
+// DuplicateMode is how files are renamed when another file with the same content already has their hash
+// name.
+type DuplicateMode string
+
+// RenameStatus is the outcome of renaming a file to its hash.
+type RenameStatus string
+
+// RenameOptions indicates how files are renamed to their hash.
+type RenameOptions struct {
+	Mode   HashMode
+	IOMode IOMode
+	// Target is the directory the files are moved to. If empty, they are renamed in their own directory.
+	Target     string
+	Duplicates DuplicateMode
+	DryRun     bool
+}
+
+// RenameResult is the outcome of renaming a file. For duplicates left in place, To is the file that
+// already has the hash name.
+type RenameResult struct {
+	From     string
+	To       string
+	Checksum string
+	Status   RenameStatus
+	Err      error
+}
+
+// Renamer renames files to '<hash>.<ext>', e.g. to normalize asset dumps. It keeps track of the names
+// taken in the current run, so dry runs report the same collisions as real ones.
+type Renamer struct {
+	options *RenameOptions
+	hasher  *service
+	taken   map[string]string
+}
+
+// NewRenamer creates a renamer with the given options.
+func NewRenamer(opts *RenameOptions) *Renamer {
+	if opts.Duplicates == "" {
+		opts.Duplicates = DuplicateSkip
+	}
+	return &Renamer{
+		options: opts,
+		hasher:  &service{options: &Options{Mode: opts.Mode, IOMode: opts.IOMode}},
+		taken:   map[string]string{},
+	}
+}
+
+// Rename renames the file to its hash, in its directory or in the target directory.
+func (r *Renamer) Rename(file string) *RenameResult {
+	ret := &RenameResult{From: file}
+
+	info, err := os.Lstat(file)
+	if err != nil {
+		return r.fail(ret, fmt.Errorf("unable to read file info of %s, %s", file, err.Error()))
+	}
+	if ret.Checksum, err = r.hasher.getHash(file); err != nil {
+		return r.fail(ret, err)
+	}
+
+	dir := r.options.Target
+	if dir == "" {
+		dir = filepath.Dir(file)
+	}
+	ext := filepath.Ext(file)
+
+	for i := 0; ; i++ {
+		name := ret.Checksum + ext
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d%s", ret.Checksum, i, ext)
+		}
+		ret.To = filepath.Join(dir, name)
+
+		if sameFile(file, ret.To) {
+			ret.Status = RenameUnchanged
+			return ret
+		}
+
+		sum, exists, err := r.checksumOf(ret.To)
+		if err != nil {
+			return r.fail(ret, err)
+		}
+		if !exists {
+			break
+		}
+		if sum != ret.Checksum {
+			return r.fail(ret, fmt.Errorf("unable to rename %s, %s already exists with different contents", file, ret.To))
+		}
+		if r.options.Duplicates == DuplicateSkip {
+			ret.Status = RenameDuplicate
+			return ret
+		}
+	}
+
+	r.taken[ret.To] = ret.Checksum
+	ret.Status = RenameDone
+	if r.options.DryRun {
+		return ret
+	}
+
+	if err := moveFile(file, ret.To, info.Mode(), info.ModTime(), r.options.Mode); err != nil {
+		delete(r.taken, ret.To)
+		return r.fail(ret, err)
+	}
+	return ret
+}
+
+// checksumOf returns the checksum of the file with the given name, if it exists or was taken in this run.
+func (r *Renamer) checksumOf(file string) (string, bool, error) {
+	if sum, ok := r.taken[file]; ok {
+		return sum, true, nil
+	}
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read file info of %s, %s", file, err.Error())
+	}
+	if !info.Mode().IsRegular() {
+		return "", true, nil
+	}
+	sum, err := r.hasher.getHash(file)
+	return sum, true, err
+}
+
+func (r *Renamer) fail(ret *RenameResult, err error) *RenameResult {
+	ret.Status = RenameFailed
+	ret.Err = err
+	return ret
+}
+
+// WriteRenameMapping writes the results of a rename as CSV, with the columns from, to, checksum, status
+// and error.
+func WriteRenameMapping(w io.Writer, results []*RenameResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"from", "to", "checksum", "status", "error"}); err != nil {
+		return err
+	}
+	for _, res := range results {
+		msg := ""
+		if res.Err != nil {
+			msg = res.Err.Error()
+		}
+		if err := cw.Write([]string{res.From, res.To, res.Checksum, string(res.Status), msg}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ParseDuplicateMode validates a duplicate mode.
+func ParseDuplicateMode(mode string) (DuplicateMode, error) {
+	switch m := DuplicateMode(strings.ToLower(mode)); m {
+	case DuplicateSkip, DuplicateSuffix:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown duplicate mode '%s', expected %s or %s", mode, DuplicateSkip, DuplicateSuffix)
+}
@@ -0,0 +1,178 @@
+package dedupe
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenamer(t *testing.T) {
+	type want struct {
+		name   string
+		status RenameStatus
+		to     string
+	}
+	a, b := sha256Of("a"), sha256Of("b")
+
+	tests := []struct {
+		name       string
+		files      map[string]string
+		target     bool
+		duplicates DuplicateMode
+		dryRun     bool
+		want       []want
+	}{
+		{
+			name:  "distinct contents",
+			files: map[string]string{"x.txt": "a", "y.txt": "b", "z": "a2"},
+			want: []want{
+				{"x.txt", RenameDone, a + ".txt"},
+				{"y.txt", RenameDone, b + ".txt"},
+				{"z", RenameDone, sha256Of("a2")},
+			},
+		},
+		{
+			name:  "duplicates are skipped",
+			files: map[string]string{"x.txt": "a", "y.txt": "a"},
+			want: []want{
+				{"x.txt", RenameDone, a + ".txt"},
+				{"y.txt", RenameDuplicate, a + ".txt"},
+			},
+		},
+		{
+			name:       "duplicates are suffixed",
+			files:      map[string]string{"x.txt": "a", "y.txt": "a", "z.txt": "a"},
+			duplicates: DuplicateSuffix,
+			want: []want{
+				{"x.txt", RenameDone, a + ".txt"},
+				{"y.txt", RenameDone, a + "-1.txt"},
+				{"z.txt", RenameDone, a + "-2.txt"},
+			},
+		},
+		{
+			name:  "other extensions do not collide",
+			files: map[string]string{"x.jpg": "a", "x.png": "a"},
+			want: []want{
+				{"x.jpg", RenameDone, a + ".jpg"},
+				{"x.png", RenameDone, a + ".png"},
+			},
+		},
+		{
+			name:  "already named after its hash",
+			files: map[string]string{a + ".txt": "a", "y.txt": "a"},
+			want: []want{
+				{a + ".txt", RenameUnchanged, a + ".txt"},
+				{"y.txt", RenameDuplicate, a + ".txt"},
+			},
+		},
+		{
+			name:  "hash name taken by other contents",
+			files: map[string]string{a + ".txt": "not a", "x.txt": "a"},
+			want: []want{
+				{"x.txt", RenameFailed, a + ".txt"},
+			},
+		},
+		{
+			name:   "moved into the target",
+			files:  map[string]string{"x.txt": "a", "sub/y.txt": "a", "sub/z.txt": "b"},
+			target: true,
+			want: []want{
+				{"sub/y.txt", RenameDone, "target/" + a + ".txt"},
+				{"sub/z.txt", RenameDone, "target/" + b + ".txt"},
+				{"x.txt", RenameDuplicate, "target/" + a + ".txt"},
+			},
+		},
+		{
+			name:       "dry runs report the same collisions",
+			files:      map[string]string{"x.txt": "a", "y.txt": "a", "z.txt": "a"},
+			duplicates: DuplicateSuffix,
+			dryRun:     true,
+			want: []want{
+				{"x.txt", RenameDone, a + ".txt"},
+				{"y.txt", RenameDone, a + "-1.txt"},
+				{"z.txt", RenameDone, a + "-2.txt"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, contents := range tt.files {
+				writeFile(t, filepath.Join(dir, name), contents, past)
+			}
+			opts := &RenameOptions{Mode: HashSHA256, Duplicates: tt.duplicates, DryRun: tt.dryRun}
+			if tt.target {
+				opts.Target = filepath.Join(dir, "target")
+				if err := os.Mkdir(opts.Target, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := NewRenamer(opts)
+
+			for _, w := range tt.want {
+				from := filepath.Join(dir, w.name)
+				res := r.Rename(from)
+				to := filepath.Join(dir, w.to)
+				if res.Status != w.status || res.To != to {
+					t.Fatalf("Rename(%s) = %s %s (%v), want %s %s", w.name, res.Status, res.To, res.Err, w.status, to)
+				}
+
+				moved := res.Status == RenameDone && !tt.dryRun
+				if exists(from) == moved {
+					t.Errorf("%s exists = %v after %s", w.name, exists(from), res.Status)
+				}
+				if moved && readFile(t, to) != tt.files[w.name] {
+					t.Errorf("%s has the contents %q", to, readFile(t, to))
+				}
+				if res.Status == RenameFailed && readFile(t, to) == tt.files[w.name] {
+					t.Errorf("%s was overwritten", to)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteRenameMapping(t *testing.T) {
+	results := []*RenameResult{
+		{From: "/a/x.txt", To: "/a/abc.txt", Checksum: "abc", Status: RenameDone},
+		{From: "/a/y, z.txt", To: "/a/abc.txt", Checksum: "abc", Status: RenameDuplicate},
+		{From: "/a/w.txt", Status: RenameFailed, Err: errors.New("boom")},
+	}
+	want := `from,to,checksum,status,error
+/a/x.txt,/a/abc.txt,abc,renamed,
+"/a/y, z.txt",/a/abc.txt,abc,duplicate,
+/a/w.txt,,,failed,boom
+`
+
+	var buf bytes.Buffer
+	if err := WriteRenameMapping(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("WriteRenameMapping() = %q, want %q", got, want)
+	}
+}
+
+func TestParseDuplicateMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    DuplicateMode
+		wantErr string
+	}{
+		{input: "skip", want: DuplicateSkip},
+		{input: "SUFFIX", want: DuplicateSuffix},
+		{input: "overwrite", wantErr: "unknown duplicate mode 'overwrite'"},
+		{input: "", wantErr: "unknown duplicate mode ''"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuplicateMode(tt.input)
+		if got != tt.want || (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("ParseDuplicateMode(%q) = %q, %v, want %q, %q", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DupeReport is the outcome of a scan: the groups of files with identical contents, by checksum. It is
+// saved and loaded in the versioned format described by ReportSchema.
+type DupeReport struct {
+	Dupes map[string][]string
+	// Sizes is the size of the files of each group, by checksum.
+	Sizes      map[string]int64
+	Algorithm  HashMode
+	Created    time.Time
+	Roots      []string
+	References []string
+	Errors     []error
+	// Resolutions is the state of the groups resolved so far, by checksum.
+	Resolutions map[string]*Resolution
+	// order is the order of the groups set by a query, if any.
+	order []string
+}
+
+// DupeGroup is a group of files with identical contents.
+type DupeGroup struct {
+	Checksum string
+	Size     int64
+	Files    []string
+}
+
+// Reclaimable returns the bytes freed if all the copies of the group but one were removed.
+func (g *DupeGroup) Reclaimable() int64 {
+	if len(g.Files) < 2 || g.Size < 0 {
+		return 0
+	}
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// Groups returns the groups of the report in a deterministic order: the order of the query that produced
+// the report, or else largest reclaimable space first, then by checksum. The files of each group are sorted.
+// Sizes missing from the report (e.g. in reports saved by older versions) are read from the files, or -1 if
+// none is available.
+func (r *DupeReport) Groups() []*DupeGroup {
+	var ret []*DupeGroup
+	for checksum, files := range r.Dupes {
+		g := &DupeGroup{Checksum: checksum, Size: -1, Files: append([]string{}, files...)}
+		sort.Strings(g.Files)
+
+		if size, ok := r.Sizes[checksum]; ok {
+			g.Size = size
+		} else {
+			for _, f := range files {
+				if info, err := os.Lstat(f); err == nil {
+					g.Size = info.Size()
+					break
+				}
+			}
+		}
+		ret = append(ret, g)
+	}
+
+	if r.order != nil {
+		rank := map[string]int{}
+		for i, checksum := range r.order {
+			rank[checksum] = i
+		}
+		sort.Slice(ret, func(i, j int) bool { return rank[ret[i].Checksum] < rank[ret[j].Checksum] })
+		return ret
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ri, rj := ret[i].Reclaimable(), ret[j].Reclaimable(); ri != rj {
+			return ri > rj
+		}
+		return ret[i].Checksum < ret[j].Checksum
+	})
+	return ret
+}
+
+// RootIndex returns the index in Roots of the root that contains the given file, or -1 if none does.
+func (r *DupeReport) RootIndex(file string) int {
+	best := -1
+	for i, root := range r.Roots {
+		// Nested roots are allowed, the innermost one is the most specific.
+		if under(file, root) && (best < 0 || len(root) > len(r.Roots[best])) {
+			best = i
+		}
+	}
+	return best
+}
+
+// IsReference indicates whether the given file lives under one of the reference roots of the report.
+// Reference files are read-only: they are only used to identify copies and must never be acted upon.
+func (r *DupeReport) IsReference(file string) bool {
+	return underAny(file, r.References)
+}
+
+// SplitReferences splits the files of a group into the ones under a reference root and the rest.
+func (r *DupeReport) SplitReferences(files []string) (refs, others []string) {
+	for _, f := range files {
+		if r.IsReference(f) {
+			refs = append(refs, f)
+		} else {
+			others = append(others, f)
+		}
+	}
+	return
+}
+
+// IsUnder indicates whether file is one of the given paths or is contained by any of them.
+func IsUnder(file string, paths ...string) bool {
+	return underAny(file, paths)
+}
+
+// underAny indicates whether file is one of the given roots or is contained by any of them.
+func underAny(file string, roots []string) bool {
+	return (*rootCache)(nil).underAny(file, roots)
+}
+
+// under indicates whether file is root or is contained by it. Paths that do not match as written, e.g.
+// relative and absolute ones or paths through a symlinked directory, are compared once resolved.
+func under(file, root string) bool {
+	return (*rootCache)(nil).under(file, root)
+}
+
+func underPath(file, root string) bool {
+	file = filepath.Clean(file)
+	root = filepath.Clean(root)
+
+	switch {
+	case root == ".":
+		return !filepath.IsAbs(file) && file != ".." && !strings.HasPrefix(file, ".."+string(filepath.Separator))
+	case file == root:
+		return true
+	case strings.HasSuffix(root, string(filepath.Separator)):
+		return strings.HasPrefix(file, root)
+	default:
+		return strings.HasPrefix(file, root+string(filepath.Separator))
+	}
+}
+
+// rootCache caches the resolved paths of the roots that every file of a scan or a resolution is compared
+// against, keyed by their absolute path. The directories of the files are resolved on every call, so the
+// cache only grows with the number of roots. A nil cache resolves the roots on every call as well.
+type rootCache struct {
+	mu   sync.Mutex
+	dirs map[string]string
+}
+
+func newRootCache() *rootCache {
+	return &rootCache{dirs: map[string]string{}}
+}
+
+func (c *rootCache) underAny(file string, roots []string) bool {
+	for _, root := range roots {
+		if c.under(file, root) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *rootCache) under(file, root string) bool {
+	return underPath(file, root) || underPath(resolveFile(file), c.resolve(root))
+}
+
+func (c *rootCache) resolve(root string) string {
+	abs, err := filepath.Abs(root)
+	if c == nil || err != nil {
+		return resolveDir(root)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ret, ok := c.dirs[abs]; ok {
+		return ret
+	}
+	ret := resolveDir(abs)
+	c.dirs[abs] = ret
+	return ret
+}
+
+// resolveDir returns the absolute path of the directory with every symlink resolved, or only the absolute
+// path if it cannot be resolved, e.g. when it does not exist.
+func resolveDir(dir string) string {
+	ret, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Clean(dir)
+	}
+	if real, err := filepath.EvalSymlinks(ret); err == nil {
+		return real
+	}
+	return ret
+}
+
+// resolveFile resolves the directory of the file but not the file itself, so a symlink is not mistaken for
+// the file it points to.
+func resolveFile(file string) string {
+	dir, name := filepath.Split(filepath.Clean(file))
+	if dir == "" {
+		dir = "."
+	}
+	return filepath.Join(resolveDir(dir), name)
+}
@@ -0,0 +1,158 @@
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestUnder(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "real", "sub", "x"), "data", past)
+	if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "alias")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "real", "sub", "x"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		file, root string
+		want       bool
+	}{
+		{file: "/a/b/c", root: "/a/b", want: true},
+		{file: "/a/b", root: "/a/b/", want: true},
+		{file: "/a/bc", root: "/a/b", want: false},
+		{file: "a/x", root: ".", want: true},
+		{file: "./a/x", root: "a", want: true},
+		{file: "../x", root: ".", want: false},
+		{file: "/x", root: "/", want: true},
+		{file: filepath.Join(dir, "real", "sub", "x"), root: "real", want: true},
+		{file: "real/sub/x", root: filepath.Join(dir, "real"), want: true},
+		{file: filepath.Join(dir, "alias", "sub", "x"), root: filepath.Join(dir, "real"), want: true},
+		{file: filepath.Join(dir, "real", "sub", "x"), root: filepath.Join(dir, "alias", "sub"), want: true},
+		{file: "alias/sub/x", root: "real/sub", want: true},
+		{file: filepath.Join(dir, "real", "sub", "x"), root: filepath.Join(dir, "realm"), want: false},
+		{file: filepath.Join(dir, "link"), root: filepath.Join(dir, "real"), want: false},
+	}
+
+	cache := newRootCache()
+	for _, tt := range tests {
+		if got := under(tt.file, tt.root); got != tt.want {
+			t.Errorf("under(%q, %q) = %v, want %v", tt.file, tt.root, got, tt.want)
+		}
+		if got := cache.under(tt.file, tt.root); got != tt.want {
+			t.Errorf("cached under(%q, %q) = %v, want %v", tt.file, tt.root, got, tt.want)
+		}
+	}
+}
+
+func TestRootCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a", "sub", "x"), "data", past)
+	writeFile(t, filepath.Join(dir, "b", "sub", "y"), "data", past)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	cache := newRootCache()
+	for _, tt := range []struct {
+		cwd, file string
+		want      bool
+	}{
+		{cwd: "a", file: filepath.Join(dir, "a", "sub", "x"), want: true},
+		// The relative root is resolved again once the working directory changes.
+		{cwd: "b", file: filepath.Join(dir, "a", "sub", "x"), want: false},
+		{cwd: "b", file: filepath.Join(dir, "b", "sub", "y"), want: true},
+	} {
+		if err := os.Chdir(filepath.Join(dir, tt.cwd)); err != nil {
+			t.Fatal(err)
+		}
+		if got := cache.under(tt.file, "sub"); got != tt.want {
+			t.Errorf("under(%s, sub) from %s = %v, want %v", tt.file, tt.cwd, got, tt.want)
+		}
+	}
+
+	// Directories of files are not cached, so a symlink created later is followed.
+	root := filepath.Join(dir, "a")
+	alias := filepath.Join(dir, "alias", "sub", "x")
+	if cache.under(alias, root) {
+		t.Fatalf("%s is under %s before the alias exists", alias, root)
+	}
+	if err := os.Symlink(root, filepath.Join(dir, "alias")); err != nil {
+		t.Skip(err)
+	}
+	if !cache.under(alias, root) {
+		t.Errorf("%s is not under %s once the alias exists", alias, root)
+	}
+	if len(cache.dirs) != 3 {
+		t.Errorf("the cache holds %v, want only the 3 roots", cache.dirs)
+	}
+}
+
+func TestFindDupesReferences(t *testing.T) {
+	dir := t.TempDir()
+	incoming := filepath.Join(dir, "incoming")
+	archive := filepath.Join(dir, "archive")
+	writeFile(t, filepath.Join(incoming, "new"), "new", past)
+	writeFile(t, filepath.Join(incoming, "copy"), "old", past)
+	writeFile(t, filepath.Join(archive, "old"), "old", past)
+	writeFile(t, filepath.Join(archive, "old2"), "old", past)
+	writeFile(t, filepath.Join(archive, "a"), "only archived", past)
+	writeFile(t, filepath.Join(archive, "b"), "only archived", past)
+	alias := filepath.Join(dir, "alias")
+	if err := os.Symlink(archive, alias); err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		name       string
+		paths      []string
+		references []string
+	}{
+		{name: "separate roots", paths: []string{incoming}, references: []string{archive}},
+		{name: "reference through a symlink", paths: []string{incoming}, references: []string{alias}},
+		{name: "reference nested in a scanned root", paths: []string{dir}, references: []string{alias}},
+		{name: "root given twice", paths: []string{incoming, alias}, references: []string{archive}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			s.SetOptions(&Options{Recursive: true, Mode: HashSHA256, References: tt.references})
+			report, err := s.FindDupes(tt.paths...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Dupes) != 1 {
+				t.Fatalf("FindDupes() = %v, want the group of 'old' only", report.Dupes)
+			}
+			files := report.Dupes[sha256Of("old")]
+			var refs, others []string
+			for _, f := range files {
+				if report.IsReference(f) {
+					refs = append(refs, filepath.Base(f))
+				} else {
+					others = append(others, filepath.Base(f))
+				}
+			}
+			sort.Strings(refs)
+			if !reflect.DeepEqual(refs, []string{"old", "old2"}) || !reflect.DeepEqual(others, []string{"copy"}) {
+				t.Errorf("references = %v, others = %v in %v", refs, others, files)
+			}
+		})
+	}
+}
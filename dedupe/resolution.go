@@ -0,0 +1,133 @@
+package dedupe
+
+import (
+	"time"
+)
+
+const (
+	DecisionKept    = ResolutionDecision("kept")
+	DecisionDeleted = ResolutionDecision("deleted")
+	DecisionLinked  = ResolutionDecision("linked")
+	DecisionSkipped = ResolutionDecision("skipped")
+
+	OutcomeDone    = ResolutionOutcome("done")
+	OutcomePartial = ResolutionOutcome("partial")
+	OutcomeFailed  = ResolutionOutcome("failed")
+)
+
+// ResolutionDecision is what was decided for a group: all the copies were kept, the duplicates were
+// deleted (including quarantined or trashed) or linked, or the group was skipped by the rules.
+type ResolutionDecision string
+
+// ResolutionOutcome is whether the actions of a resolution succeeded. Failed groups are resolved again
+// when a session is resumed.
+type ResolutionOutcome string
+
+// Resolution is the state of a resolved group, as kept in the progress file.
+type Resolution struct {
+	Decision ResolutionDecision `json:"decision"`
+	Keep     string             `json:"keep,omitempty"`
+	Time     time.Time          `json:"time"`
+	Outcome  ResolutionOutcome  `json:"outcome"`
+	Steps    []*ResolutionStep  `json:"steps,omitempty"`
+}
+
+// ResolutionStep is an action applied to a file of a resolved group.
+type ResolutionStep struct {
+	Action ActionType `json:"action"`
+	Path   string     `json:"path"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// ReportProgress summarizes how far the resolution of a report went.
+type ReportProgress struct {
+	Groups   int
+	Resolved map[ResolutionDecision]int
+	Failed   int
+	Pending  int
+	// PendingBytes is the space that could still be reclaimed from the pending groups.
+	PendingBytes int64
+}
+
+// Add records the result of an action applied to the group.
+func (r *Resolution) Add(result *ActionResult) {
+	step := &ResolutionStep{Action: result.Action.Type, Path: result.Action.Target}
+	if result.Err != nil {
+		step.Error = result.Err.Error()
+	}
+	if r.Keep == "" {
+		r.Keep = result.Action.Keep
+	}
+	r.Steps = append(r.Steps, step)
+}
+
+// Finish sets the time of the resolution and, unless already set, its decision and outcome from the
+// steps taken: no step means every copy was kept.
+func (r *Resolution) Finish() {
+	r.Time = time.Now()
+
+	failed := 0
+	for _, s := range r.Steps {
+		if s.Error != "" {
+			failed++
+		}
+		if r.Decision == "" || r.Decision == DecisionLinked {
+			switch s.Action {
+			case ActionSymlink, ActionHardlink:
+				r.Decision = DecisionLinked
+			default:
+				r.Decision = DecisionDeleted
+			}
+		}
+	}
+	if r.Decision == "" {
+		r.Decision = DecisionKept
+	}
+
+	if r.Outcome != "" {
+		return
+	}
+	switch {
+	case failed == 0:
+		r.Outcome = OutcomeDone
+	case failed == len(r.Steps):
+		r.Outcome = OutcomeFailed
+	default:
+		r.Outcome = OutcomePartial
+	}
+}
+
+// IsResolved indicates whether the group with the given checksum was resolved. Groups whose resolution
+// failed are not.
+func (r *DupeReport) IsResolved(checksum string) bool {
+	res, ok := r.Resolutions[checksum]
+	return ok && res.Outcome != OutcomeFailed
+}
+
+// SetResolution records the resolution of a group.
+func (r *DupeReport) SetResolution(checksum string, res *Resolution) {
+	if r.Resolutions == nil {
+		r.Resolutions = map[string]*Resolution{}
+	}
+	r.Resolutions[checksum] = res
+}
+
+// Progress summarizes the resolution state of the groups of the report.
+func (r *DupeReport) Progress() *ReportProgress {
+	ret := &ReportProgress{Resolved: map[ResolutionDecision]int{}}
+	for _, g := range r.Groups() {
+		ret.Groups++
+		res, ok := r.Resolutions[g.Checksum]
+		switch {
+		case ok && res.Outcome != OutcomeFailed:
+			ret.Resolved[res.Decision]++
+		case ok:
+			ret.Failed++
+			fallthrough
+		default:
+			ret.Pending++
+			ret.PendingBytes += g.Reclaimable()
+		}
+	}
+	return ret
+}
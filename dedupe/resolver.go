@@ -0,0 +1,308 @@
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	ActionDelete   = ActionType("delete")
+	ActionSymlink  = ActionType("symlink")
+	ActionHardlink = ActionType("hardlink")
+)
+
+// ActionType is the kind of change a resolution action makes to a duplicate.
+type ActionType string
+
+// ErrChanged is returned when a file changed since it was scanned, so acting on it is no longer safe.
+var ErrChanged = errors.New("file changed since it was scanned")
+
+type IResolver interface {
+	Apply(action *Action) *ActionResult
+	SetOptions(opts *ResolverOptions)
+}
+
+type ResolverOptions struct {
+	// Mode is the hashing algorithm the checksums of the report were calculated with.
+	Mode   HashMode
+	IOMode IOMode
+	// Rehash re-calculates the checksum of both the survivor and the duplicate before acting, instead of
+	// only checking their metadata.
+	Rehash bool
+	// Since is when the checksums were calculated. If set, files modified after it are considered changed
+	// unless they are re-hashed.
+	Since  time.Time
+	DryRun bool
+	// References are the read-only roots, no action is ever applied to a file in them.
+	References []string
+	// Journal, if set, records every action right before it is applied, and its outcome afterwards, so it
+	// can be undone later.
+	Journal *Journal
+	// Quarantine is where the files are moved to by ActionQuarantine.
+	Quarantine *Quarantine
+}
+
+// Action is a resolution step on a single duplicate: Target is deleted, quarantined, trashed or replaced
+// by a link to Keep. Keep may only be empty when the target is removed without a replacement, i.e. when a
+// whole group is removed. Checksum, if set, is the checksum both files are expected to have.
+type Action struct {
+	Type     ActionType
+	Keep     string
+	Target   string
+	Checksum string
+}
+
+// ActionResult is the outcome of applying an action. Info holds the metadata of the target right before
+// the action, and Freed the bytes actually released on disk.
+type ActionResult struct {
+	Action *Action
+	Info   os.FileInfo
+	Freed  int64
+	// Location is where the target was moved to by quarantine and trash actions.
+	Location string
+	DryRun   bool
+	Err      error
+}
+
+type resolver struct {
+	options *ResolverOptions
+	roots   *rootCache
+}
+
+// NewResolver returns a resolver that applies resolution actions safely: before acting it re-stats (and
+// optionally re-hashes) the survivor and the duplicate, replacements are staged under a temporary name
+// and renamed over the duplicate, and the result is verified afterwards.
+func NewResolver() IResolver {
+	return &resolver{options: &ResolverOptions{}, roots: newRootCache()}
+}
+
+func (r *resolver) SetOptions(opts *ResolverOptions) {
+	r.options = opts
+	r.roots = newRootCache()
+}
+
+func (r *resolver) Apply(action *Action) *ActionResult {
+	ret := &ActionResult{Action: action, DryRun: r.options.DryRun}
+
+	info, err := r.preflight(action)
+	ret.Info = info
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	if action.Type == ActionQuarantine && r.options.Quarantine == nil {
+		ret.Err = fmt.Errorf("unable to quarantine %s, no quarantine directory was set", action.Target)
+		return ret
+	}
+	if r.options.DryRun {
+		return ret
+	}
+	var entry *JournalEntry
+	if r.options.Journal != nil {
+		if entry, err = r.options.Journal.Record(action, info); err != nil {
+			ret.Err = fmt.Errorf("refusing to %s %s without journaling it, %s", action.Type, action.Target, err.Error())
+			return ret
+		}
+		if action.Type == ActionQuarantine {
+			entry.Quarantine = r.options.Quarantine.Dir()
+		}
+	}
+
+	r.apply(action, info, ret)
+
+	if entry != nil {
+		if err := r.options.Journal.Finish(entry, ret.Location, ret.Err); err != nil && ret.Err == nil {
+			ret.Err = fmt.Errorf("the outcome of the action could not be journaled, %s", err.Error())
+		}
+	}
+	return ret
+}
+
+func (r *resolver) apply(action *Action, info os.FileInfo, ret *ActionResult) {
+	switch action.Type {
+	case ActionDelete:
+		ret.Err = r.delete(action)
+		ret.Freed = freedBytes(info, ret.Err)
+	case ActionSymlink:
+		ret.Err = r.symlink(action)
+		ret.Freed = freedBytes(info, ret.Err)
+	case ActionHardlink:
+		ret.Freed, ret.Err = r.hardlink(action)
+	case ActionQuarantine:
+		// Quarantined files still take space until they are purged.
+		ret.Location, ret.Err = r.quarantine(action, info)
+	case ActionTrash:
+		// Same as quarantined ones, trashed files still take space until the trash is emptied.
+		ret.Location, ret.Err = r.trash(action)
+	default:
+		ret.Err = fmt.Errorf("unknown action '%s'", action.Type)
+	}
+}
+
+// preflight checks that the action is still safe to apply and returns the current metadata of the target.
+func (r *resolver) preflight(action *Action) (os.FileInfo, error) {
+	if r.roots.underAny(action.Target, r.options.References) {
+		return nil, fmt.Errorf("refusing to modify %s, it is a reference file", action.Target)
+	}
+	if action.Keep == "" && action.Type != ActionDelete && action.Type != ActionQuarantine && action.Type != ActionTrash {
+		return nil, fmt.Errorf("unable to %s %s, no file to keep was given", action.Type, action.Target)
+	}
+	if action.Keep != "" && filepath.Clean(action.Keep) == filepath.Clean(action.Target) {
+		return nil, fmt.Errorf("refusing to %s %s, it is the file to keep", action.Type, action.Target)
+	}
+
+	info, err := os.Lstat(action.Target)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file info of %s, %s", action.Target, err.Error())
+	}
+	if !info.Mode().IsRegular() {
+		return info, fmt.Errorf("%s is no longer a regular file, %w", action.Target, ErrChanged)
+	}
+
+	if action.Keep != "" {
+		keepInfo, err := os.Lstat(action.Keep)
+		if err != nil {
+			return info, fmt.Errorf("the file to keep %s is not available, %s", action.Keep, err.Error())
+		}
+		if !keepInfo.Mode().IsRegular() {
+			return info, fmt.Errorf("the file to keep %s is no longer a regular file, %w", action.Keep, ErrChanged)
+		}
+		// The same file reached through another path (e.g. a bind mount or a hard link) is not a copy, acting
+		// on it frees nothing, and with a single link it is the only copy of its contents.
+		if os.SameFile(keepInfo, info) {
+			return info, fmt.Errorf("refusing to %s %s, it is the same file as %s", action.Type, action.Target, action.Keep)
+		}
+		if keepInfo.Size() != info.Size() {
+			return info, fmt.Errorf("%s and %s no longer have the same size, %w", action.Keep, action.Target, ErrChanged)
+		}
+		if !r.options.Rehash && modifiedSince(keepInfo, r.options.Since) {
+			return info, fmt.Errorf("the file to keep %s was modified since it was scanned, %w", action.Keep, ErrChanged)
+		}
+	}
+
+	if !r.options.Rehash {
+		if modifiedSince(info, r.options.Since) {
+			return info, fmt.Errorf("%s was modified since it was scanned, %w", action.Target, ErrChanged)
+		}
+		return info, nil
+	}
+
+	h := &service{options: &Options{Mode: r.options.Mode, IOMode: r.options.IOMode}}
+	targetSum, err := h.getHash(action.Target)
+	if err != nil {
+		return info, err
+	}
+	if action.Checksum != "" && targetSum != action.Checksum {
+		return info, fmt.Errorf("the checksum of %s no longer matches, %w", action.Target, ErrChanged)
+	}
+	if action.Keep != "" {
+		keepSum, err := h.getHash(action.Keep)
+		if err != nil {
+			return info, err
+		}
+		if keepSum != targetSum {
+			return info, fmt.Errorf("%s and %s no longer have the same contents, %w", action.Keep, action.Target, ErrChanged)
+		}
+	}
+	return info, nil
+}
+
+func (r *resolver) delete(action *Action) error {
+	if err := os.Remove(action.Target); err != nil {
+		return fmt.Errorf("unable to delete file %s, %s", action.Target, err.Error())
+	}
+	if _, err := os.Lstat(action.Target); !os.IsNotExist(err) {
+		return fmt.Errorf("verification failed, %s still exists after deleting it", action.Target)
+	}
+	return nil
+}
+
+// symlink replaces the target with a symbolic link to the absolute path of the file to keep. The link
+// is created under a temporary name and renamed over the target, so the target is never missing.
+func (r *resolver) symlink(action *Action) error {
+	src, err := filepath.Abs(action.Keep)
+	if err != nil {
+		return err
+	}
+	tmp, err := tempName(action.Target)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(src, tmp); err != nil {
+		return fmt.Errorf("unable to create symbolic link to %s, %s", src, err.Error())
+	}
+	if err := os.Rename(tmp, action.Target); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("unable to replace %s with a symbolic link, %s", action.Target, err.Error())
+	}
+
+	dest, err := os.Readlink(action.Target)
+	if err != nil || dest != src {
+		return fmt.Errorf("verification failed, %s is not a symbolic link to %s", action.Target, src)
+	}
+	if !sameFile(action.Target, action.Keep) {
+		return fmt.Errorf("verification failed, %s does not resolve to %s", action.Target, action.Keep)
+	}
+	return nil
+}
+
+func (r *resolver) hardlink(action *Action) (int64, error) {
+	freed, err := Hardlink(action.Keep, action.Target)
+	if err != nil {
+		return 0, err
+	}
+	if !sameFile(action.Target, action.Keep) {
+		return freed, fmt.Errorf("verification failed, %s is not a hard link to %s", action.Target, action.Keep)
+	}
+	return freed, nil
+}
+
+func (r *resolver) quarantine(action *Action, info os.FileInfo) (string, error) {
+	entry, err := r.options.Quarantine.Add(action, info)
+	if err != nil {
+		return "", err
+	}
+	location := filepath.Join(r.options.Quarantine.Dir(), entry.Stored)
+	if _, err := os.Lstat(action.Target); !os.IsNotExist(err) {
+		return location, fmt.Errorf("verification failed, %s still exists after moving it to quarantine", action.Target)
+	}
+	return location, nil
+}
+
+func (r *resolver) trash(action *Action) (string, error) {
+	location, err := Trash(action.Target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(action.Target); !os.IsNotExist(err) {
+		return location, fmt.Errorf("verification failed, %s still exists after moving it to the trash", action.Target)
+	}
+	return location, nil
+}
+
+func modifiedSince(info os.FileInfo, since time.Time) bool {
+	return !since.IsZero() && info.ModTime().After(since)
+}
+
+func sameFile(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
+}
+
+// freedBytes returns the bytes released by removing the last name of a file.
+func freedBytes(info os.FileInfo, err error) int64 {
+	if err != nil || linkCount(info) > 1 {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,225 @@
+package dedupe
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolverPreflight(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, dir string) *Action
+		opts    ResolverOptions
+		wantErr bool
+		changed bool
+	}{
+		{
+			name: "identical copies",
+			setup: func(t *testing.T, dir string) *Action {
+				return &Action{Type: ActionDelete, Keep: writeFile(t, filepath.Join(dir, "a"), "data", past), Target: writeFile(t, filepath.Join(dir, "b"), "data", past)}
+			},
+		},
+		{
+			name: "same path",
+			setup: func(t *testing.T, dir string) *Action {
+				f := writeFile(t, filepath.Join(dir, "a"), "data", past)
+				return &Action{Type: ActionDelete, Keep: f, Target: filepath.Join(dir, ".", "a")}
+			},
+			wantErr: true,
+		},
+		{
+			name: "same file through a symlinked directory",
+			setup: func(t *testing.T, dir string) *Action {
+				f := writeFile(t, filepath.Join(dir, "real", "a"), "data", past)
+				if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "alias")); err != nil {
+					t.Skip(err)
+				}
+				return &Action{Type: ActionDelete, Keep: f, Target: filepath.Join(dir, "alias", "a")}
+			},
+			wantErr: true,
+		},
+		{
+			name: "hard links to the same file",
+			setup: func(t *testing.T, dir string) *Action {
+				f := writeFile(t, filepath.Join(dir, "a"), "data", past)
+				if err := os.Link(f, filepath.Join(dir, "b")); err != nil {
+					t.Skip(err)
+				}
+				return &Action{Type: ActionDelete, Keep: f, Target: filepath.Join(dir, "b")}
+			},
+			wantErr: true,
+		},
+		{
+			name: "relinking a hard link to the kept file",
+			setup: func(t *testing.T, dir string) *Action {
+				f := writeFile(t, filepath.Join(dir, "a"), "data", past)
+				if err := os.Link(f, filepath.Join(dir, "b")); err != nil {
+					t.Skip(err)
+				}
+				return &Action{Type: ActionHardlink, Keep: f, Target: filepath.Join(dir, "b")}
+			},
+			wantErr: true,
+		},
+		{
+			name: "different sizes",
+			setup: func(t *testing.T, dir string) *Action {
+				return &Action{Type: ActionDelete, Keep: writeFile(t, filepath.Join(dir, "a"), "data", past), Target: writeFile(t, filepath.Join(dir, "b"), "longer", past)}
+			},
+			wantErr: true,
+			changed: true,
+		},
+		{
+			name: "target modified after the scan",
+			setup: func(t *testing.T, dir string) *Action {
+				return &Action{Type: ActionDelete, Keep: writeFile(t, filepath.Join(dir, "a"), "data", past), Target: writeFile(t, filepath.Join(dir, "b"), "DATA", time.Time{})}
+			},
+			opts:    ResolverOptions{Since: past.Add(time.Minute)},
+			wantErr: true,
+			changed: true,
+		},
+		{
+			name: "kept file modified after the scan",
+			setup: func(t *testing.T, dir string) *Action {
+				return &Action{Type: ActionDelete, Keep: writeFile(t, filepath.Join(dir, "a"), "DATA", time.Time{}), Target: writeFile(t, filepath.Join(dir, "b"), "data", past)}
+			},
+			opts:    ResolverOptions{Since: past.Add(time.Minute)},
+			wantErr: true,
+			changed: true,
+		},
+		{
+			name: "modified but rehashed with the same contents",
+			setup: func(t *testing.T, dir string) *Action {
+				return &Action{Type: ActionDelete, Keep: writeFile(t, filepath.Join(dir, "a"), "data", past), Target: writeFile(t, filepath.Join(dir, "b"), "data", time.Time{}), Checksum: sha256Of("data")}
+			},
+			opts: ResolverOptions{Mode: HashSHA256, Rehash: true, Since: past.Add(time.Minute)},
+		},
+		{
+			name: "rehashed with different contents",
+			setup: func(t *testing.T, dir string) *Action {
+				return &Action{Type: ActionDelete, Keep: writeFile(t, filepath.Join(dir, "a"), "data", past), Target: writeFile(t, filepath.Join(dir, "b"), "DATA", past), Checksum: sha256Of("data")}
+			},
+			opts:    ResolverOptions{Mode: HashSHA256, Rehash: true},
+			wantErr: true,
+			changed: true,
+		},
+		{
+			name: "reference target",
+			setup: func(t *testing.T, dir string) *Action {
+				return &Action{Type: ActionDelete, Keep: writeFile(t, filepath.Join(dir, "a"), "data", past), Target: writeFile(t, filepath.Join(dir, "ref", "b"), "data", past)}
+			},
+			opts:    ResolverOptions{References: []string{"ref"}},
+			wantErr: true,
+		},
+		{
+			name: "symlink without a file to keep",
+			setup: func(t *testing.T, dir string) *Action {
+				return &Action{Type: ActionSymlink, Target: writeFile(t, filepath.Join(dir, "b"), "data", past)}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			action := tt.setup(t, dir)
+			opts := tt.opts
+			for i, ref := range opts.References {
+				opts.References[i] = filepath.Join(dir, ref)
+			}
+			r := &resolver{options: &opts}
+
+			_, err := r.preflight(action)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("preflight() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrChanged) != tt.changed {
+				t.Errorf("preflight() error = %v, want ErrChanged %v", err, tt.changed)
+			}
+		})
+	}
+}
+
+func TestResolverApply(t *testing.T) {
+	tests := []struct {
+		action ActionType
+		check  func(t *testing.T, keep, target string)
+	}{
+		{ActionDelete, func(t *testing.T, keep, target string) {
+			if exists(target) {
+				t.Errorf("%s still exists", target)
+			}
+		}},
+		{ActionSymlink, func(t *testing.T, keep, target string) {
+			if dest, err := os.Readlink(target); err != nil || dest != keep {
+				t.Errorf("%s is not a symlink to %s", target, keep)
+			}
+		}},
+		{ActionHardlink, func(t *testing.T, keep, target string) {
+			if !sameFile(keep, target) {
+				t.Errorf("%s is not a hard link to %s", target, keep)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			dir := t.TempDir()
+			keep := writeFile(t, filepath.Join(dir, "a"), "data", past)
+			target := writeFile(t, filepath.Join(dir, "b"), "data", past)
+
+			r := NewResolver()
+			r.SetOptions(&ResolverOptions{Mode: HashSHA256, Since: time.Now()})
+			res := r.Apply(&Action{Type: tt.action, Keep: keep, Target: target})
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			tt.check(t, keep, target)
+			if res.Freed != 4 {
+				t.Errorf("Freed = %d, want 4", res.Freed)
+			}
+			if got := readFile(t, keep); got != "data" {
+				t.Errorf("kept file contents = %q", got)
+			}
+		})
+	}
+}
+
+func TestResolverSameInode(t *testing.T) {
+	for _, action := range []ActionType{ActionDelete, ActionSymlink, ActionHardlink} {
+		t.Run(string(action), func(t *testing.T) {
+			dir := t.TempDir()
+			keep := writeFile(t, filepath.Join(dir, "a"), "data", past)
+			target := filepath.Join(dir, "b")
+			if err := os.Link(keep, target); err != nil {
+				t.Skip(err)
+			}
+
+			res := NewResolver().Apply(&Action{Type: action, Keep: keep, Target: target})
+			if res.Err == nil || res.Freed != 0 {
+				t.Errorf("Apply() = %v, freed %d, want a refusal", res.Err, res.Freed)
+			}
+			if !sameFile(keep, target) {
+				t.Errorf("%s was modified", target)
+			}
+		})
+	}
+}
+
+func TestResolverDryRun(t *testing.T) {
+	dir := t.TempDir()
+	keep := writeFile(t, filepath.Join(dir, "a"), "data", past)
+	target := writeFile(t, filepath.Join(dir, "b"), "data", past)
+
+	r := NewResolver()
+	r.SetOptions(&ResolverOptions{DryRun: true})
+	if res := r.Apply(&Action{Type: ActionDelete, Keep: keep, Target: target}); res.Err != nil || !res.DryRun {
+		t.Fatalf("Apply() = %+v", res)
+	}
+	if !exists(target) {
+		t.Errorf("dry run deleted %s", target)
+	}
+}
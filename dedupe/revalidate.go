@@ -0,0 +1,125 @@
+package dedupe
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	StaleMissing = StaleReason("missing")
+	StaleChanged = StaleReason("changed")
+)
+
+// StaleReason is why a file of a report can no longer be trusted.
+type StaleReason string
+
+// RevalidateOptions indicates how the files of a report are checked against the file system.
+type RevalidateOptions struct {
+	// Mode is the hashing algorithm the checksums of the report were calculated with.
+	Mode   HashMode
+	IOMode IOMode
+	// Rehash re-calculates the checksum of every file, instead of only checking its size and modification
+	// time.
+	Rehash bool
+}
+
+// StaleFile is a file of a report that was moved, deleted or modified since the report was created.
+type StaleFile struct {
+	Checksum string
+	Path     string
+	Reason   StaleReason
+	Detail   string
+}
+
+// Staleness summarizes what changed since a report was created.
+type Staleness struct {
+	// Checked is the number of files that were checked.
+	Checked int
+	Files   []*StaleFile
+	// Dissolved are the checksums of the groups left with less than two files.
+	Dissolved []string
+}
+
+// Count returns the number of stale files with the given reason.
+func (s *Staleness) Count(reason StaleReason) int {
+	n := 0
+	for _, f := range s.Files {
+		if f.Reason == reason {
+			n++
+		}
+	}
+	return n
+}
+
+// Revalidate checks every file of the pending groups of the report against the file system. Missing and
+// changed files are removed from their groups and recorded as errors of the report, and groups left with
+// less than two files are removed. Groups already resolved are not checked, their files are expected to
+// be gone.
+func (r *DupeReport) Revalidate(opts *RevalidateOptions) *Staleness {
+	if opts == nil {
+		opts = &RevalidateOptions{}
+	}
+	h := &service{options: &Options{Mode: opts.Mode, IOMode: opts.IOMode}}
+	ret := &Staleness{}
+
+	for _, g := range r.Groups() {
+		if r.IsResolved(g.Checksum) {
+			continue
+		}
+
+		var valid []string
+		for _, f := range g.Files {
+			ret.Checked++
+			reason, detail := r.checkFile(h, opts, g, f)
+			if reason == "" {
+				valid = append(valid, f)
+				continue
+			}
+			ret.Files = append(ret.Files, &StaleFile{Checksum: g.Checksum, Path: f, Reason: reason, Detail: detail})
+			r.Errors = append(r.Errors, fmt.Errorf("stale file %s, %s", f, detail))
+		}
+
+		switch {
+		case len(valid) < 2:
+			ret.Dissolved = append(ret.Dissolved, g.Checksum)
+			delete(r.Dupes, g.Checksum)
+			delete(r.Sizes, g.Checksum)
+			delete(r.Resolutions, g.Checksum)
+		case len(valid) < len(g.Files):
+			r.Dupes[g.Checksum] = valid
+		}
+	}
+	return ret
+}
+
+func (r *DupeReport) checkFile(h *service, opts *RevalidateOptions, g *DupeGroup, file string) (StaleReason, string) {
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return StaleMissing, "it no longer exists"
+	}
+	if err != nil {
+		return StaleMissing, err.Error()
+	}
+	if !info.Mode().IsRegular() {
+		return StaleChanged, "it is no longer a regular file"
+	}
+	if g.Size >= 0 && info.Size() != g.Size {
+		return StaleChanged, fmt.Sprintf("its size is %d bytes instead of %d", info.Size(), g.Size)
+	}
+
+	if opts.Rehash {
+		sum, err := h.getHash(file)
+		if err != nil {
+			return StaleChanged, err.Error()
+		}
+		if sum != g.Checksum {
+			return StaleChanged, "its checksum no longer matches"
+		}
+		return "", ""
+	}
+
+	if !r.Created.IsZero() && info.ModTime().After(r.Created) {
+		return StaleChanged, "it was modified on " + info.ModTime().Format("2006-01-02 15:04:05")
+	}
+	return "", ""
+}
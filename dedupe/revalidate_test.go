@@ -0,0 +1,152 @@
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRevalidate(t *testing.T) {
+	created := past.Add(time.Minute)
+
+	tests := []struct {
+		name   string
+		files  int
+		change func(t *testing.T, files []string)
+		rehash bool
+		// wantStale maps the index of each stale file to its reason.
+		wantStale     map[int]StaleReason
+		wantDissolved bool
+	}{
+		{name: "unchanged", files: 2},
+		{
+			name:      "missing file",
+			files:     3,
+			change:    func(t *testing.T, files []string) { os.Remove(files[2]) },
+			wantStale: map[int]StaleReason{2: StaleMissing},
+		},
+		{
+			name:          "modified after the report",
+			files:         2,
+			change:        func(t *testing.T, files []string) { writeFile(t, files[1], "data", created.Add(time.Minute)) },
+			wantStale:     map[int]StaleReason{1: StaleChanged},
+			wantDissolved: true,
+		},
+		{
+			name:          "different size",
+			files:         2,
+			change:        func(t *testing.T, files []string) { writeFile(t, files[0], "longer", past) },
+			wantStale:     map[int]StaleReason{0: StaleChanged},
+			wantDissolved: true,
+		},
+		{
+			name:      "no longer a regular file",
+			files:     3,
+			change:    func(t *testing.T, files []string) { os.Remove(files[0]); os.Mkdir(files[0], 0755) },
+			wantStale: map[int]StaleReason{0: StaleChanged},
+		},
+		{
+			name:          "every file missing",
+			files:         2,
+			change:        func(t *testing.T, files []string) { os.Remove(files[0]); os.Remove(files[1]) },
+			wantStale:     map[int]StaleReason{0: StaleMissing, 1: StaleMissing},
+			wantDissolved: true,
+		},
+		{
+			name:   "same size and time, other contents",
+			files:  2,
+			change: func(t *testing.T, files []string) { writeFile(t, files[1], "DATA", past) },
+		},
+		{
+			name:          "same size and time, other contents, rehashed",
+			files:         2,
+			change:        func(t *testing.T, files []string) { writeFile(t, files[1], "DATA", past) },
+			rehash:        true,
+			wantStale:     map[int]StaleReason{1: StaleChanged},
+			wantDissolved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var files []string
+			for i := 0; i < tt.files; i++ {
+				files = append(files, writeFile(t, filepath.Join(dir, string(rune('a'+i))), "data", past))
+			}
+			other := []string{writeFile(t, filepath.Join(dir, "other", "a"), "x", past), writeFile(t, filepath.Join(dir, "other", "b"), "x", past)}
+			sum, otherSum := sha256Of("data"), sha256Of("x")
+			report := &DupeReport{
+				Created: created,
+				Dupes:   map[string][]string{sum: files, otherSum: other},
+				Sizes:   map[string]int64{sum: 4, otherSum: 1},
+			}
+			if tt.change != nil {
+				tt.change(t, files)
+			}
+
+			stale := report.Revalidate(&RevalidateOptions{Mode: HashSHA256, Rehash: tt.rehash})
+
+			if stale.Checked != tt.files+2 {
+				t.Errorf("Checked = %d, want %d", stale.Checked, tt.files+2)
+			}
+			got := map[int]StaleReason{}
+			for _, f := range stale.Files {
+				for i, file := range files {
+					if f.Path == file && f.Checksum == sum {
+						got[i] = f.Reason
+					}
+				}
+			}
+			want := tt.wantStale
+			if want == nil {
+				want = map[int]StaleReason{}
+			}
+			if len(got) != len(stale.Files) || !reflect.DeepEqual(got, want) {
+				t.Errorf("stale files = %v, want %v", got, want)
+			}
+			if len(report.Errors) != len(stale.Files) {
+				t.Errorf("Errors = %v, want one per stale file", report.Errors)
+			}
+
+			if tt.wantDissolved {
+				if !reflect.DeepEqual(stale.Dissolved, []string{sum}) {
+					t.Errorf("Dissolved = %v, want %s", stale.Dissolved, sum)
+				}
+				if _, ok := report.Dupes[sum]; ok {
+					t.Errorf("the dissolved group is still in the report")
+				}
+				if _, ok := report.Sizes[sum]; ok {
+					t.Errorf("the size of the dissolved group is still in the report")
+				}
+			} else {
+				if len(stale.Dissolved) != 0 {
+					t.Errorf("Dissolved = %v", stale.Dissolved)
+				}
+				if want := tt.files - len(tt.wantStale); len(report.Dupes[sum]) != want {
+					t.Errorf("group = %v, want %d files", report.Dupes[sum], want)
+				}
+			}
+			if !reflect.DeepEqual(report.Dupes[otherSum], other) {
+				t.Errorf("the unchanged group = %v, want %v", report.Dupes[otherSum], other)
+			}
+		})
+	}
+}
+
+func TestRevalidateSkipsResolvedGroups(t *testing.T) {
+	dir := t.TempDir()
+	kept := writeFile(t, filepath.Join(dir, "a"), "data", past)
+	report := &DupeReport{
+		Dupes: map[string][]string{sha256Of("data"): {kept, filepath.Join(dir, "deleted")}},
+		Sizes: map[string]int64{sha256Of("data"): 4},
+	}
+	report.SetResolution(sha256Of("data"), &Resolution{Decision: DecisionDeleted, Outcome: OutcomeDone})
+
+	stale := report.Revalidate(nil)
+	if stale.Checked != 0 || len(stale.Files) != 0 || len(stale.Dissolved) != 0 || len(report.Dupes) != 1 {
+		t.Errorf("Revalidate() = %+v, report %v", stale, report.Dupes)
+	}
+}
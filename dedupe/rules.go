@@ -0,0 +1,265 @@
+package dedupe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	RuleKeep     = RuleAction("keep")
+	RuleDelete   = RuleAction("delete")
+	RuleLink     = RuleAction("link")
+	RuleHardlink = RuleAction("hardlink")
+	RuleSkip     = RuleAction("skip")
+)
+
+// RuleAction is what a rule decides for the files its condition matches.
+type RuleAction string
+
+// RuleSet is a list of user defined resolution rules, loaded from a rule file. Each non empty line of
+// the file that is not a comment ('#') is either a rule or the default action:
+//
+//	<keep|delete|link|hardlink|skip> if <expression>
+//	default <delete|link|hardlink|skip>
+//
+// The 'keep' rules rank the files of a group: the survivor is the file matching the earliest 'keep'
+// rule, ties are broken in lexicographic order, and groups where no file matches a 'keep' rule are left
+// untouched. Every other file gets the action of the first 'delete', 'link' (symbolic), 'hardlink' or
+// 'skip' rule it matches, or the default action ('skip' unless set otherwise). Files in a reference root
+// are always skipped.
+//
+// Expressions are evaluated against each file and may use the attributes path, name, ext, dir, size,
+// mtime (unix seconds), depth, root (index of the scanned root holding the file), the group aggregates
+// newest, oldest (mtimes), count and wasted (reclaimable bytes), and now. Supported operators are + and -
+// on numbers, == != < <= > >=, ~ and !~ to match glob patterns ('*' does not match '/', '**' does), and,
+// or, not and parentheses. Numbers accept the units KB, MB, GB, TB and s, m, h, d, so that e.g.
+// 'mtime < now - 30d' selects the files not modified in the last 30 days. The functions under(path),
+// contains(s, sub), lower(s) and date("2006-01-02") are available.
+type RuleSet struct {
+	Rules   []*Rule
+	Default RuleAction
+}
+
+// Rule is a single line of a rule file.
+type Rule struct {
+	Line   int
+	Action RuleAction
+	Source string
+	expr   node
+}
+
+// RuleMatch is the outcome of evaluating a rule against a file.
+type RuleMatch struct {
+	Rule    *Rule
+	Matched bool
+	Err     error
+}
+
+// FileDecision is the action decided for a file of a group, along with the rule that decided it (nil if
+// it was the default action) and the evaluation of every rule against the file.
+type FileDecision struct {
+	Path    string
+	Action  RuleAction
+	Rule    *Rule
+	Reason  string
+	Matches []RuleMatch
+}
+
+// Decision is the outcome of applying a rule set to a group of duplicates. Keep is empty when no file
+// matched a 'keep' rule, or when a rule could not be evaluated (see Err), in which case all the files are
+// skipped.
+type Decision struct {
+	Keep  string
+	Files []*FileDecision
+	// Err is the first error evaluating a rule. A group is never resolved on a partial evaluation, as the
+	// keep could fall to another file or a delete rule could be silently ignored.
+	Err error
+}
+
+// LoadRules reads a rule file.
+func LoadRules(file string) (*RuleSet, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rules file %s, %s", file, err.Error())
+	}
+	defer f.Close()
+
+	rs, err := ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return rs, nil
+}
+
+// ParseRules parses the rules read from r. See RuleSet for the format.
+func ParseRules(r io.Reader) (*RuleSet, error) {
+	rs := &RuleSet{Default: RuleSkip}
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		action := RuleAction(fields[0])
+
+		if fields[0] == "default" {
+			if len(fields) != 2 || !isRuleAction(RuleAction(fields[1])) || RuleAction(fields[1]) == RuleKeep {
+				return nil, fmt.Errorf("line %d: expected 'default <delete|link|hardlink|skip>'", line)
+			}
+			rs.Default = RuleAction(fields[1])
+			continue
+		}
+
+		if !isRuleAction(action) {
+			return nil, fmt.Errorf("line %d: unknown action '%s', expected keep, delete, link, hardlink or skip", line, fields[0])
+		}
+		if len(fields) < 3 || fields[1] != "if" {
+			return nil, fmt.Errorf("line %d: expected '%s if <expression>'", line, action)
+		}
+
+		src := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(text, fields[0])), "if"))
+		expr, err := parseExpr(src)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		rs.Rules = append(rs.Rules, &Rule{Line: line, Action: action, Source: src, expr: expr})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func isRuleAction(a RuleAction) bool {
+	return a == RuleKeep || a == RuleDelete || a == RuleLink || a == RuleHardlink || a == RuleSkip
+}
+
+// eval evaluates the rule condition for a file. The error is non nil if the expression could not be
+// evaluated, e.g. when comparing values of different types.
+func (r *Rule) eval(env *ruleEnv) (bool, error) {
+	v, err := r.expr.eval(env)
+	if err != nil {
+		return false, err
+	}
+	if v.kind != kindBool {
+		return false, fmt.Errorf("the expression evaluates to a %s instead of a bool", v.kind)
+	}
+	return v.b, nil
+}
+
+func (r *Rule) String() string {
+	return fmt.Sprintf("line %d: %s if %s", r.Line, r.Action, r.Source)
+}
+
+// Decide applies the rules to a group of duplicates of the given report.
+func (rs *RuleSet) Decide(report *DupeReport, files []string) (*Decision, error) {
+	envs := make([]*ruleEnv, len(files))
+	now := time.Now()
+
+	for i, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read file info of %s, %s", f, err.Error())
+		}
+		envs[i] = &ruleEnv{
+			path:   f,
+			size:   info.Size(),
+			mtime:  info.ModTime(),
+			depth:  depth(f),
+			root:   report.RootIndex(f),
+			count:  len(files),
+			wasted: info.Size() * int64(len(files)-1),
+			now:    now,
+		}
+	}
+	for _, env := range envs {
+		for _, other := range envs {
+			if env.newest.IsZero() || other.mtime.After(env.newest) {
+				env.newest = other.mtime
+			}
+			if env.oldest.IsZero() || other.mtime.Before(env.oldest) {
+				env.oldest = other.mtime
+			}
+		}
+	}
+
+	ret := &Decision{}
+	keepRank := map[string]int{}
+
+	for i, f := range files {
+		fd := &FileDecision{Path: f}
+		for _, r := range rs.Rules {
+			matched, err := r.eval(envs[i])
+			fd.Matches = append(fd.Matches, RuleMatch{Rule: r, Matched: matched, Err: err})
+			if err != nil && ret.Err == nil {
+				ret.Err = fmt.Errorf("the rule at line %d could not be evaluated on %s, %s", r.Line, f, err.Error())
+			}
+			if !matched {
+				continue
+			}
+			if r.Action == RuleKeep {
+				if _, ok := keepRank[f]; !ok {
+					keepRank[f] = r.Line
+				}
+			} else if fd.Rule == nil {
+				fd.Rule = r
+				fd.Action = r.Action
+			}
+		}
+		ret.Files = append(ret.Files, fd)
+	}
+
+	var ranked []string
+	for f := range keepRank {
+		ranked = append(ranked, f)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if keepRank[ranked[i]] != keepRank[ranked[j]] {
+			return keepRank[ranked[i]] < keepRank[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	if len(ranked) > 0 && ret.Err == nil {
+		ret.Keep = ranked[0]
+	}
+
+	for _, fd := range ret.Files {
+		switch {
+		case ret.Err != nil:
+			fd.Action, fd.Rule = RuleSkip, nil
+			fd.Reason = "a rule could not be evaluated on the group"
+		case ret.Keep == "":
+			fd.Action, fd.Rule = RuleSkip, nil
+			fd.Reason = "no file of the group matched a keep rule"
+		case fd.Path == ret.Keep:
+			fd.Action = RuleKeep
+			fd.Rule = nil
+			for _, m := range fd.Matches {
+				if m.Matched && m.Rule.Action == RuleKeep {
+					fd.Rule = m.Rule
+					break
+				}
+			}
+			fd.Reason = "survivor, best ranked by the keep rules"
+		case report.IsReference(fd.Path):
+			fd.Action, fd.Rule = RuleSkip, nil
+			fd.Reason = "reference files are never modified"
+		case fd.Rule != nil:
+			fd.Reason = "first matching rule"
+		default:
+			fd.Action = rs.Default
+			fd.Reason = "no rule matched, default action"
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,593 @@
+package dedupe
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type valueKind int
+
+const (
+	kindNumber valueKind = iota
+	kindString
+	kindBool
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindString:
+		return "string"
+	default:
+		return "bool"
+	}
+}
+
+type value struct {
+	kind valueKind
+	num  float64
+	str  string
+	b    bool
+}
+
+func numberValue(n float64) value { return value{kind: kindNumber, num: n} }
+func stringValue(s string) value  { return value{kind: kindString, str: s} }
+func boolValue(b bool) value      { return value{kind: kindBool, b: b} }
+
+// ruleEnv holds the attributes of the file a rule expression is evaluated against, along with the
+// aggregates of its group.
+type ruleEnv struct {
+	path   string
+	size   int64
+	mtime  time.Time
+	depth  int
+	root   int
+	newest time.Time
+	oldest time.Time
+	count  int
+	wasted int64
+	now    time.Time
+}
+
+type node interface {
+	eval(env *ruleEnv) (value, error)
+}
+
+type literalNode struct{ v value }
+
+type identNode struct{ name string }
+
+type callNode struct {
+	name string
+	args []node
+}
+
+type unaryNode struct {
+	op string
+	x  node
+}
+
+type binaryNode struct {
+	op   string
+	l, r node
+}
+
+var ruleIdents = map[string]func(env *ruleEnv) value{
+	"path":   func(env *ruleEnv) value { return stringValue(filepath.ToSlash(env.path)) },
+	"name":   func(env *ruleEnv) value { return stringValue(filepath.Base(env.path)) },
+	"ext":    func(env *ruleEnv) value { return stringValue(strings.TrimPrefix(filepath.Ext(env.path), ".")) },
+	"dir":    func(env *ruleEnv) value { return stringValue(filepath.ToSlash(filepath.Dir(env.path))) },
+	"size":   func(env *ruleEnv) value { return numberValue(float64(env.size)) },
+	"mtime":  func(env *ruleEnv) value { return numberValue(float64(env.mtime.Unix())) },
+	"depth":  func(env *ruleEnv) value { return numberValue(float64(env.depth)) },
+	"root":   func(env *ruleEnv) value { return numberValue(float64(env.root)) },
+	"newest": func(env *ruleEnv) value { return numberValue(float64(env.newest.Unix())) },
+	"oldest": func(env *ruleEnv) value { return numberValue(float64(env.oldest.Unix())) },
+	"count":  func(env *ruleEnv) value { return numberValue(float64(env.count)) },
+	"wasted": func(env *ruleEnv) value { return numberValue(float64(env.wasted)) },
+	"now":    func(env *ruleEnv) value { return numberValue(float64(env.now.Unix())) },
+	"true":   func(env *ruleEnv) value { return boolValue(true) },
+	"false":  func(env *ruleEnv) value { return boolValue(false) },
+}
+
+var ruleFuncs = map[string]struct {
+	args []valueKind
+	fn   func(env *ruleEnv, args []value) (value, error)
+}{
+	"under": {[]valueKind{kindString}, func(env *ruleEnv, args []value) (value, error) {
+		return boolValue(under(env.path, args[0].str)), nil
+	}},
+	"contains": {[]valueKind{kindString, kindString}, func(env *ruleEnv, args []value) (value, error) {
+		return boolValue(strings.Contains(args[0].str, args[1].str)), nil
+	}},
+	"lower": {[]valueKind{kindString}, func(env *ruleEnv, args []value) (value, error) {
+		return stringValue(strings.ToLower(args[0].str)), nil
+	}},
+	"date": {[]valueKind{kindString}, func(env *ruleEnv, args []value) (value, error) {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, args[0].str, time.Local); err == nil {
+				return numberValue(float64(t.Unix())), nil
+			}
+		}
+		return value{}, fmt.Errorf("invalid date '%s'", args[0].str)
+	}},
+}
+
+func (n *literalNode) eval(*ruleEnv) (value, error) { return n.v, nil }
+
+func (n *identNode) eval(env *ruleEnv) (value, error) {
+	return ruleIdents[n.name](env), nil
+}
+
+func (n *callNode) eval(env *ruleEnv) (value, error) {
+	f := ruleFuncs[n.name]
+	args := make([]value, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		if v.kind != f.args[i] {
+			return value{}, fmt.Errorf("%s() expects a %s as argument %d, got a %s", n.name, f.args[i], i+1, v.kind)
+		}
+		args[i] = v
+	}
+	return f.fn(env, args)
+}
+
+func (n *unaryNode) eval(env *ruleEnv) (value, error) {
+	v, err := n.x.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+	switch n.op {
+	case "not":
+		if v.kind != kindBool {
+			return value{}, fmt.Errorf("'not' expects a bool, got a %s", v.kind)
+		}
+		return boolValue(!v.b), nil
+	default:
+		if v.kind != kindNumber {
+			return value{}, fmt.Errorf("'-' expects a number, got a %s", v.kind)
+		}
+		return numberValue(-v.num), nil
+	}
+}
+
+func (n *binaryNode) eval(env *ruleEnv) (value, error) {
+	l, err := n.l.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+
+	// Short-circuit the logical operators.
+	if n.op == "and" || n.op == "or" {
+		if l.kind != kindBool {
+			return value{}, fmt.Errorf("'%s' expects bools, got a %s", n.op, l.kind)
+		}
+		if (n.op == "and" && !l.b) || (n.op == "or" && l.b) {
+			return l, nil
+		}
+		r, err := n.r.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		if r.kind != kindBool {
+			return value{}, fmt.Errorf("'%s' expects bools, got a %s", n.op, r.kind)
+		}
+		return r, nil
+	}
+
+	r, err := n.r.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch n.op {
+	case "~", "!~":
+		if l.kind != kindString || r.kind != kindString {
+			return value{}, fmt.Errorf("'%s' expects strings, got a %s and a %s", n.op, l.kind, r.kind)
+		}
+		re, err := globToRegexp(r.str)
+		if err != nil {
+			return value{}, err
+		}
+		return boolValue(re.MatchString(l.str) == (n.op == "~")), nil
+	case "+", "-":
+		if l.kind != kindNumber || r.kind != kindNumber {
+			return value{}, fmt.Errorf("'%s' expects numbers, got a %s and a %s", n.op, l.kind, r.kind)
+		}
+		if n.op == "+" {
+			return numberValue(l.num + r.num), nil
+		}
+		return numberValue(l.num - r.num), nil
+	}
+
+	if l.kind != r.kind {
+		return value{}, fmt.Errorf("unable to compare a %s with a %s", l.kind, r.kind)
+	}
+
+	var c int
+	switch l.kind {
+	case kindNumber:
+		c = compareFloat(l.num, r.num)
+	case kindString:
+		c = strings.Compare(l.str, r.str)
+	default:
+		if n.op != "==" && n.op != "!=" {
+			return value{}, fmt.Errorf("'%s' is not supported on bools", n.op)
+		}
+		if l.b != r.b {
+			c = 1
+		}
+	}
+
+	switch n.op {
+	case "==":
+		return boolValue(c == 0), nil
+	case "!=":
+		return boolValue(c != 0), nil
+	case "<":
+		return boolValue(c < 0), nil
+	case "<=":
+		return boolValue(c <= 0), nil
+	case ">":
+		return boolValue(c > 0), nil
+	default:
+		return boolValue(c >= 0), nil
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+var (
+	globCache   = map[string]*regexp.Regexp{}
+	globCacheMu sync.Mutex
+)
+
+// globToRegexp converts a glob pattern to a regular expression. '*' matches anything but a '/', '**'
+// matches anything and '?' matches a single character other than '/'.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	globCacheMu.Lock()
+	defer globCacheMu.Unlock()
+
+	if re, ok := globCache[glob]; ok {
+		return re, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s', %s", glob, err.Error())
+	}
+	globCache[glob] = re
+	return re, nil
+}
+
+// Expression parsing
+
+type token struct {
+	kind string // "num", "str", "ident", "op", "eof"
+	text string
+	num  float64
+	pos  int
+}
+
+var numberUnits = map[string]float64{
+	"":   1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+	"s":  1,
+	"m":  60,
+	"h":  3600,
+	"d":  86400,
+}
+
+func tokenize(src string) ([]token, error) {
+	var ret []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at column %d", i+1)
+			}
+			ret = append(ret, token{kind: "str", text: sb.String(), pos: i})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%s' at column %d", src[i:j], i+1)
+			}
+			k := j
+			for k < len(src) && unicode.IsLetter(rune(src[k])) {
+				k++
+			}
+			factor, ok := numberUnits[src[j:k]]
+			if !ok {
+				return nil, fmt.Errorf("unknown unit '%s' at column %d", src[j:k], j+1)
+			}
+			ret = append(ret, token{kind: "num", text: src[i:k], num: n * factor, pos: i})
+			i = k
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			ret = append(ret, token{kind: "ident", text: src[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "!~", "&&", "||", "<", ">", "~", "(", ")", ",", "+", "-", "!"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character '%c' at column %d", c, i+1)
+			}
+			ret = append(ret, token{kind: "op", text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(ret, token{kind: "eof", pos: len(src)}), nil
+}
+
+type exprParser struct {
+	toks []token
+	pos  int
+}
+
+// parseExpr parses a rule expression. The grammar, from lowest to highest precedence, is:
+//
+//	or      = and { ("or" | "||") and }
+//	and     = not { ("and" | "&&") not }
+//	not     = ("not" | "!") not | compare
+//	compare = sum [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "~" | "!~") sum ]
+//	sum     = unary { ("+" | "-") unary }
+//	unary   = "-" unary | primary
+//	primary = number | string | identifier | identifier "(" [ or { "," or } ] ")" | "(" or ")"
+func parseExpr(src string) (node, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("unexpected '%s' at column %d", t.text, t.pos+1)
+	}
+	return n, nil
+}
+
+func (p *exprParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != "op" && t.kind != "ident" {
+		return "", false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("or", "||"); !ok {
+			return l, nil
+		}
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op: "or", l: l, r: r}
+	}
+}
+
+func (p *exprParser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("and", "&&"); !ok {
+			return l, nil
+		}
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op: "and", l: l, r: r}
+	}
+}
+
+func (p *exprParser) parseNot() (node, error) {
+	if _, ok := p.accept("not", "!"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "not", x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (node, error) {
+	l, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "~", "!~"); ok {
+		r, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseSum() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op: op, l: l, r: r}
+	}
+}
+
+func (p *exprParser) parseUnary() (node, error) {
+	if _, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case "num":
+		return &literalNode{v: numberValue(t.num)}, nil
+	case "str":
+		return &literalNode{v: stringValue(t.text)}, nil
+	case "op":
+		if t.text != "(" {
+			break
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("missing ')' at column %d", p.peek().pos+1)
+		}
+		return n, nil
+	case "ident":
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t)
+		}
+		if _, ok := ruleIdents[t.text]; !ok {
+			return nil, fmt.Errorf("unknown attribute '%s' at column %d", t.text, t.pos+1)
+		}
+		return &identNode{name: t.text}, nil
+	case "eof":
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected '%s' at column %d", t.text, t.pos+1)
+}
+
+func (p *exprParser) parseCall(name token) (node, error) {
+	f, ok := ruleFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s' at column %d", name.text, name.pos+1)
+	}
+
+	n := &callNode{name: name.text}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			n.args = append(n.args, arg)
+			if _, ok := p.accept(","); ok {
+				continue
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, fmt.Errorf("missing ')' at column %d", p.peek().pos+1)
+			}
+			break
+		}
+	}
+
+	if len(n.args) != len(f.args) {
+		return nil, fmt.Errorf("%s() expects %d argument(s), got %d", name.text, len(f.args), len(n.args))
+	}
+	return n, nil
+}
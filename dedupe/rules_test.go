@@ -0,0 +1,216 @@
+package dedupe
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantRules   int
+		wantDefault RuleAction
+		wantErr     string
+	}{
+		{name: "empty", input: "# nothing\n\n", wantDefault: RuleSkip},
+		{name: "rules and default", input: "keep if under(\"/a\")\ndelete if size > 1MB\ndefault link\n", wantRules: 2, wantDefault: RuleLink},
+		{name: "unknown action", input: "erase if true\n", wantErr: "line 1: unknown action 'erase'"},
+		{name: "missing if", input: "\nkeep size > 1\n", wantErr: "line 2: expected 'keep if <expression>'"},
+		{name: "missing expression", input: "keep if\n", wantErr: "line 1: expected 'keep if <expression>'"},
+		{name: "default keep", input: "default keep\n", wantErr: "line 1: expected 'default <delete|link|hardlink|skip>'"},
+		{name: "unknown attribute", input: "keep if color == 1\n", wantErr: "line 1: unknown attribute 'color'"},
+		{name: "unknown function", input: "keep if upper(name) == \"A\"\n", wantErr: "unknown function 'upper'"},
+		{name: "wrong argument count", input: "keep if contains(name)\n", wantErr: "contains() expects 2 argument(s), got 1"},
+		{name: "unterminated string", input: "keep if name == \"a\n", wantErr: "unterminated string"},
+		{name: "missing parenthesis", input: "keep if (size > 1\n", wantErr: "missing ')'"},
+		{name: "missing operand", input: "keep if mtime < now -\n", wantErr: "unexpected end of expression"},
+		{name: "dangling operator", input: "keep if size + > 1\n", wantErr: "unexpected '>' at column 8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := ParseRules(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseRules() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rs.Rules) != tt.wantRules || rs.Default != tt.wantDefault {
+				t.Errorf("ParseRules() = %d rules, default %s, want %d rules, default %s", len(rs.Rules), rs.Default, tt.wantRules, tt.wantDefault)
+			}
+		})
+	}
+}
+
+func TestRuleEval(t *testing.T) {
+	mtime := time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local)
+	env := &ruleEnv{
+		path:   "/photos/2020/Trip/IMG_1.JPG",
+		size:   3 << 20,
+		mtime:  mtime,
+		depth:  4,
+		root:   1,
+		newest: mtime.Add(time.Hour),
+		oldest: mtime,
+		count:  3,
+		wasted: 6 << 20,
+		now:    mtime.Add(48 * time.Hour),
+	}
+
+	tests := []struct {
+		expr    string
+		want    bool
+		wantErr string
+	}{
+		{expr: `size == 3MB`, want: true},
+		{expr: `size > 3MB or size < 1KB`, want: false},
+		{expr: `wasted >= 6MB and count == 3`, want: true},
+		{expr: `name == "IMG_1.JPG"`, want: true},
+		{expr: `ext == "JPG" and dir == "/photos/2020/Trip"`, want: true},
+		{expr: `lower(ext) == "jpg"`, want: true},
+		{expr: `path ~ "/photos/*/IMG_*"`, want: false},
+		{expr: `path ~ "/photos/**/IMG_*"`, want: true},
+		{expr: `name !~ "*.png"`, want: true},
+		{expr: `under("/photos/2020")`, want: true},
+		{expr: `under("/photos/20")`, want: false},
+		{expr: `contains(path, "Trip") and not contains(path, "trip")`, want: true},
+		{expr: `mtime == oldest and newest > mtime`, want: true},
+		{expr: `mtime > date("2020-01-01") and mtime < date("2020-06-02")`, want: true},
+		{expr: `depth <= 4 and root == 1`, want: true},
+		{expr: `(size > 1TB or true) == true`, want: true},
+		{expr: `mtime < now - 1d and mtime > now - 3d`, want: true},
+		{expr: `newest - mtime == 1h`, want: true},
+		{expr: `size + 1MB == 4MB`, want: true},
+		{expr: `10 - 2 - 3 == 5`, want: true},
+		{expr: `-size < 0 and --size > 0`, want: true},
+		{expr: `size - -1 == 3MB + 1`, want: true},
+		{expr: `size + 1 > 1 + 3MB`, want: false},
+		{expr: `name + "x" == "y"`, wantErr: "'+' expects numbers, got a string and a string"},
+		{expr: `-name == "x"`, wantErr: "'-' expects a number, got a string"},
+		{expr: `false and size == "big"`, want: false},
+		{expr: `size == "big"`, wantErr: "unable to compare a number with a string"},
+		{expr: `size`, wantErr: "evaluates to a number instead of a bool"},
+		{expr: `size ~ "1*"`, wantErr: "'~' expects strings"},
+		{expr: `true < false`, wantErr: "'<' is not supported on bools"},
+		{expr: `mtime > date("yesterday")`, wantErr: "invalid date 'yesterday'"},
+		{expr: `lower(size) == "x"`, wantErr: "lower() expects a string as argument 1, got a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rs, err := ParseRules(strings.NewReader("keep if " + tt.expr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := rs.Rules[0].eval(env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("eval() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleSetDecide(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, filepath.Join(dir, "a", "x.jpg"), "data", past)
+	b := writeFile(t, filepath.Join(dir, "b", "x.jpg"), "data", past.Add(-time.Minute))
+	c := writeFile(t, filepath.Join(dir, "c", "x.jpg"), "data", past)
+	ref := writeFile(t, filepath.Join(dir, "ref", "x.jpg"), "data", past)
+	report := &DupeReport{Roots: []string{dir}, References: []string{filepath.Join(dir, "ref")}}
+
+	tests := []struct {
+		name    string
+		rules   string
+		files   []string
+		want    map[string]RuleAction
+		wantErr bool
+	}{
+		{
+			name:  "earliest keep rule wins",
+			rules: "keep if under(\"" + filepath.Join(dir, "c") + "\")\nkeep if mtime == oldest\ndelete if under(\"" + filepath.Join(dir, "a") + "\")",
+			files: []string{a, b, c},
+			want:  map[string]RuleAction{a: RuleDelete, b: RuleSkip, c: RuleKeep},
+		},
+		{
+			name:  "ties are broken by path",
+			rules: "keep if true\ndefault delete",
+			files: []string{c, b, a},
+			want:  map[string]RuleAction{a: RuleKeep, b: RuleDelete, c: RuleDelete},
+		},
+		{
+			name:  "first non keep rule applies",
+			rules: "keep if mtime == oldest\nhardlink if name == \"x.jpg\"\ndelete if true",
+			files: []string{a, b},
+			want:  map[string]RuleAction{a: RuleHardlink, b: RuleKeep},
+		},
+		{
+			name:  "no keep match skips the group",
+			rules: "keep if size > 1GB\ndefault delete",
+			files: []string{a, b},
+			want:  map[string]RuleAction{a: RuleSkip, b: RuleSkip},
+		},
+		{
+			name:  "reference files are skipped",
+			rules: "keep if under(\"" + filepath.Join(dir, "a") + "\")\ndefault delete",
+			files: []string{a, ref, c},
+			want:  map[string]RuleAction{a: RuleKeep, ref: RuleSkip, c: RuleDelete},
+		},
+		{
+			name:    "evaluation errors skip the group",
+			rules:   "keep if mtime == oldest\ndelete if size == \"big\"",
+			files:   []string{a, b},
+			want:    map[string]RuleAction{a: RuleSkip, b: RuleSkip},
+			wantErr: true,
+		},
+		{
+			name:    "evaluation errors on a single file skip the group",
+			rules:   "keep if true\ndelete if under(\"" + filepath.Join(dir, "b") + "\") and size == \"big\"",
+			files:   []string{a, b},
+			want:    map[string]RuleAction{a: RuleSkip, b: RuleSkip},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := ParseRules(strings.NewReader(tt.rules))
+			if err != nil {
+				t.Fatal(err)
+			}
+			decision, err := rs.Decide(report, tt.files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (decision.Err != nil) != tt.wantErr {
+				t.Fatalf("Decide() error = %v, wantErr %v", decision.Err, tt.wantErr)
+			}
+			if tt.wantErr && decision.Keep != "" {
+				t.Errorf("Decide() kept %s despite the error", decision.Keep)
+			}
+			for _, fd := range decision.Files {
+				if fd.Action != tt.want[fd.Path] {
+					t.Errorf("%s: action = %s (%s), want %s", fd.Path, fd.Action, fd.Reason, tt.want[fd.Path])
+				}
+				if len(fd.Matches) != len(rs.Rules) {
+					t.Errorf("%s: %d matches, want %d", fd.Path, len(fd.Matches), len(rs.Rules))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package dedupe
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// record is the unit stored in a sorted run: a sort key (file size or checksum) and the path of the file.
+type record struct {
+	key  string
+	path string
+}
+
+// runSet keeps the temporary files holding sorted runs of records spilled to disk once the in-memory
+// structures reach the configured memory limit.
+type runSet struct {
+	dir   string
+	files []string
+}
+
+// write creates a new run with the records fn emits, which must be emitted in key order. Records are
+// written as they are emitted, so spilling takes no memory other than the write buffer.
+func (r *runSet) write(fn func(emit func(key string, path []byte) error) error) error {
+	f, err := os.CreateTemp(r.dir, "dedupe-run-*")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary run file, %s", err.Error())
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<16)
+	err = fn(func(key string, path []byte) error {
+		if err := writeString(w, key); err != nil {
+			return err
+		}
+		return writeBytes(w, path)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("unable to write temporary run file %s, %s", f.Name(), err.Error())
+	}
+	r.files = append(r.files, f.Name())
+	return nil
+}
+
+func (r *runSet) empty() bool {
+	return len(r.files) == 0
+}
+
+// groups merges all the spilled runs and invokes fn once per distinct key, with all the paths that share
+// that key.
+func (r *runSet) groups(fn func(key string, paths []string) error) error {
+	h := &runHeap{}
+	defer h.close()
+
+	for _, name := range r.files {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("unable to open temporary run file %s, %s", name, err.Error())
+		}
+		rr := &runReader{f: f, r: bufio.NewReaderSize(f, 1<<16)}
+		h.readers = append(h.readers, rr)
+		ok, err := rr.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.active = append(h.active, rr)
+		}
+	}
+	heap.Init(h)
+
+	var (
+		key   string
+		paths []string
+	)
+	for h.Len() > 0 {
+		rr := h.active[0]
+		if len(paths) > 0 && rr.cur.key != key {
+			if err := fn(key, paths); err != nil {
+				return err
+			}
+			paths = nil
+		}
+		key = rr.cur.key
+		paths = append(paths, rr.cur.path)
+
+		ok, err := rr.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	if len(paths) > 0 {
+		return fn(key, paths)
+	}
+	return nil
+}
+
+// remove deletes all the temporary files of the set.
+func (r *runSet) remove() {
+	for _, name := range r.files {
+		_ = os.Remove(name)
+	}
+	r.files = nil
+}
+
+type runReader struct {
+	f   *os.File
+	r   *bufio.Reader
+	cur record
+}
+
+func (rr *runReader) next() (bool, error) {
+	key, err := readString(rr.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to read temporary run file %s, %s", rr.f.Name(), err.Error())
+	}
+	path, err := readString(rr.r)
+	if err != nil {
+		return false, fmt.Errorf("unable to read temporary run file %s, %s", rr.f.Name(), err.Error())
+	}
+	rr.cur = record{key: key, path: path}
+	return true, nil
+}
+
+type runHeap struct {
+	readers []*runReader
+	active  []*runReader
+}
+
+func (h *runHeap) Len() int           { return len(h.active) }
+func (h *runHeap) Less(i, j int) bool { return h.active[i].cur.key < h.active[j].cur.key }
+func (h *runHeap) Swap(i, j int)      { h.active[i], h.active[j] = h.active[j], h.active[i] }
+func (h *runHeap) Push(x interface{}) { h.active = append(h.active, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	x := h.active[len(h.active)-1]
+	h.active = h.active[:len(h.active)-1]
+	return x
+}
+func (h *runHeap) close() {
+	for _, rr := range h.readers {
+		rr.f.Close()
+	}
+}
+
+func writeString(w *bufio.Writer, s string) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(s)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := w.WriteString(s)
+	return err
+}
+
+func writeBytes(w *bufio.Writer, b []byte) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(b)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return string(buf), nil
+}
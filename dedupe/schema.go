@@ -0,0 +1,260 @@
+package dedupe
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReportVersion is the version of the report format written by this version of dedupe. The format is
+// described by the JSON Schema in ReportSchema. Version 2 added the resolution state of the groups.
+const ReportVersion = 2
+
+// ReportSchema is the JSON Schema of the report format.
+//
+//go:embed report.schema.json
+var ReportSchema []byte
+
+type reportDocument struct {
+	Version    int            `json:"version"`
+	Algorithm  HashMode       `json:"algorithm,omitempty"`
+	Created    *time.Time     `json:"created,omitempty"`
+	Roots      []string       `json:"roots,omitempty"`
+	References []string       `json:"references,omitempty"`
+	Groups     []*reportGroup `json:"groups"`
+	Errors     []string       `json:"errors"`
+}
+
+type reportGroup struct {
+	Checksum   string      `json:"checksum"`
+	Size       int64       `json:"size"`
+	Files      []string    `json:"files"`
+	Resolution *Resolution `json:"resolution,omitempty"`
+}
+
+// legacyReport is the unversioned format written before the report format was versioned. Errors were
+// serialized as empty objects, so their messages are lost.
+type legacyReport struct {
+	Dupes      map[string][]string
+	Sizes      map[string]int64
+	Roots      []string
+	References []string
+	Errors     []json.RawMessage
+}
+
+// MarshalJSON writes the report in the current versioned format, with the groups in the order of Groups.
+func (r *DupeReport) MarshalJSON() ([]byte, error) {
+	doc := &reportDocument{
+		Version:    ReportVersion,
+		Algorithm:  r.Algorithm,
+		Roots:      r.Roots,
+		References: r.References,
+		Groups:     []*reportGroup{},
+		Errors:     errorStrings(r.Errors),
+	}
+	if !r.Created.IsZero() {
+		doc.Created = &r.Created
+	}
+	for _, g := range r.Groups() {
+		rg := toReportGroup(g)
+		rg.Resolution = r.Resolutions[g.Checksum]
+		doc.Groups = append(doc.Groups, rg)
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON reads a report in any known version of the format, migrating it to the current one.
+func (r *DupeReport) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		Version *int            `json:"version"`
+		Dupes   json.RawMessage `json:"Dupes"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+
+	switch {
+	case probe.Version == nil && probe.Dupes != nil:
+		return r.migrateLegacy(data)
+	case probe.Version == nil:
+		return errors.New("not a dedupe report, the 'version' field is missing")
+	case *probe.Version > ReportVersion:
+		return fmt.Errorf("report version %d is newer than the supported version %d, please upgrade dedupe", *probe.Version, ReportVersion)
+	case *probe.Version < 1:
+		return fmt.Errorf("invalid report version %d", *probe.Version)
+	}
+
+	doc := &reportDocument{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return err
+	}
+
+	*r = DupeReport{
+		Algorithm:  doc.Algorithm,
+		Dupes:      map[string][]string{},
+		Sizes:      map[string]int64{},
+		Roots:      doc.Roots,
+		References: doc.References,
+		Errors:     []error{},
+	}
+	if doc.Created != nil {
+		r.Created = *doc.Created
+	}
+	for _, e := range doc.Errors {
+		r.Errors = append(r.Errors, errors.New(e))
+	}
+
+	for i, g := range doc.Groups {
+		if g == nil || g.Checksum == "" {
+			return fmt.Errorf("group %d has no checksum", i+1)
+		}
+		if _, ok := r.Dupes[g.Checksum]; ok {
+			return fmt.Errorf("group %d: checksum %s is listed more than once", i+1, g.Checksum)
+		}
+		if len(g.Files) == 0 {
+			return fmt.Errorf("group %d (%s) has no files", i+1, g.Checksum)
+		}
+		for _, f := range g.Files {
+			if f == "" {
+				return fmt.Errorf("group %d (%s) has an empty path", i+1, g.Checksum)
+			}
+		}
+		r.Dupes[g.Checksum] = g.Files
+		if g.Size >= 0 {
+			r.Sizes[g.Checksum] = g.Size
+		}
+		if g.Resolution != nil {
+			r.SetResolution(g.Checksum, g.Resolution)
+		}
+	}
+	return nil
+}
+
+func (r *DupeReport) migrateLegacy(data []byte) error {
+	legacy := &legacyReport{}
+	if err := json.Unmarshal(data, legacy); err != nil {
+		return err
+	}
+
+	*r = DupeReport{
+		Dupes:      map[string][]string{},
+		Sizes:      legacy.Sizes,
+		Roots:      legacy.Roots,
+		References: legacy.References,
+		Errors:     []error{},
+	}
+	for k, files := range legacy.Dupes {
+		if len(files) > 0 {
+			r.Dupes[k] = files
+		}
+	}
+	for _, raw := range legacy.Errors {
+		var msg string
+		if err := json.Unmarshal(raw, &msg); err != nil || msg == "" {
+			msg = "unknown error, its message was not kept by the report format of older versions"
+		}
+		r.Errors = append(r.Errors, errors.New(msg))
+	}
+	return nil
+}
+
+// ReadReport reads a report in any known version of the format. Errors point to the line of the
+// document where the problem was found.
+func ReadReport(reader io.Reader) (*DupeReport, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("the report is empty")
+	}
+
+	report := &DupeReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, describeJSONError(data, err)
+	}
+	return report, nil
+}
+
+// LoadReport reads a report file.
+func LoadReport(file string) (*DupeReport, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read report %s, %s", file, err.Error())
+	}
+	defer f.Close()
+
+	report, err := ReadReport(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid report %s, %s", file, err.Error())
+	}
+	return report, nil
+}
+
+// SaveReport writes the report to the given file. The report is written to a temporary file first and
+// renamed over the target, so an interrupted save never leaves a truncated report behind.
+func SaveReport(file string, report *DupeReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("error marshalling report, %s", err.Error())
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+"-*")
+	if err != nil {
+		return fmt.Errorf("unable to create report file, %s", err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write data to report file, %s", err.Error())
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write data to report file, %s", err.Error())
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write data to report file, %s", err.Error())
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("unable to write report file %s, %s", file, err.Error())
+	}
+	return nil
+}
+
+func describeJSONError(data []byte, err error) error {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntax):
+		// The offset is past the byte that could not be parsed.
+		line, col := position(data, syntax.Offset-1)
+		return fmt.Errorf("malformed JSON at line %d, column %d: %s", line, col, syntax.Error())
+	case errors.As(err, &typ):
+		line, col := position(data, typ.Offset)
+		return fmt.Errorf("unexpected %s for '%s' at line %d, column %d, expected %s", typ.Value, typ.Field, line, col, typ.Type)
+	default:
+		return err
+	}
+}
+
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+func toReportGroup(g *DupeGroup) *reportGroup {
+	return &reportGroup{Checksum: g.Checksum, Size: g.Size, Files: g.Files}
+}
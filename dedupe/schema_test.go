@@ -0,0 +1,152 @@
+package dedupe
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadReport(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		wantDupes      map[string][]string
+		wantSizes      map[string]int64
+		wantRoots      []string
+		wantErrors     []string
+		wantResolution *Resolution
+		wantErr        string
+	}{
+		{
+			name: "legacy format",
+			input: `{"Dupes": {"abc": ["/a/x", "/b/x"], "def": []}, "Sizes": {"abc": 3},
+				"Roots": ["/a", "/b"], "Errors": [{}, "unable to read /c"]}`,
+			wantDupes:  map[string][]string{"abc": {"/a/x", "/b/x"}},
+			wantSizes:  map[string]int64{"abc": 3},
+			wantRoots:  []string{"/a", "/b"},
+			wantErrors: []string{"unknown error, its message was not kept by the report format of older versions", "unable to read /c"},
+		},
+		{
+			name:      "legacy format without sizes",
+			input:     `{"Dupes": {"abc": ["/a/x", "/b/x"]}, "Errors": null}`,
+			wantDupes: map[string][]string{"abc": {"/a/x", "/b/x"}},
+		},
+		{
+			name: "version 1",
+			input: `{"version": 1, "algorithm": "md5", "roots": ["/a"], "groups": [
+				{"checksum": "abc", "size": 3, "files": ["/a/x", "/a/y"]},
+				{"checksum": "def", "size": -1, "files": ["/a/z", "/a/w"]}
+			], "errors": ["boom"]}`,
+			wantDupes:  map[string][]string{"abc": {"/a/x", "/a/y"}, "def": {"/a/z", "/a/w"}},
+			wantSizes:  map[string]int64{"abc": 3},
+			wantRoots:  []string{"/a"},
+			wantErrors: []string{"boom"},
+		},
+		{
+			name: "version 2 with a resolution",
+			input: `{"version": 2, "groups": [{"checksum": "abc", "size": 3, "files": ["/a/x", "/a/y"],
+				"resolution": {"decision": "deleted", "keep": "/a/x", "time": "2020-01-02T03:04:05Z", "outcome": "done",
+				"steps": [{"action": "delete", "path": "/a/y"}]}}], "errors": []}`,
+			wantDupes: map[string][]string{"abc": {"/a/x", "/a/y"}},
+			wantSizes: map[string]int64{"abc": 3},
+			wantResolution: &Resolution{
+				Decision: DecisionDeleted,
+				Keep:     "/a/x",
+				Time:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+				Outcome:  OutcomeDone,
+				Steps:    []*ResolutionStep{{Action: ActionDelete, Path: "/a/y"}},
+			},
+		},
+		{name: "empty", input: "  \n", wantErr: "the report is empty"},
+		{name: "not a report", input: `{"groups": []}`, wantErr: "the 'version' field is missing"},
+		{name: "newer version", input: `{"version": 99, "groups": []}`, wantErr: "report version 99 is newer than the supported version"},
+		{name: "invalid version", input: `{"version": 0, "groups": []}`, wantErr: "invalid report version 0"},
+		{name: "missing checksum", input: `{"version": 2, "groups": [{"files": ["/a"]}]}`, wantErr: "group 1 has no checksum"},
+		{
+			name:    "checksum listed twice",
+			input:   `{"version": 2, "groups": [{"checksum": "a", "files": ["/a"]}, {"checksum": "a", "files": ["/b"]}]}`,
+			wantErr: "group 2: checksum a is listed more than once",
+		},
+		{name: "no files", input: `{"version": 2, "groups": [{"checksum": "a", "files": []}]}`, wantErr: "group 1 (a) has no files"},
+		{name: "empty path", input: `{"version": 2, "groups": [{"checksum": "a", "files": ["/a", ""]}]}`, wantErr: "group 1 (a) has an empty path"},
+		{name: "malformed JSON", input: "{\"version\": 2,\n\"groups\": [}", wantErr: "malformed JSON at line 2, column 12"},
+		{
+			name:    "wrong type",
+			input:   "{\"version\": 2,\n  \"groups\": [{\"checksum\": \"a\", \"size\": \"big\", \"files\": [\"/a\"]}]}",
+			wantErr: "size' at line 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := ReadReport(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadReport() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(report.Dupes, tt.wantDupes) {
+				t.Errorf("Dupes = %v, want %v", report.Dupes, tt.wantDupes)
+			}
+			if len(report.Sizes)+len(tt.wantSizes) > 0 && !reflect.DeepEqual(report.Sizes, tt.wantSizes) {
+				t.Errorf("Sizes = %v, want %v", report.Sizes, tt.wantSizes)
+			}
+			if !reflect.DeepEqual(report.Roots, tt.wantRoots) {
+				t.Errorf("Roots = %v, want %v", report.Roots, tt.wantRoots)
+			}
+			if got := errorStrings(report.Errors); len(got)+len(tt.wantErrors) > 0 && !reflect.DeepEqual(got, tt.wantErrors) {
+				t.Errorf("Errors = %q, want %q", got, tt.wantErrors)
+			}
+			if got := report.Resolutions["abc"]; !reflect.DeepEqual(got, tt.wantResolution) {
+				t.Errorf("Resolution = %+v, want %+v", got, tt.wantResolution)
+			}
+		})
+	}
+}
+
+func TestReportRoundTrip(t *testing.T) {
+	legacy := `{"Dupes": {"abc": ["/a/y", "/a/x"], "def": ["/b/x", "/c/x", "/d/x"]}, "Sizes": {"abc": 3, "def": 10},
+		"Roots": ["/a", "/b"], "References": ["/b"], "Errors": [{}]}`
+	report, err := ReadReport(strings.NewReader(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.SetResolution("abc", &Resolution{Decision: DecisionKept, Time: past.UTC(), Outcome: OutcomeDone})
+
+	// Migrated reports are saved in the current format, and read back unchanged.
+	file := filepath.Join(t.TempDir(), "report.json")
+	if err := SaveReport(file, report); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(readFile(t, file)), &doc); err != nil || doc.Version != ReportVersion {
+		t.Fatalf("saved version = %d, %v, want %d", doc.Version, err, ReportVersion)
+	}
+
+	got, err := LoadReport(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Groups(), report.Groups()) {
+		t.Errorf("Groups() = %v, want %v", got.Groups(), report.Groups())
+	}
+	if !reflect.DeepEqual(got.Roots, report.Roots) || !reflect.DeepEqual(got.References, report.References) {
+		t.Errorf("roots = %v, %v, want %v, %v", got.Roots, got.References, report.Roots, report.References)
+	}
+	if !reflect.DeepEqual(got.Resolutions, report.Resolutions) {
+		t.Errorf("Resolutions = %v, want %v", got.Resolutions, report.Resolutions)
+	}
+	if len(got.Errors) != 1 {
+		t.Errorf("Errors = %v", got.Errors)
+	}
+}
@@ -0,0 +1,147 @@
+package dedupe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// scriptHeader defines the helpers used by every generated script. 'guard' checks a file is still a
+// regular file with the expected size and checksum, and the actions only run when their guard passes.
+const scriptHeader = `set -u
+
+DRY_RUN=${DRY_RUN:-0}
+failed=0
+
+if command -v %[1]ssum >/dev/null 2>&1; then
+	checksum() { %[1]ssum < "$1" | cut -d ' ' -f 1; }
+elif command -v openssl >/dev/null 2>&1; then
+	checksum() { openssl dgst -%[1]s -r < "$1" | cut -d ' ' -f 1; }
+else
+	echo "no %[1]s tool found (%[1]ssum or openssl)" >&2
+	exit 2
+fi
+
+skip() {
+	echo "skipped: $*" >&2
+	failed=$((failed + 1))
+	return 1
+}
+
+guard() {
+	if [ ! -f "$1" ] || [ -h "$1" ]; then
+		skip "$1 is no longer a regular file"
+	elif [ "$(wc -c < "$1" | tr -d ' ')" != "$2" ]; then
+		skip "$1 no longer has the expected size"
+	elif [ "$(checksum "$1")" != "$3" ]; then
+		skip "$1 no longer has the expected checksum"
+	fi
+}
+
+run() {
+	if [ "$DRY_RUN" = 1 ]; then
+		echo "would run: $*"
+	else
+		"$@" || skip "'$*' failed"
+	fi
+}
+
+# replace_link [-s] KEEP TARGET replaces TARGET with a link to KEEP, created under a temporary name and
+# renamed over TARGET.
+replace_link() {
+	flag=
+	if [ "$1" = -s ]; then
+		flag=-s
+		shift
+	fi
+	tmp="$2.dedupe-$$"
+	if [ "$DRY_RUN" = 1 ]; then
+		echo "would run: ln ${flag:+$flag }-- $1 $tmp && mv -f -- $tmp $2"
+	elif ! { ln $flag -- "$1" "$tmp" && mv -f -- "$tmp" "$2"; }; then
+		rm -f -- "$tmp"
+		skip "unable to replace $2 with a link to $1"
+	fi
+}
+`
+
+// WriteScript writes a POSIX shell script performing the actions of the plan, so it can be reviewed and
+// run later without dedupe. Every destructive command is guarded by a check of the size and checksum of
+// both the target and the file kept, and is skipped if any of them changed. Running the script with
+// DRY_RUN=1 only prints the commands. Quarantine and trash actions, and actions on reference files, are
+// left out as comments.
+func WriteScript(w io.Writer, plan *Plan) error {
+	algorithm := plan.Algorithm
+	if algorithm == "" {
+		algorithm = HashSHA256
+	}
+	if algorithm != HashMD5 && algorithm != HashSHA256 {
+		return fmt.Errorf("unable to write script, unsupported algorithm '%s'", algorithm)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#!/bin/sh")
+	fmt.Fprintf(bw, "# Generated by dedupe on %s. Review it before running it.\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintln(bw, "# Run with DRY_RUN=1 to print the commands without running them.")
+	fmt.Fprintln(bw)
+	fmt.Fprintf(bw, scriptHeader, algorithm)
+
+	for _, g := range plan.Groups {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, "# group %s (%d bytes)\n", commentLine(g.Checksum), g.Size)
+
+		if err := g.check(nil); err != nil {
+			fmt.Fprintf(bw, "# not applied, %s\n", commentLine(err.Error()))
+			continue
+		}
+		if !g.removes() {
+			fmt.Fprintln(bw, "# nothing to do")
+			continue
+		}
+
+		keep := g.Keep()
+		fmt.Fprintf(bw, "if guard %s %d %s; then\n", shellQuote(keep), g.Size, shellQuote(g.Checksum))
+		for _, e := range g.Entries {
+			if !e.removes() {
+				continue
+			}
+			if underAny(e.Path, plan.References) {
+				fmt.Fprintf(bw, "\t# not applied, %s is a reference file\n", commentLine(e.Path))
+				continue
+			}
+
+			guard := fmt.Sprintf("guard %s %d %s", shellQuote(e.Path), g.Size, shellQuote(g.Checksum))
+			switch e.Action {
+			case PlanDelete:
+				fmt.Fprintf(bw, "\t%s && run rm -f -- %s\n", guard, shellQuote(e.Path))
+			case PlanSymlink:
+				fmt.Fprintf(bw, "\t%s && replace_link -s %s %s\n", guard, shellQuote(keep), shellQuote(e.Path))
+			case PlanHardlink:
+				fmt.Fprintf(bw, "\t%s && replace_link %s %s\n", guard, shellQuote(keep), shellQuote(e.Path))
+			default:
+				fmt.Fprintf(bw, "\t# not applied, '%s' is not supported in scripts: %s\n", e.Action, commentLine(e.Path))
+			}
+		}
+		fmt.Fprintln(bw, "fi")
+	}
+
+	fmt.Fprintln(bw)
+	fmt.Fprintln(bw, `if [ "$failed" -gt 0 ]; then`)
+	fmt.Fprintln(bw, `	echo "done, $failed action(s) skipped" >&2`)
+	fmt.Fprintln(bw, "	exit 1")
+	fmt.Fprintln(bw, "fi")
+	fmt.Fprintln(bw, `echo "done"`)
+	return bw.Flush()
+}
+
+// shellQuote quotes s for a POSIX shell. Inside single quotes every byte is literal, except the single
+// quote itself which is closed, escaped and reopened.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// commentLine makes s safe to write in a shell comment.
+func commentLine(s string) string {
+	return strings.NewReplacer("\n", `\n`, "\r", `\r`).Replace(s)
+}
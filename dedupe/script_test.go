@@ -0,0 +1,145 @@
+package dedupe
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell found")
+	}
+
+	tests := []string{
+		"",
+		"plain",
+		"with space",
+		"it's",
+		"''",
+		`"double" and \backslash`,
+		"$(touch pwned) `touch pwned` $HOME",
+		"line\nbreak",
+		"-starts-with-dash",
+		"glob * ? [a]",
+		"semi; colon & pipe | redirect > x",
+	}
+
+	for _, s := range tests {
+		out, err := exec.Command(sh, "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("sh -c printf %s: %v", shellQuote(s), err)
+		}
+		if string(out) != s {
+			t.Errorf("shellQuote(%q) = %s, read back as %q", s, shellQuote(s), out)
+		}
+	}
+}
+
+func TestCommentLine(t *testing.T) {
+	tests := []struct{ input, want string }{
+		{"plain", "plain"},
+		{"a\nrm -rf /", `a\nrm -rf /`},
+		{"a\r\nb", `a\r\nb`},
+	}
+	for _, tt := range tests {
+		if got := commentLine(tt.input); got != tt.want {
+			t.Errorf("commentLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWriteScript(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell found")
+	}
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		if _, err := exec.LookPath("openssl"); err != nil {
+			t.Skip("no sha256 tool found")
+		}
+	}
+
+	names := []string{"keep", "it's", "$(touch pwned)", "-dash", "new\nline", "link me", "changed"}
+	tests := []struct {
+		name     string
+		dryRun   bool
+		checksum string
+	}{
+		{name: "run"},
+		{name: "dry run", dryRun: true},
+		// Only parsed plans are checked, a checksum given to WriteScript must never run as a command.
+		{name: "hostile checksum", checksum: "$(touch pwned)'\n`touch pwned`\ntouch pwned"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{}
+			for _, n := range names {
+				files[n] = writeFile(t, filepath.Join(dir, n), "data", past)
+			}
+			checksum := sha256Of("data")
+			if tt.checksum != "" {
+				checksum = tt.checksum
+			}
+			applied := !tt.dryRun && tt.checksum == ""
+			g := &PlanGroup{Checksum: checksum, Size: 4, Entries: []*PlanEntry{
+				{Action: PlanKeep, Path: files["keep"]},
+				{Action: PlanDelete, Path: files["it's"]},
+				{Action: PlanDelete, Path: files["$(touch pwned)"]},
+				{Action: PlanDelete, Path: files["-dash"]},
+				{Action: PlanHardlink, Path: files["new\nline"]},
+				{Action: PlanSymlink, Path: files["link me"]},
+				{Action: PlanDelete, Path: files["changed"]},
+			}}
+
+			var buf bytes.Buffer
+			if err := WriteScript(&buf, &Plan{Algorithm: HashSHA256, Groups: []*PlanGroup{g}}); err != nil {
+				t.Fatal(err)
+			}
+			// Modified between the plan and the run, so its guard must skip it.
+			writeFile(t, files["changed"], "DATA", past)
+
+			cmd := exec.Command(sh, "-s")
+			cmd.Dir = dir
+			cmd.Stdin = &buf
+			if tt.dryRun {
+				cmd.Env = append(os.Environ(), "DRY_RUN=1")
+			}
+			out, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Errorf("the script succeeded despite the changed file:\n%s", out)
+			}
+			if !strings.Contains(string(out), "no longer has the expected checksum") {
+				t.Errorf("the changed file was not reported:\n%s", out)
+			}
+			if strings.Contains(strings.ToLower(string(out)), "syntax error") {
+				t.Errorf("the script is malformed:\n%s", out)
+			}
+
+			if exists(filepath.Join(dir, "pwned")) {
+				t.Errorf("a file name or checksum was run as a command")
+			}
+			if readFile(t, files["keep"]) != "data" || readFile(t, files["changed"]) != "DATA" {
+				t.Errorf("the kept or the changed file was modified")
+			}
+			for _, n := range []string{"it's", "$(touch pwned)", "-dash"} {
+				if exists(files[n]) == applied {
+					t.Errorf("%q exists = %v", n, exists(files[n]))
+				}
+			}
+			if linked := sameFile(files["new\nline"], files["keep"]); linked != applied {
+				t.Errorf("hard link created = %v", linked)
+			}
+			dest, err := os.Readlink(files["link me"])
+			if (err == nil) != applied || (err == nil && dest != files["keep"]) {
+				t.Errorf("symlink = %q, %v", dest, err)
+			}
+		})
+	}
+}
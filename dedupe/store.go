@@ -0,0 +1,281 @@
+package dedupe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const storeManifest = "manifest.jsonl"
+
+// StoreEntry is the record of a file exported to a store. Path is relative to Root, the absolute path of
+// the tree the file was exported from.
+type StoreEntry struct {
+	Time      time.Time
+	Root      string
+	Path      string
+	Checksum  string
+	Algorithm HashMode
+	Size      int64
+	Mode      os.FileMode
+	ModTime   time.Time
+}
+
+// Original returns the absolute path the file was exported from.
+func (e *StoreEntry) Original() string {
+	return filepath.Join(e.Root, e.Path)
+}
+
+// RestorePath returns where the entry is restored under the target directory, at its path relative to
+// its root.
+func (e *StoreEntry) RestorePath(target string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(e.Path))
+	if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid store entry path '%s'", e.Path)
+	}
+	return filepath.Join(target, rel), nil
+}
+
+// Store is a content-addressable store: each unique content is kept once in '<dir>/ab/cd/<hash>', and a
+// manifest maps every exported file to its content so the original trees can be rebuilt.
+type Store struct {
+	mu        sync.Mutex
+	dir       string
+	algorithm HashMode
+	hasher    *service
+}
+
+// OpenStore opens (creating it if needed) the store directory. A store only holds contents hashed with
+// the algorithm it was created with, which is used if the given algorithm is empty.
+func OpenStore(dir string, algorithm HashMode, ioMode IOMode) (*Store, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create store directory %s, %s", dir, err.Error())
+	}
+
+	s := &Store{dir: abs, algorithm: algorithm}
+	first, err := s.firstEntry()
+	switch {
+	case err != nil:
+		return nil, err
+	case first != nil && algorithm == "":
+		s.algorithm = first.Algorithm
+	case first != nil && first.Algorithm != algorithm:
+		return nil, fmt.Errorf("the store %s holds %s checksums, not %s", dir, first.Algorithm, algorithm)
+	case algorithm == "":
+		s.algorithm = HashSHA256
+	}
+	s.hasher = &service{options: &Options{Mode: s.algorithm, IOMode: ioMode}}
+	return s, nil
+}
+
+// Dir returns the absolute path of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// ObjectPath returns the location of the content with the given checksum in the store.
+func (s *Store) ObjectPath(checksum string) string {
+	if len(checksum) < 4 {
+		return filepath.Join(s.dir, checksum)
+	}
+	return filepath.Join(s.dir, checksum[:2], checksum[2:4], checksum)
+}
+
+// Add exports the file, found under the given root, to the store. Its content is only copied if the store
+// does not hold it yet. It returns whether the content was copied.
+func (s *Store) Add(root, file string) (*StoreEntry, bool, error) {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to read file info of %s, %s", file, err.Error())
+	}
+	checksum, err := s.hasher.getHash(file)
+	if err != nil {
+		return nil, false, err
+	}
+
+	absRoot, rel := absPath(root), ""
+	if rel, err = filepath.Rel(absRoot, absPath(file)); err != nil {
+		return nil, false, fmt.Errorf("unable to export %s, %s", file, err.Error())
+	}
+
+	entry := &StoreEntry{
+		Time:      time.Now(),
+		Root:      absRoot,
+		Path:      filepath.ToSlash(rel),
+		Checksum:  checksum,
+		Algorithm: s.algorithm,
+		Size:      info.Size(),
+		Mode:      info.Mode(),
+		ModTime:   info.ModTime(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied, err := s.addObject(file, checksum)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := s.appendEntry(entry); err != nil {
+		return nil, copied, err
+	}
+	return entry, copied, nil
+}
+
+// addObject copies the file into the store unless its content is already there. The copy is verified
+// before it is moved to its final location, so the store never holds a partial or corrupted object.
+func (s *Store) addObject(file, checksum string) (bool, error) {
+	object := s.ObjectPath(checksum)
+	if _, err := os.Lstat(object); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+		return false, fmt.Errorf("unable to create store directory for %s, %s", checksum, err.Error())
+	}
+
+	tmp, err := tempName(object)
+	if err != nil {
+		return false, err
+	}
+	sum, err := copyFile(file, tmp, s.hasher)
+	if err != nil {
+		return false, err
+	}
+	if sum != checksum {
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("unable to export %s, it changed while being exported", file)
+	}
+	_ = os.Chmod(tmp, 0444)
+	if err := os.Rename(tmp, object); err != nil {
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("unable to export %s, %s", file, err.Error())
+	}
+	return true, nil
+}
+
+// Entries returns the latest entry of every file exported to the store, sorted by original path.
+func (s *Store) Entries() ([]*StoreEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := map[string]*StoreEntry{}
+	err := s.readEntries(func(e *StoreEntry) bool {
+		latest[e.Original()] = e
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*StoreEntry, 0, len(latest))
+	for _, e := range latest {
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Original() < ret[j].Original() })
+	return ret, nil
+}
+
+// Restore copies the content of the entry to the given path and restores its mode and modification time.
+// The copy is verified before it is moved to the path, so a failed restore never leaves a partial or
+// corrupted file behind. Existing files are never overwritten.
+func (s *Store) Restore(entry *StoreEntry, dest string) error {
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("unable to restore %s, a file already exists at that path", dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("unable to restore %s, %s", dest, err.Error())
+	}
+
+	tmp, err := tempName(dest)
+	if err != nil {
+		return err
+	}
+	sum, err := copyFile(s.ObjectPath(entry.Checksum), tmp, s.hasher)
+	if err != nil {
+		return err
+	}
+	if sum != entry.Checksum {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("unable to restore %s, the stored content is corrupted", dest)
+	}
+	_ = os.Chmod(tmp, entry.Mode.Perm())
+	_ = os.Chtimes(tmp, entry.ModTime, entry.ModTime)
+	if err := os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("unable to restore %s, %s", dest, err.Error())
+	}
+	return nil
+}
+
+func (s *Store) manifestPath() string {
+	return filepath.Join(s.dir, storeManifest)
+}
+
+func (s *Store) appendEntry(entry *StoreEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal store entry, %s", err.Error())
+	}
+	f, err := os.OpenFile(s.manifestPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open store manifest, %s", err.Error())
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("unable to write store manifest, %s", err.Error())
+	}
+	return nil
+}
+
+func (s *Store) firstEntry() (*StoreEntry, error) {
+	var ret *StoreEntry
+	err := s.readEntries(func(e *StoreEntry) bool {
+		ret = e
+		return false
+	})
+	return ret, err
+}
+
+// readEntries invokes fn with every entry of the manifest, in order, until it returns false.
+func (s *Store) readEntries(fn func(e *StoreEntry) bool) error {
+	f, err := os.Open(s.manifestPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read store manifest, %s", err.Error())
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			entry := &StoreEntry{}
+			if e := json.Unmarshal(data, entry); e != nil {
+				return fmt.Errorf("invalid store manifest entry at line %d, %s", line, e.Error())
+			}
+			if !fn(entry) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read store manifest, %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreAdd(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "tree")
+	a := writeFile(t, filepath.Join(root, "a"), "data", past)
+	b := writeFile(t, filepath.Join(root, "sub", "b"), "data", past)
+
+	s, err := OpenStore(filepath.Join(dir, "store"), "", IOBuffered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Identical contents are only copied once.
+	for i, file := range []string{a, b} {
+		entry, copied, err := s.Add(root, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if copied != (i == 0) {
+			t.Errorf("Add(%s) copied = %v", file, copied)
+		}
+		if entry.Original() != file || entry.Checksum != sha256Of("data") {
+			t.Errorf("Add(%s) = %+v", file, entry)
+		}
+	}
+	if got := readFile(t, s.ObjectPath(sha256Of("data"))); got != "data" {
+		t.Errorf("object holds %q", got)
+	}
+
+	entries, err := s.Entries()
+	if err != nil || len(entries) != 2 || entries[0].Path != "a" || entries[1].Path != "sub/b" {
+		t.Fatalf("Entries() = %v, %v", entries, err)
+	}
+
+	// A store keeps the algorithm it was created with.
+	if _, err := OpenStore(s.Dir(), HashMD5, IOBuffered); err == nil {
+		t.Errorf("a sha256 store was opened for md5")
+	}
+	if reopened, err := OpenStore(s.Dir(), "", IOBuffered); err != nil || reopened.algorithm != HashSHA256 {
+		t.Errorf("OpenStore() = %v, %v", reopened, err)
+	}
+}
+
+func TestStoreRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		occupied bool
+		corrupt  bool
+		wantErr  string
+	}{
+		{name: "restore"},
+		{name: "existing file", occupied: true, wantErr: "a file already exists at that path"},
+		{name: "corrupted object", corrupt: true, wantErr: "the stored content is corrupted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			root := filepath.Join(dir, "tree")
+			file := writeFile(t, filepath.Join(root, "sub", "x"), "data", past)
+			if err := os.Chmod(file, 0600); err != nil {
+				t.Fatal(err)
+			}
+			s, err := OpenStore(filepath.Join(dir, "store"), HashSHA256, IOBuffered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry, _, err := s.Add(root, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dest, err := entry.RestorePath(filepath.Join(dir, "restored"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.occupied {
+				writeFile(t, dest, "other", past)
+			}
+			if tt.corrupt {
+				object := s.ObjectPath(entry.Checksum)
+				if err := os.Chmod(object, 0644); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, object, "DATA", past)
+			}
+
+			err = s.Restore(entry, dest)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Restore() error = %v, want %q", err, tt.wantErr)
+				}
+				if tt.corrupt {
+					if left, _ := os.ReadDir(filepath.Dir(dest)); len(left) != 0 {
+						t.Errorf("the failed restore left %v behind", left)
+					}
+					// Once the object is repaired, the restore can be retried.
+					writeFile(t, s.ObjectPath(entry.Checksum), "data", past)
+					if err := s.Restore(entry, dest); err != nil || readFile(t, dest) != "data" {
+						t.Errorf("Restore() after repair = %v", err)
+					}
+				}
+				if tt.occupied && readFile(t, dest) != "other" {
+					t.Errorf("the existing file was overwritten")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if readFile(t, dest) != "data" || info.Mode().Perm() != 0600 || !info.ModTime().Equal(past) {
+				t.Errorf("restored %s with mode %v and time %v", dest, info.Mode(), info.ModTime())
+			}
+		})
+	}
+}
+
+func TestStoreEntryRestorePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "a/b", want: "/target/a/b"},
+		{path: "a/../b", want: "/target/b"},
+		{path: "/etc/passwd", wantErr: true},
+		{path: "../x", wantErr: true},
+		{path: "a/../../x", wantErr: true},
+		{path: ".", wantErr: true},
+		{path: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := (&StoreEntry{Path: tt.path}).RestorePath("/target")
+		if (err != nil) != tt.wantErr || got != filepath.FromSlash(tt.want) {
+			t.Errorf("RestorePath(%q) = %q, %v, want %q, wantErr %v", tt.path, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
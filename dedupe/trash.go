@@ -0,0 +1,5 @@
+package dedupe
+
+// ActionTrash moves the duplicate to the trash of the current user, from where it can be restored with a
+// file manager. It is only supported on systems following the freedesktop.org Trash specification.
+const ActionTrash = ActionType("trash")
@@ -0,0 +1,194 @@
+//go:build linux || freebsd || openbsd || netbsd || dragonfly
+// +build linux freebsd openbsd netbsd dragonfly
+
+package dedupe
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Trash moves the file to the trash of the current user following the freedesktop.org Trash
+// specification, and returns its new location. Files on the same device as the home directory go to the
+// home trash, files on other volumes go to the '.Trash/$uid' or '.Trash-$uid' directory at the top of
+// their volume, so the file is never copied across devices.
+func Trash(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return "", fmt.Errorf("unable to read file info of %s, %s", file, err.Error())
+	}
+
+	trashDir, topDir, err := trashFor(abs, info)
+	if err != nil {
+		return "", err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(trashDir, sub), 0700); err != nil {
+			return "", fmt.Errorf("unable to create trash directory %s, %s", trashDir, err.Error())
+		}
+	}
+
+	// For volume trashes the original path is stored relative to the top of the volume.
+	origPath := abs
+	if topDir != "" {
+		if rel, err := filepath.Rel(topDir, abs); err == nil {
+			origPath = rel
+		}
+	}
+
+	name, infoFile, err := reserveTrashName(trashDir, filepath.Base(abs), origPath)
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(trashDir, "files", name)
+	if err := os.Rename(abs, dest); err != nil {
+		_ = os.Remove(infoFile)
+		return "", fmt.Errorf("unable to move %s to the trash, %s", file, err.Error())
+	}
+	return dest, nil
+}
+
+// Untrash moves a file trashed to the given location back to its original path, and deletes its
+// .trashinfo file.
+func Untrash(location, original string) error {
+	if _, err := os.Lstat(original); err == nil {
+		return fmt.Errorf("unable to restore %s, a file already exists at that path", original)
+	}
+	if err := os.MkdirAll(filepath.Dir(original), 0755); err != nil {
+		return fmt.Errorf("unable to restore %s, %s", original, err.Error())
+	}
+	if err := os.Rename(location, original); err != nil {
+		return fmt.Errorf("unable to restore %s from the trash, %s", original, err.Error())
+	}
+	infoFile := filepath.Join(filepath.Dir(filepath.Dir(location)), "info", filepath.Base(location)+".trashinfo")
+	if err := os.Remove(infoFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%s was restored but its trash info file could not be removed, %s", original, err.Error())
+	}
+	return nil
+}
+
+// reserveTrashName creates the .trashinfo file of the entry with a name that is not used yet in the trash.
+// The info file is created exclusively, which is what reserves the name as required by the specification.
+func reserveTrashName(trashDir, base, origPath string) (string, string, error) {
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: origPath}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"))
+
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	for i := 1; i < 10000; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d%s", stem, i, ext)
+		}
+		if _, err := os.Lstat(filepath.Join(trashDir, "files", name)); err == nil {
+			continue
+		}
+
+		infoFile := filepath.Join(trashDir, "info", name+".trashinfo")
+		f, err := os.OpenFile(infoFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("unable to create trash info file %s, %s", infoFile, err.Error())
+		}
+		_, err = f.WriteString(content)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			_ = os.Remove(infoFile)
+			return "", "", fmt.Errorf("unable to write trash info file %s, %s", infoFile, err.Error())
+		}
+		return name, infoFile, nil
+	}
+	return "", "", fmt.Errorf("unable to find a free name in the trash for %s", base)
+}
+
+// trashFor returns the trash directory for the given file, and the top directory of its volume when it is
+// not the home trash.
+func trashFor(file string, info os.FileInfo) (string, string, error) {
+	dev := deviceOf(info)
+
+	home := os.Getenv("XDG_DATA_HOME")
+	if home == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", fmt.Errorf("unable to find the home trash, %s", err.Error())
+		}
+		home = filepath.Join(userHome, ".local", "share")
+	}
+	if homeInfo, err := os.Stat(existingParent(home)); err == nil && deviceOf(homeInfo) == dev {
+		return filepath.Join(home, "Trash"), "", nil
+	}
+
+	top := topDirOf(filepath.Dir(file), dev)
+	uid := strconv.Itoa(os.Getuid())
+
+	// The administrator may provide a shared '.Trash' directory, it must have the sticky bit set and not
+	// be a symbolic link.
+	shared := filepath.Join(top, ".Trash")
+	if fi, err := os.Lstat(shared); err == nil && fi.IsDir() && fi.Mode()&os.ModeSticky != 0 {
+		dir := filepath.Join(shared, uid)
+		if err := os.MkdirAll(dir, 0700); err == nil {
+			return dir, top, nil
+		}
+	}
+
+	dir := filepath.Join(top, ".Trash-"+uid)
+	if fi, err := os.Lstat(dir); err == nil && (!fi.IsDir() || fi.Mode()&os.ModeSymlink != 0) {
+		return "", "", fmt.Errorf("unable to use trash directory %s, it is not a directory", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", fmt.Errorf("unable to create trash directory %s, %s", dir, err.Error())
+	}
+	return dir, top, nil
+}
+
+// topDirOf returns the mount point of the volume with the given device that holds dir.
+func topDirOf(dir string, dev uint64) string {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		fi, err := os.Stat(parent)
+		if err != nil || deviceOf(fi) != dev {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+func deviceOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev)
+	}
+	return 0
+}
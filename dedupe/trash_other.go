@@ -0,0 +1,19 @@
+//go:build !linux && !freebsd && !openbsd && !netbsd && !dragonfly
+// +build !linux,!freebsd,!openbsd,!netbsd,!dragonfly
+
+package dedupe
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Trash is only supported on systems following the freedesktop.org Trash specification.
+func Trash(file string) (string, error) {
+	return "", fmt.Errorf("unable to move %s to the trash, not supported on %s", file, runtime.GOOS)
+}
+
+// Untrash is only supported on systems following the freedesktop.org Trash specification.
+func Untrash(location, original string) error {
+	return fmt.Errorf("unable to restore %s from the trash, not supported on %s", original, runtime.GOOS)
+}
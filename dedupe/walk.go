@@ -0,0 +1,142 @@
+package dedupe
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	defaultWalkers = 8
+	readDirBatch   = 1024
+)
+
+// dirQueue is the queue of directories pending to be read by the walkers. It tracks the directories that
+// are queued or being read so the walkers know when the whole tree has been traversed.
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	dirs    []string
+	pending int
+}
+
+func newDirQueue(roots []string) *dirQueue {
+	q := &dirQueue{dirs: append([]string{}, roots...), pending: len(roots)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *dirQueue) push(dir string) {
+	q.mu.Lock()
+	q.dirs = append(q.dirs, dir)
+	q.pending++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop returns the next directory to read, blocking until one is available. It returns false once there
+// are no more directories to process.
+func (q *dirQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.dirs) == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 {
+		return "", false
+	}
+	dir := q.dirs[len(q.dirs)-1]
+	q.dirs = q.dirs[:len(q.dirs)-1]
+	return dir, true
+}
+
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	finished := q.pending == 0
+	q.mu.Unlock()
+	if finished {
+		q.cond.Broadcast()
+	}
+}
+
+// walk traverses the trees under the given roots using a bounded number of concurrent directory readers.
+func (s *service) walk(roots ...string) {
+	workers := s.options.Walkers
+	if workers <= 0 {
+		workers = defaultWalkers
+	}
+
+	q := newDirQueue(roots)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				dir, ok := q.pop()
+				if !ok {
+					return
+				}
+				s.processDir(dir, q)
+				q.done()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// processDir reads the directory in batches so directories with millions of entries are never loaded
+// in memory at once.
+func (s *service) processDir(path string, q *dirQueue) {
+	if s.options.CurrentDirCallback != nil {
+		s.mu.Lock()
+		s.options.CurrentDirCallback(path)
+		s.mu.Unlock()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.addError(fmt.Errorf("error reading contents of path %s, %s", path, err.Error()))
+		return
+	}
+	defer f.Close()
+
+	for {
+		items, err := f.ReadDir(readDirBatch)
+
+		for _, item := range items {
+			if item.IsDir() {
+				if s.options.Recursive {
+					q.push(filepath.Join(path, item.Name()))
+				}
+				continue
+			}
+			info, e := item.Info()
+			if e != nil {
+				s.addError(fmt.Errorf("error reading file info of %s, %s", filepath.Join(path, item.Name()), e.Error()))
+				continue
+			}
+			s.precheck(path, info)
+		}
+
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			s.addError(fmt.Errorf("error reading contents of path %s, %s", path, err.Error()))
+			return
+		}
+	}
+}
+
+func (s *service) addError(err error) {
+	s.mu.Lock()
+	s.errs = append(s.errs, err)
+	s.mu.Unlock()
+}
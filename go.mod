@@ -4,19 +4,17 @@ go 1.17
 
 require (
 	github.com/jucardi/go-logger-lib v1.0.5
-	github.com/jucardi/go-osx v1.0.1
 	github.com/jucardi/go-strings v1.0.4
 	github.com/logrusorgru/aurora v2.0.3+incompatible
 	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/sys v0.0.0-20210510120138-977fb7262007
 )
 
 require (
-	github.com/google/uuid v1.3.0 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/jucardi/go-iso8601 v1.0.3 // indirect
 	github.com/jucardi/go-streams v1.0.3 // indirect
 	github.com/jucardi/go-terminal-colors v1.0.2 // indirect
 	github.com/sirupsen/logrus v1.8.1 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
 )
@@ -24,7 +24,7 @@ var hooks []hook
 // ListenForSignals for a TERM or INT signal.  Once the signal is caught all shutdown hooks will be
 // executed allowing a graceful shutdown
 func ListenForSignals() {
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
@@ -61,11 +61,11 @@ func invokeHooks() {
 
 	wg.Add(len(hooks))
 
-	for _, hook := range hooks {
-		go func() {
+	for i := range hooks {
+		go func(h *hook) {
 			defer wg.Done()
-			hook.execute()
-		}()
+			h.execute()
+		}(&hooks[i])
 	}
 
 	wg.Wait()